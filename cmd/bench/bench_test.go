@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Те же бенчмарки через go test (сравнение прогонов - benchstat):
+//
+//	go test ./cmd/bench -bench Decode -benchmem
+//	go test ./cmd/bench -bench 'Candles/1000' -count 5
+
+func BenchmarkDecode(b *testing.B)  { runGroup(b, "decode/") }
+func BenchmarkCandles(b *testing.B) { runGroup(b, "candles/") }
+
+// runGroup запускает бенчмарки группы подтестами: BenchmarkDecode/aggTrade/legacy
+func runGroup(b *testing.B, prefix string) {
+	for _, bm := range benchmarks {
+		if name, ok := strings.CutPrefix(bm.name, prefix); ok {
+			b.Run(name, bm.fn)
+		}
+	}
+}
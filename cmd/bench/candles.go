@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// Свечи 1s -> 1m -> 5m -> 1h -> 1d по потоку aggTrade: каждый символ
+// торгуется раз в секунду времени событий, сделки идут через каналы,
+// как в пайплайне. trades/s - сколько сделок агрегатор принимает в секунду
+var candleIntervals, _ = aggregator.ParseIntervals([]string{"1s", "1m", "5m", "1h", "1d"}, time.UTC)
+
+func init() {
+	register(
+		candlesBenchmark("candles/1000symbols/legacy", 1000, startLegacyCandles),
+		candlesBenchmark("candles/1000symbols/rollup", 1000, startRollupCandles),
+		candlesBenchmark("candles/5000symbols/legacy", 5000, startLegacyCandles),
+		candlesBenchmark("candles/5000symbols/rollup", 5000, startRollupCandles),
+	)
+}
+
+// startCandles запускает агрегатор и возвращается, когда in закрыт
+type startCandles func(ctx context.Context, in <-chan models.UniversalTrade, out chan<- *models.Window)
+
+func startRollupCandles(ctx context.Context, in <-chan models.UniversalTrade, out chan<- *models.Window) {
+	aggregator.NewWindowAggregator(aggregator.WindowConfig{Intervals: candleIntervals}, in, out).Start(ctx)
+}
+
+func startLegacyCandles(ctx context.Context, in <-chan models.UniversalTrade, out chan<- *models.Window) {
+	newLegacyWindowAggregator(candleIntervals, 2*time.Second, out).Start(ctx, in)
+}
+
+func candlesBenchmark(name string, symbols int, start startCandles) benchmark {
+	return benchmark{
+		name: name,
+		fn: func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			in := make(chan models.UniversalTrade, 1000)
+			out := make(chan *models.Window, 1000)
+			done := make(chan struct{})
+			go func() {
+				start(ctx, in, out)
+				close(done)
+			}()
+			go func() {
+				for {
+					select {
+					case <-out:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			gen := newTradeGen(symbols)
+			b.ReportAllocs()
+			for b.Loop() {
+				in <- gen.next()
+			}
+			close(in)
+			<-done
+
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "trades/s")
+		},
+	}
+}
+
+// tradeGen - сделки по кругу символов, время событий растет на секунду за круг
+type tradeGen struct {
+	symbols []string
+	prices  []decimal.Decimal
+	qty     decimal.Decimal
+	start   time.Time
+	step    time.Duration
+	i       int
+}
+
+func newTradeGen(symbols int) *tradeGen {
+	g := &tradeGen{
+		symbols: make([]string, symbols),
+		prices:  make([]decimal.Decimal, 256),
+		qty:     decimal.MustParse("0.015"),
+		start:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		step:    time.Second / time.Duration(symbols),
+	}
+	for i := range g.symbols {
+		g.symbols[i] = fmt.Sprintf("SYM%04dUSDT", i)
+	}
+	for i := range g.prices {
+		g.prices[i] = decimal.New(int64(1_000_000+i*37), 4)
+	}
+	return g
+}
+
+func (g *tradeGen) next() models.UniversalTrade {
+	i := g.i
+	g.i++
+	return models.UniversalTrade{
+		Symbol:    g.symbols[i%len(g.symbols)],
+		EventType: "aggTrade",
+		Timestamp: g.start.Add(time.Duration(i) * g.step),
+		Price:     g.prices[i%len(g.prices)],
+		Quantity:  g.qty,
+	}
+}
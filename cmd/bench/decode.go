@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/processor/legacy"
+)
+
+// Типичные сообщения Binance: combined aggTrade, combined miniTicker
+// и весь рынок !miniTicker@arr в raw-формате
+var (
+	aggTradeMsg    = []byte(`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":1672515782136,"s":"BTCUSDT","a":2837193845,"p":"16541.34000000","q":"0.00605000","f":3204881232,"l":3204881232,"T":1672515782136,"m":true,"M":true}}`)
+	miniTickerMsg  = []byte(`{"stream":"btcusdt@miniTicker","data":{"e":"24hrMiniTicker","E":1672515782136,"s":"BTCUSDT","c":"16541.34000000","o":"16610.12000000","h":"16650.00000000","l":"16480.55000000","v":"152340.12345000","q":"2523456789.12345678"}}`)
+	tickerArrayMsg = buildTickerArray(300)
+)
+
+func init() {
+	register(
+		decodeBenchmark("decode/aggTrade/legacy", legacy.Parse, aggTradeMsg),
+		decodeBenchmark("decode/aggTrade/single-pass", exchange.NewBinance("").Decode, aggTradeMsg),
+		decodeBenchmark("decode/miniTicker/legacy", legacy.Parse, miniTickerMsg),
+		decodeBenchmark("decode/miniTicker/single-pass", exchange.NewBinance("").Decode, miniTickerMsg),
+		decodeBenchmark("decode/tickerArray300/legacy", legacy.Parse, tickerArrayMsg),
+		decodeBenchmark("decode/tickerArray300/single-pass", exchange.NewBinance("").Decode, tickerArrayMsg),
+	)
+}
+
+func decodeBenchmark[T any](name string, decode func([]byte) ([]T, error), msg []byte) benchmark {
+	return benchmark{
+		name: name,
+		fn: func(b *testing.B) {
+			b.SetBytes(int64(len(msg)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := decode(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		},
+	}
+}
+
+func buildTickerArray(n int) []byte {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i := range n {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb,
+			`{"e":"24hrMiniTicker","E":1672515782136,"s":"SYM%dUSDT","c":"1.%04d","o":"1.0000","h":"1.5000","l":"0.9000","v":"100000.00","q":"120000.00"}`,
+			i, i)
+	}
+	sb.WriteByte(']')
+	return []byte(sb.String())
+}
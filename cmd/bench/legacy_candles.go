@@ -0,0 +1,162 @@
+package main
+
+// Копия агрегатора свечей до перехода на rollup: каждая сделка обновляет
+// свечи всех интервалов, ключ - строка fmt.Sprintf, свечи - в sync.Map под
+// мьютексом. База для сравнения в бенчмарках candles.
+// Не менять: иначе сравнение потеряет смысл. Убраны только лог
+// "Window started", чтобы не мерить вывод, и порог getPercent
+// (он не экспортируется) - вместо него константа
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+type legacyClock struct {
+	maxEvent  time.Time
+	watermark time.Time
+	keys      map[string]time.Time
+}
+
+type legacyWindowAggregator struct {
+	intervals []aggregator.Interval
+	maxDelay  time.Duration
+
+	windowsMap sync.Map // key: <coin_name>:<interval>:<start_time_unix> value: *models.Window
+	clocks     map[string]*legacyClock
+
+	lastPrices sync.Map // key: <coin_name> value: decimal.Decimal
+	out        chan<- *models.Window
+}
+
+func newLegacyWindowAggregator(intervals []aggregator.Interval, maxDelay time.Duration, out chan<- *models.Window) *legacyWindowAggregator {
+	return &legacyWindowAggregator{
+		intervals: intervals,
+		maxDelay:  maxDelay,
+		clocks:    make(map[string]*legacyClock),
+		out:       out,
+	}
+}
+
+func (wa *legacyWindowAggregator) Start(ctx context.Context, in <-chan models.UniversalTrade) {
+	for trade := range in {
+		wa.processAggTrade(ctx, trade)
+	}
+}
+
+func (wa *legacyWindowAggregator) processAggTrade(ctx context.Context, trade models.UniversalTrade) {
+	clock, ok := wa.clocks[trade.Symbol]
+	if !ok {
+		clock = &legacyClock{keys: make(map[string]time.Time)}
+		wa.clocks[trade.Symbol] = clock
+	}
+
+	for _, interval := range wa.intervals {
+		wa.updateWindow(trade, interval, clock)
+	}
+
+	if trade.Timestamp.After(clock.maxEvent) {
+		clock.maxEvent = trade.Timestamp
+		wa.advance(ctx, clock, trade.Timestamp.Add(-wa.maxDelay))
+	}
+
+	if wa.shouldUpdateLastPrice(&trade) {
+		wa.lastPrices.Store(trade.Symbol, trade.Price)
+	}
+}
+
+func (wa *legacyWindowAggregator) shouldUpdateLastPrice(trade *models.UniversalTrade) bool {
+	lastPrice, exist := wa.lastPrices.Load(trade.Symbol)
+	if !exist {
+		return true
+	}
+
+	last := lastPrice.(decimal.Decimal)
+	if last.IsZero() {
+		return true
+	}
+
+	change := trade.Price.Sub(last).Abs().Div(last, decimal.MaxScale).Float64()
+	return change >= 0.001
+}
+
+func (wa *legacyWindowAggregator) updateWindow(trade models.UniversalTrade, iv aggregator.Interval, clock *legacyClock) {
+	interval := iv.String()
+	windowStartTime := iv.Start(trade.Timestamp)
+	windowEndTime := iv.End(windowStartTime)
+	key := fmt.Sprintf("%s:%s:%d", trade.Symbol, interval, windowStartTime.Unix())
+
+	existing, ok := wa.windowsMap.Load(key)
+	if !ok && !windowEndTime.After(clock.watermark) {
+		return
+	}
+
+	windowInterface := existing
+	if !ok {
+		windowInterface, _ = wa.windowsMap.LoadOrStore(key, &models.Window{
+			Symbol:    trade.Symbol,
+			Interval:  interval,
+			StartTime: windowStartTime,
+		})
+		clock.keys[key] = windowEndTime
+	}
+
+	window := windowInterface.(*models.Window)
+
+	window.Mu.Lock()
+	if window.Trades == 0 || trade.Timestamp.Before(window.FirstTradeTime) {
+		window.Open = trade.Price
+		window.FirstTradeTime = trade.Timestamp
+	}
+	if window.Trades == 0 || !trade.Timestamp.Before(window.LastTradeTime) {
+		window.Close = trade.Price
+		window.LastTradeTime = trade.Timestamp
+	}
+	if trade.Price.GreaterThan(window.High) {
+		window.High = trade.Price
+	}
+	if trade.Price.LessThan(window.Low) || window.Low.IsZero() {
+		window.Low = trade.Price
+	}
+	window.Quantity = window.Quantity.Add(trade.Quantity)
+	window.Trades++
+	window.Mu.Unlock()
+}
+
+func (wa *legacyWindowAggregator) advance(ctx context.Context, clock *legacyClock, watermark time.Time) {
+	if !watermark.After(clock.watermark) {
+		return
+	}
+	clock.watermark = watermark
+
+	for key, windowEndTime := range clock.keys {
+		if windowEndTime.After(watermark) {
+			continue
+		}
+		value, ok := wa.windowsMap.Load(key)
+		if !ok {
+			delete(clock.keys, key)
+			continue
+		}
+		window := value.(*models.Window)
+
+		window.Mu.Lock()
+		window.EndTime = windowEndTime
+		window.Mu.Unlock()
+
+		if window.Trades > 0 {
+			select {
+			case wa.out <- window.Snapshot():
+			case <-ctx.Done():
+			}
+		}
+		wa.windowsMap.Delete(key)
+		delete(clock.keys, key)
+	}
+}
@@ -0,0 +1,82 @@
+// Бенчмарки горячих участков пайплайна:
+//
+//	go run ./cmd/bench
+//	go run ./cmd/bench -run decode -benchtime 3s
+//	go test ./cmd/bench -bench Decode -benchmem
+//
+// Каждый бенчмарк запускается через testing.Benchmark, результат -
+// строка с ns/op, B/op, allocs/op и метриками из b.ReportMetric. Те же
+// бенчмарки доступны go test (bench_test.go). Базовые (legacy) варианты
+// оставлены рядом, чтобы сравнивать с ними новые реализации; исходный
+// разбор сообщений - в internal/processor/legacy
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+type benchmark struct {
+	name string
+	fn   func(b *testing.B)
+}
+
+// benchmarks - все бенчмарки, группы регистрируются в своих файлах
+var benchmarks []benchmark
+
+func register(bs ...benchmark) {
+	benchmarks = append(benchmarks, bs...)
+}
+
+func main() {
+	run := flag.String("run", ".", "регулярное выражение для имен бенчмарков")
+	benchtime := flag.String("benchtime", "1s", "время на каждый бенчмарк")
+	flag.Parse()
+
+	testing.Init()
+	if err := flag.Set("test.benchtime", *benchtime); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -benchtime:", err)
+		os.Exit(2)
+	}
+
+	re, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid -run:", err)
+		os.Exit(2)
+	}
+
+	const row = "%-40s %10v %12v %10v %10v %10v%s\n"
+	fmt.Printf(row, "benchmark", "ops", "ns/op", "MB/s", "B/op", "allocs/op", "")
+
+	for _, bm := range benchmarks {
+		if !re.MatchString(bm.name) {
+			continue
+		}
+
+		r := testing.Benchmark(bm.fn)
+		mbs := "-"
+		if r.Bytes > 0 && r.T > 0 {
+			mbs = fmt.Sprintf("%.2f", float64(r.Bytes)*float64(r.N)/1e6/r.T.Seconds())
+		}
+		fmt.Printf(row, bm.name, r.N, r.NsPerOp(), mbs, r.AllocedBytesPerOp(), r.AllocsPerOp(), extra(r))
+	}
+}
+
+// extra - метрики из b.ReportMetric: "  52341 trades/s"
+func extra(r testing.BenchmarkResult) string {
+	units := make([]string, 0, len(r.Extra))
+	for unit := range r.Extra {
+		units = append(units, unit)
+	}
+	slices.Sort(units)
+
+	var s string
+	for _, unit := range units {
+		s += fmt.Sprintf("  %.0f %s", r.Extra[unit], unit)
+	}
+	return s
+}
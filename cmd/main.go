@@ -10,9 +10,14 @@ import (
 
 	"github.com/WWoi/web-parcer/config"
 	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/kafka"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
 	"github.com/WWoi/web-parcer/internal/lib/logger/ownlog"
 	"github.com/WWoi/web-parcer/internal/models"
 	"github.com/WWoi/web-parcer/internal/processor"
+	"github.com/WWoi/web-parcer/internal/validation"
 	"github.com/WWoi/web-parcer/internal/websocket"
 	"github.com/joho/godotenv"
 )
@@ -46,57 +51,232 @@ func main() {
 	rawMessages := make(chan []byte, 100)
 	procOut := make(chan models.UniversalTrade, 100)
 	dailyStatChan := make(chan *models.DailyStat, 2000) // буфер для ~2000 монет
+	bookStatChan := make(chan *models.BookStat, 2000)
+	orderBookChan := make(chan *models.OrderBookStat, 100)
 
-	// ========== WEBSOCKET ==========
-	ws := websocket.New(websocket.MiniTickerAllURL, rawMessages, 5*time.Second)
-	go ws.Start(ctx)
+	// ========== БИРЖА ==========
+	ex, err := exchange.New(cfg.Exchange, cfg.WebSocket.BaseURL)
+	if err != nil {
+		slog.Error("Invalid exchange in config", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("🏦 Exchange selected", "exchange", ex.Name())
+
+	// ========== ИСТОЧНИК ==========
+	if cfg.Replay.Enabled {
+		startReplay(ctx, rawMessages)
+	} else {
+		startWebSocket(ctx, ex, rawMessages)
+	}
+
+	restClient := newRestClient()
 
 	// ========== PROCESSOR ==========
-	proc := processor.New(rawMessages, procOut)
+	procOpts := []processor.Option{processor.WithWorkers(cfg.Processor.Workers)}
+	if cfg.Metadata.Enabled {
+		if meta := startMetadata(ctx, ex.Name(), restClient); meta != nil {
+			procOpts = append(procOpts, processor.WithSymbols(meta), processor.WithScales(meta))
+		}
+	}
+	var deadLetters *deadletter.Queue
+	if cfg.DeadLetter.Enabled {
+		deadLetters = startDeadLetters(ctx)
+		procOpts = append(procOpts, processor.WithDeadLetter(deadLetters))
+	}
+	// Записи воспроизводятся тем же адаптером: в них сырые фреймы биржи
+	proc := processor.New(rawMessages, procOut, ex, procOpts...)
 	go proc.Start(ctx)
 
+	// ========== GAPS ==========
+	// Детектор встает между процессором и потребителями: им уходят
+	// события без повторов и догруженные сделки
+	var routed <-chan models.UniversalTrade = procOut
+	var gapsChan chan models.TradeGap
+	// Пока у символа не закрыт пропуск, его свечи не закрываются
+	var hold aggregator.WatermarkHold
+	if cfg.Gaps.Enabled {
+		checked := make(chan models.UniversalTrade, 100)
+		if cfg.Kafka.Enabled {
+			gapsChan = make(chan models.TradeGap, 100)
+		}
+		hold = startGapDetector(ctx, restClient, procOut, checked, gapsChan)
+		routed = checked
+	}
+
+	// ========== VALIDATION ==========
+	// Плохие события отсеиваются до агрегаторов, после поиска пропусков:
+	// отброшенная сделка не должна выглядеть пропуском
+	var validator *validation.Validator
+	if cfg.Validation.Enabled {
+		valid := make(chan models.UniversalTrade, 100)
+		validator = startValidator(ctx, routed, valid, deadLetters)
+		routed = valid
+	}
+
+	// ========== ROUTER ==========
+	router := processor.NewRouter(routed)
+	tickers := router.Route(websocket.MiniTicker)
+	books := router.Route(websocket.BookTicker)
+	var trades, klines, depth <-chan models.UniversalTrade
+	if cfg.Windows.Enabled || cfg.Reconcile.Enabled {
+		trades = router.Route(websocket.AggTrade, websocket.Trade)
+	}
+	if cfg.Reconcile.Enabled {
+		klines = router.Route(websocket.Kline)
+	}
+	if cfg.OrderBook.Enabled {
+		depth = router.Route(websocket.DepthUpdate)
+	}
+	go router.Start(ctx)
+
 	// ========== AGGREGATOR ==========
-	agg := aggregator.NewMetricsProcessor(procOut, dailyStatChan)
+	agg := aggregator.NewMetricsProcessor(tickers, dailyStatChan)
 	go agg.Start()
 
-	go func() {
-		for stat := range dailyStatChan {
-			fmt.Printf(
-				"📊 24h STATS: %s | Open: %.2f → Close: %.2f | High: %.2f | Low: %.2f | Vol: %.2f | %s\n",
-				stat.Symbol,
-				stat.OpenPrice,
-				stat.ClosePrice,
-				stat.HighPrice,
-				stat.LowPrice,
-				stat.Volume,
-				stat.ChangeFormatted(),
-			)
+	bookAgg := aggregator.NewBookProcessor(books, bookStatChan, cfg.Book.EmitInterval)
+	bookAgg.Start(ctx)
+
+	// ========== ORDER BOOK ==========
+	if cfg.OrderBook.Enabled {
+		startOrderBook(ctx, restClient, depth, orderBookChan)
+	}
+
+	// ========== ВЫВОД ==========
+	if cfg.Kafka.Enabled {
+		startProducer(ctx, cfg.Kafka.DailyStatsTopic, dailyStatChan, kafka.DailyStatRecord)
+		startProducer(ctx, cfg.Kafka.BookStatsTopic, bookStatChan, kafka.BookStatRecord)
+		startProducer(ctx, cfg.Kafka.OrderBookTopic, orderBookChan, kafka.OrderBookStatRecord)
+		if gapsChan != nil {
+			startProducer(ctx, cfg.Kafka.GapsTopic, gapsChan, kafka.TradeGapRecord)
 		}
-	}()
+	} else {
+		go func() {
+			for stat := range dailyStatChan {
+				symbol := stat.Symbol
+				if stat.Pair != "" {
+					symbol = stat.Pair
+				}
+				fmt.Printf(
+					"📊 24h STATS: %s | Open: %s → Close: %s | High: %s | Low: %s | Vol: %s | %s\n",
+					symbol,
+					stat.OpenPrice,
+					stat.ClosePrice,
+					stat.HighPrice,
+					stat.LowPrice,
+					stat.Volume,
+					stat.ChangeFormatted(),
+				)
+			}
+		}()
 
-	// windowsChan := make(chan *models.Window)
-	// agg := aggregator.NewWindowAggregator(procOut, windowsChan)
-	// go agg.Start(ctx)
-	//
-	// // Убираем дублирование вывода
-	// go func() {
-	// 	for window := range windowsChan {
-	// 		fmt.Printf(
-	// 			"🕯️ CANDLE: %s [%s] | Open: %.2f → Close: %.2f | High: %.2f | Low: %.2f | Vol: %.4f | Trades: %d\n",
-	// 			window.Symbol,
-	// 			window.Interval,
-	// 			window.Open,
-	// 			window.Close,
-	// 			window.High,
-	// 			window.Low,
-	// 			window.Quantity,
-	// 			window.Trades,
-	// 		)
-	// 	}
-	// }()
+		go func() {
+			for stat := range bookStatChan {
+				fmt.Printf(
+					"📖 BOOK: %s | Bid: %s (%s) | Ask: %s (%s) | Spread: %s (%s bps) | Mid: %s | Micro: %s\n",
+					stat.Symbol,
+					stat.BidPrice,
+					stat.BidQty,
+					stat.AskPrice,
+					stat.AskQty,
+					stat.Spread(),
+					stat.SpreadBps(),
+					stat.MidPrice(),
+					stat.MicroPrice(),
+				)
+			}
+		}()
+
+		go func() {
+			for stat := range orderBookChan {
+				var bid, ask models.PriceLevel
+				if len(stat.Bids) > 0 {
+					bid = stat.Bids[0]
+				}
+				if len(stat.Asks) > 0 {
+					ask = stat.Asks[0]
+				}
+				fmt.Printf(
+					"📗 ORDER BOOK: %s #%d | Bid: %s (%s) | Ask: %s (%s) | Mid: %s | Imbalance: %s%s\n",
+					stat.Symbol,
+					stat.LastUpdateID,
+					bid.Price,
+					bid.Quantity,
+					ask.Price,
+					ask.Quantity,
+					stat.MidPrice,
+					stat.Imbalance,
+					formatDepth(stat.Depth),
+				)
+			}
+		}()
+	}
+
+	// ========== CANDLES ==========
+	// Свечи из сделок выводятся (windows.enabled) и сверяются с закрытыми
+	// kline биржи (reconcile.enabled)
+	var (
+		reconciler *aggregator.Reconciler
+		windowAgg  *aggregator.WindowAggregator
+	)
+	if trades != nil {
+		windowsChan := make(chan *models.Window, 100)
+		windowAgg = startWindows(ctx, trades, windowsChan, hold)
+
+		var outs []chan<- *models.Window
+		if cfg.Windows.Enabled {
+			candles := make(chan *models.Window, 100)
+			startCandles(ctx, candles)
+			outs = append(outs, candles)
+		}
+		if cfg.Reconcile.Enabled {
+			reconcileIn := make(chan *models.Window, 100)
+			reconciler = aggregator.NewReconciler(aggregator.ReconcileConfig{
+				PriceTolerance:  decimal.FromFloat(cfg.Reconcile.PriceTolerance, 8),
+				VolumeTolerance: decimal.FromFloat(cfg.Reconcile.VolumeTolerance, 8),
+				MaxWait:         cfg.Reconcile.MaxWait,
+			}, reconcileIn, klines, nil)
+			go reconciler.Start(ctx)
+			outs = append(outs, reconcileIn)
+		}
+		go fanOut(ctx, windowsChan, outs...)
+	}
 
 	<-ctx.Done()
 
+	if reconciler != nil {
+		s := reconciler.Stats()
+		slog.Info("⚖️ Reconcile summary",
+			"matched", s.Matched,
+			"mismatched", s.Mismatched,
+			"missing_window", s.MissingWindow,
+			"missing_kline", s.MissingKline)
+	}
+
+	if windowAgg != nil {
+		s := windowAgg.Stats()
+		slog.Info("🕯️ Late trades summary",
+			"late", s.Late,
+			"updated", s.Updated,
+			"dropped", s.Dropped,
+			"revisions", s.Revisions)
+		if cfg.Windows.GapFill {
+			slog.Info("🕳️ Gap fill summary", "synthetic", s.Synthetic, "retired", s.Retired)
+		}
+	}
+
+	if validator != nil {
+		s := validator.Stats()
+		attrs := []any{"passed", s.Passed, "flagged", s.Flagged, "dropped", s.Dropped, "quarantined", s.Quarantined}
+		for rule, n := range s.ByRule {
+			attrs = append(attrs, rule, n)
+		}
+		slog.Info("🧪 Validation summary", attrs...)
+	}
+
+	if cfg.Metadata.Enabled {
+		slog.Info("🗂️ Metadata summary", "off_scale", proc.Stats().OffScale)
+	}
+
 	slog.Info("⌛ Wait for completion all the processes")
 	time.Sleep(1500 * time.Millisecond)
 
@@ -0,0 +1,57 @@
+// Фейковый Binance WebSocket для локального запуска и CI без сети:
+//
+//	go run ./cmd/mockexchange -addr localhost:9443
+//
+// и в конфиге основного приложения websocket.base_url: ws://localhost:9443
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/mockexchange"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9443", "адрес для подключения клиентов")
+	symbols := flag.String("symbols", "BTCUSDT,ETHUSDT,BNBUSDT", "символы для !miniTicker@arr")
+	tick := flag.Duration("tick", 100*time.Millisecond, "как часто генерировать события")
+	seed := flag.Int64("seed", 0, "зерно генератора (0 - случайное)")
+	delay := flag.Duration("delay", 0, "задержка перед каждым фреймом")
+	ping := flag.Duration("ping", 0, "как часто слать ping (0 - никогда)")
+	disconnect := flag.Duration("disconnect-after", 0, "рвать каждое соединение через это время (0 - никогда)")
+	malformed := flag.Float64("malformed", 0, "доля битых фреймов, 0..1")
+	requestLimit := flag.Int("request-limit", 0, "входящих сообщений в секунду на соединение, больше - разрыв (0 - без ограничения)")
+	halted := flag.String("halted", "", "символы со статусом HALT в exchangeInfo, через запятую")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	srv := mockexchange.New(mockexchange.Config{
+		Symbols:         strings.Split(*symbols, ","),
+		TickInterval:    *tick,
+		Seed:            *seed,
+		Delay:           *delay,
+		PingInterval:    *ping,
+		DisconnectAfter: *disconnect,
+		MalformedRate:   *malformed,
+		RequestLimit:    *requestLimit,
+		Halted:          strings.Split(*halted, ","),
+	})
+
+	baseURL, err := srv.Listen(ctx, *addr)
+	if err != nil {
+		slog.Error("Could not start mock exchange", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("🧪 Mock exchange started", "base_url", baseURL)
+	<-ctx.Done()
+	slog.Info("👋 Mock exchange stopped")
+}
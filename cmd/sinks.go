@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/kafka"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// startProducer публикует все, что приходит в канал, в топик Kafka
+func startProducer[T any](ctx context.Context, topic string, in <-chan T, convert kafka.Converter[T]) {
+	producer := kafka.NewProducer(kafka.ProducerConfig{
+		BrokersURL:   cfg.Kafka.Brokers,
+		Topic:        topic,
+		BatchSize:    cfg.Kafka.BatchSize,
+		BatchTimeout: cfg.Kafka.BatchTimeout,
+		MaxAttemps:   cfg.Kafka.MaxAttempts,
+		WriteTimeout: cfg.Kafka.WriteTimeout,
+	}, in, convert)
+	go producer.Start(ctx)
+}
+
+// startCandles выводит свечи из сделок в Kafka или в консоль
+func startCandles(ctx context.Context, in <-chan *models.Window) {
+	if cfg.Kafka.Enabled {
+		startProducer(ctx, cfg.Kafka.CandlesTopic, in, kafka.WindowRecord)
+		return
+	}
+
+	go func() {
+		for window := range in {
+			revision := ""
+			switch {
+			case window.Synthetic:
+				revision = " | Synthetic"
+			case window.Revision > 0:
+				revision = fmt.Sprintf(" | Revision: %d", window.Revision)
+			}
+			fmt.Printf(
+				"🕯️ CANDLE: %s [%s] %s | Open: %s → Close: %s | High: %s | Low: %s | Vol: %s | VWAP: %s | Buy/Sell: %s/%s | Trades: %d%s\n",
+				window.Symbol,
+				window.Interval,
+				window.StartTime.UTC().Format(time.RFC3339),
+				window.Open,
+				window.Close,
+				window.High,
+				window.Low,
+				window.Quantity,
+				window.VWAP(),
+				window.TakerBuyVolume,
+				window.TakerSellVolume,
+				window.Trades,
+				revision,
+			)
+		}
+	}()
+}
+
+// fanOut копирует каждое значение из in во все выходы
+func fanOut[T any](ctx context.Context, in <-chan T, outs ...chan<- T) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-in:
+			if !ok {
+				return
+			}
+			for _, out := range outs {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// startDeadLetters запускает dead-letter очередь с синками из конфига
+func startDeadLetters(ctx context.Context) *deadletter.Queue {
+	var sinks []deadletter.Sink
+	for _, name := range cfg.DeadLetter.Sinks {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "file":
+			sink, err := deadletter.NewFileSink(cfg.DeadLetter.Dir, cfg.DeadLetter.MaxFileSize)
+			if err != nil {
+				slog.Error("Could not start dead letter file sink", "error", err)
+				os.Exit(1)
+			}
+			sinks = append(sinks, sink)
+
+		case "kafka":
+			if !cfg.Kafka.Enabled {
+				slog.Warn("Dead letter kafka sink needs kafka.enabled, skipped")
+				continue
+			}
+			letters := make(chan deadletter.Letter, 100)
+			startProducer(ctx, cfg.Kafka.DeadLetterTopic, letters, kafka.DeadLetterRecord)
+			sinks = append(sinks, deadletter.NewChanSink(letters))
+
+		default:
+			slog.Error("Unknown dead letter sink", "sink", name)
+			os.Exit(1)
+		}
+	}
+
+	queue := deadletter.NewQueue(deadletter.Config{
+		QueueSize:      cfg.DeadLetter.QueueSize,
+		MaxPayload:     cfg.DeadLetter.MaxPayload,
+		ReportInterval: cfg.DeadLetter.ReportInterval,
+	}, sinks...)
+	go queue.Start(ctx)
+
+	slog.Info("☠️ Dead letters enabled", "sinks", cfg.DeadLetter.Sinks, "dir", cfg.DeadLetter.Dir)
+	return queue
+}
+
+// formatDepth - " | ±1%: 12.5/9.1" по каждой полосе глубины (bid/ask объем)
+func formatDepth(depth []models.DepthBand) string {
+	var sb strings.Builder
+	for _, band := range depth {
+		fmt.Fprintf(&sb, " | ±%s%%: %s/%s", band.Percent, band.BidQty, band.AskQty)
+	}
+	return sb.String()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/kafka"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/metadata"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/orderbook"
+	"github.com/WWoi/web-parcer/internal/processor"
+	"github.com/WWoi/web-parcer/internal/recorder"
+	"github.com/WWoi/web-parcer/internal/replay"
+	"github.com/WWoi/web-parcer/internal/rest"
+	"github.com/WWoi/web-parcer/internal/validation"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// startWebSocket подключается к бирже: одно соединение или пул шардов
+func startWebSocket(ctx context.Context, ex exchange.Exchange, out chan<- []byte) {
+	watchdogCfg := websocket.WatchdogConfig{
+		PingInterval: cfg.WebSocket.Watchdog.PingInterval,
+		DeadAfter:    cfg.WebSocket.Watchdog.DeadAfter,
+	}
+	if len(cfg.WebSocket.Watchdog.StreamSilence) > 0 {
+		watchdogCfg.StreamSilence = make(map[websocket.StreamKind]time.Duration)
+		for kind, silence := range cfg.WebSocket.Watchdog.StreamSilence {
+			watchdogCfg.StreamSilence[websocket.StreamKind(kind)] = silence
+		}
+	}
+
+	wsOptions := append(exchange.ClientOptions(ex),
+		websocket.WithRotation(cfg.WebSocket.RotateAfter, cfg.WebSocket.RotationOverlap),
+		websocket.WithWatchdog(watchdogCfg),
+	)
+
+	if cfg.Recorder.Enabled {
+		rec, err := recorder.New(recorder.Config{
+			Dir:          cfg.Recorder.Dir,
+			MaxFileSize:  cfg.Recorder.MaxFileSize,
+			RotateHourly: cfg.Recorder.RotateHourly,
+		})
+		if err != nil {
+			slog.Error("Could not start frame recorder", "error", err)
+			os.Exit(1)
+		}
+		go rec.Start(ctx)
+		wsOptions = append(wsOptions, websocket.WithRecorder(rec))
+	}
+
+	if cfg.WebSocket.Shards > 0 {
+		pool := websocket.NewPool(websocket.PoolConfig{
+			URL:                ex.SubscribeEndpoint(),
+			Protocol:           ex,
+			Shards:             cfg.WebSocket.Shards,
+			MaxStreamsPerShard: cfg.WebSocket.MaxStreamsPerShard,
+			ReconnectDelay:     cfg.WebSocket.ReconnectDelay,
+			ClientOptions:      wsOptions,
+		}, out)
+
+		// До Start соединений еще нет: стримы только распределяются по шардам
+		if err := pool.Add(ctx, cfg.WebSocket.Streams...); err != nil {
+			slog.Error("Invalid websocket streams in config", "error", err)
+			os.Exit(1)
+		}
+		go pool.Start(ctx)
+	} else {
+		wsURL, subscribe, err := ex.Endpoint(cfg.WebSocket.Streams)
+		if err != nil {
+			slog.Error("Invalid websocket streams in config", "error", err)
+			os.Exit(1)
+		}
+
+		ws := websocket.New(wsURL, out, cfg.WebSocket.ReconnectDelay, wsOptions...)
+
+		// Стримы, которые биржа не принимает в адресе, подписываются при подключении
+		if err := ws.Subscriptions().Subscribe(ctx, subscribe...); err != nil {
+			slog.Error("Invalid websocket streams in config", "error", err)
+			os.Exit(1)
+		}
+		go ws.Start(ctx)
+	}
+}
+
+// startReplay воспроизводит записанные фреймы вместо подключения к бирже
+func startReplay(ctx context.Context, out chan<- []byte) {
+	src, err := replay.New(replay.Config{
+		Dir:   cfg.Replay.Dir,
+		Mode:  replay.Mode(cfg.Replay.Mode),
+		Speed: cfg.Replay.Speed,
+	}, out)
+	if err != nil {
+		slog.Error("Could not start replay", "error", err)
+		os.Exit(1)
+	}
+
+	go src.Start(ctx)
+}
+
+// newRestClient - REST API биржи для снимков стакана и догрузки сделок
+func newRestClient() *rest.Client {
+	return rest.New(cfg.Rest.BaseURL, rest.WithDoer(&http.Client{Timeout: cfg.Rest.Timeout}))
+}
+
+// startMetadata загружает exchangeInfo и обновляет его в фоне.
+// Если первая загрузка не удалась, события идут без метаданных до следующего обновления.
+// REST источник есть только у binance: для других бирж без metadata.file - nil
+func startMetadata(ctx context.Context, exchangeName string, client *rest.Client) *metadata.Cache {
+	var source metadata.Source
+	switch {
+	case cfg.Metadata.File != "":
+		source = metadata.NewFileSource(cfg.Metadata.File)
+	case exchangeName == exchange.Binance:
+		source = client
+	default:
+		slog.Warn("metadata.enabled has no exchangeInfo source for exchange, set metadata.file",
+			"exchange", exchangeName)
+		return nil
+	}
+
+	cache := metadata.NewCache(metadata.Config{
+		RefreshInterval: cfg.Metadata.RefreshInterval,
+		LoadTimeout:     cfg.Rest.Timeout,
+	}, exchangeName, source)
+	if err := cache.Load(ctx); err != nil {
+		slog.Warn("⚠️ Could not load exchange metadata", "exchange", exchangeName, "error", err)
+	}
+	go cache.Start(ctx)
+	return cache
+}
+
+// startOrderBook ведет локальные стаканы: снимки по REST, изменения из depth стримов
+func startOrderBook(ctx context.Context, client *rest.Client, in <-chan models.UniversalTrade, out chan<- *models.OrderBookStat) {
+	percents := make([]decimal.Decimal, 0, len(cfg.OrderBook.DepthPercents))
+	for _, p := range cfg.OrderBook.DepthPercents {
+		percents = append(percents, decimal.FromFloat(p, 4))
+	}
+
+	manager := orderbook.NewManager(orderbook.Config{
+		SnapshotLimit: cfg.OrderBook.SnapshotLimit,
+		TopLevels:     cfg.OrderBook.TopLevels,
+		DepthPercents: percents,
+		EmitInterval:  cfg.OrderBook.EmitInterval,
+		ResyncDelay:   cfg.OrderBook.ResyncDelay,
+	}, client, in, out)
+	go manager.Start(ctx)
+}
+
+// startGapDetector проверяет aggTrade ID между процессором и потребителями
+func startGapDetector(
+	ctx context.Context,
+	client *rest.Client,
+	in <-chan models.UniversalTrade,
+	out chan<- models.UniversalTrade,
+	gaps chan<- models.TradeGap,
+) *processor.GapDetector {
+	var opts []processor.GapOption
+	if cfg.Gaps.Backfill {
+		opts = append(opts, processor.WithBackfill(exchange.NewBinanceBackfill(client)))
+	}
+
+	detector := processor.NewGapDetector(processor.GapConfig{
+		Grace:       cfg.Gaps.Grace,
+		MaxBackfill: cfg.Gaps.MaxBackfill,
+	}, in, out, gaps, opts...)
+	go detector.Start(ctx)
+	return detector
+}
+
+// startValidator проверяет события перед агрегаторами; dead может быть nil
+func startValidator(
+	ctx context.Context,
+	in <-chan models.UniversalTrade,
+	out chan<- models.UniversalTrade,
+	dead *deadletter.Queue,
+) *validation.Validator {
+	actions := make(map[string]validation.Action, len(cfg.Validation.Actions))
+	quarantine := false
+	for rule, name := range cfg.Validation.Actions {
+		action, err := validation.ParseAction(name)
+		if err != nil {
+			slog.Error("Invalid validation action", "rule", rule, "error", err)
+			os.Exit(1)
+		}
+		actions[rule] = action
+		quarantine = quarantine || action == validation.ActionQuarantine
+	}
+
+	var opts []validation.Option
+	if dead != nil {
+		opts = append(opts, validation.WithDeadLetter(dead))
+	} else if quarantine {
+		slog.Warn("Validation quarantine needs deadletter.enabled, quarantined ticks are dropped")
+	}
+
+	validator := validation.NewValidator(validation.Config{
+		Actions:  actions,
+		MaxJump:  decimal.FromFloat(cfg.Validation.MaxJump, 8),
+		MaxSkew:  cfg.Validation.MaxSkew,
+		JumpKeep: cfg.Validation.JumpKeep,
+	}, in, out, opts...)
+	go validator.Start(ctx)
+
+	slog.Info("🧪 Validation enabled", "rules", cfg.Validation.Actions)
+	return validator
+}
+
+// startWindows строит свечи из сделок; с late_policy: side опоздавшие
+// сделки публикуются в Kafka или печатаются. hold (может быть nil) держит
+// watermark символов с незакрытыми пропусками
+func startWindows(
+	ctx context.Context,
+	in <-chan models.UniversalTrade,
+	out chan<- *models.Window,
+	hold aggregator.WatermarkHold,
+) *aggregator.WindowAggregator {
+	policy := aggregator.LatePolicy(strings.ToLower(cfg.Windows.LatePolicy))
+	switch policy {
+	case aggregator.LateDrop, aggregator.LateUpdate, aggregator.LateSide:
+	default:
+		slog.Error("Invalid windows.late_policy", "late_policy", cfg.Windows.LatePolicy)
+		os.Exit(1)
+	}
+
+	loc, err := aggregator.ParseTimezone(cfg.Windows.Timezone)
+	if err != nil {
+		slog.Error("Invalid windows.timezone", "error", err)
+		os.Exit(1)
+	}
+	intervals, err := aggregator.ParseIntervals(cfg.Windows.Intervals, loc)
+	if err != nil {
+		slog.Error("Invalid windows.intervals", "error", err)
+		os.Exit(1)
+	}
+	symbolIntervals := make(map[string][]aggregator.Interval, len(cfg.Windows.SymbolIntervals))
+	for symbol, names := range cfg.Windows.SymbolIntervals {
+		parsed, err := aggregator.ParseIntervals(names, loc)
+		if err != nil {
+			slog.Error("Invalid windows.symbol_intervals", "symbol", symbol, "error", err)
+			os.Exit(1)
+		}
+		symbolIntervals[strings.ToUpper(symbol)] = parsed
+	}
+
+	gapFillSymbols := make([]string, 0, len(cfg.Windows.GapFillSymbols))
+	for _, symbol := range cfg.Windows.GapFillSymbols {
+		gapFillSymbols = append(gapFillSymbols, strings.ToUpper(symbol))
+	}
+	if cfg.Windows.GapFill && cfg.Windows.IdleTimeout <= 0 {
+		slog.Warn("windows.gap_fill without idle_timeout: silent symbols are filled only on their next trade")
+	}
+
+	var opts []aggregator.WindowOption
+	if hold != nil {
+		opts = append(opts, aggregator.WithWatermarkHold(hold))
+	}
+	if policy == aggregator.LateSide {
+		late := make(chan models.UniversalTrade, 100)
+		opts = append(opts, aggregator.WithLateTrades(late))
+
+		if cfg.Kafka.Enabled {
+			startProducer(ctx, cfg.Kafka.LateTradesTopic, late, kafka.LateTradeRecord)
+		} else {
+			go func() {
+				for trade := range late {
+					fmt.Printf("⏰ LATE TRADE: %s | %s | Price: %s | Qty: %s\n",
+						trade.Symbol,
+						trade.Timestamp.UTC().Format(time.RFC3339Nano),
+						trade.Price,
+						trade.Quantity,
+					)
+				}
+			}()
+		}
+	}
+
+	windowAgg := aggregator.NewWindowAggregator(aggregator.WindowConfig{
+		Intervals:       intervals,
+		SymbolIntervals: symbolIntervals,
+		MaxDelay:        cfg.Windows.MaxDelay,
+		LatePolicy:      policy,
+		AllowedLateness: cfg.Windows.AllowedLateness,
+		IdleTimeout:     cfg.Windows.IdleTimeout,
+		GapFill:         cfg.Windows.GapFill,
+		GapFillSymbols:  gapFillSymbols,
+		MaxSilence:      cfg.Windows.MaxSilence,
+	}, in, out, opts...)
+	go windowAgg.Start(ctx)
+	return windowAgg
+}
@@ -11,7 +11,22 @@ import (
 type Config struct {
 	Env        string     `yaml:"env"         env-required:"true"`
 	LogLevel   string     `yaml:"log_level"                       env-default:"info"`
+	Exchange   string     `yaml:"exchange"                        env-default:"binance"`
 	HttpServer httpServer `yaml:"http_server"`
+	WebSocket  webSocket  `yaml:"websocket"`
+	Recorder   recorder   `yaml:"recorder"`
+	Replay     replay     `yaml:"replay"`
+	Reconcile  reconcile  `yaml:"reconcile"`
+	Windows    windows    `yaml:"windows"`
+	Book       book       `yaml:"book"`
+	Rest       rest       `yaml:"rest"`
+	OrderBook  orderBook  `yaml:"orderbook"`
+	Gaps       gaps       `yaml:"gaps"`
+	Processor  processor  `yaml:"processor"`
+	DeadLetter deadLetter `yaml:"deadletter"`
+	Validation validation `yaml:"validation"`
+	Metadata   metadata   `yaml:"metadata"`
+	Kafka      kafka      `yaml:"kafka"`
 }
 
 type httpServer struct {
@@ -20,6 +35,193 @@ type httpServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 }
 
+// webSocket описывает, что собирать: имена стримов в формате биржи из exchange
+// (binance: btcusdt@aggTrade, !miniTicker@arr; bybit: publicTrade.BTCUSDT;
+// okx: trades:BTC-USDT; coinbase: market_trades:BTC-USD).
+// BaseURL по умолчанию - адрес биржи, его можно направить на локальный
+// mockexchange (ws://localhost:9443).
+// Shards > 0 включает пул соединений: стримы раскладываются по нескольким
+// соединениям не больше MaxStreamsPerShard на каждое
+type webSocket struct {
+	BaseURL            string        `yaml:"base_url"`
+	Streams            []string      `yaml:"streams"               env-default:"!miniTicker@arr"`
+	ReconnectDelay     time.Duration `yaml:"reconnect_delay"       env-default:"5s"`
+	Shards             int           `yaml:"shards"`
+	MaxStreamsPerShard int           `yaml:"max_streams_per_shard" env-default:"200"`
+	RotateAfter        time.Duration `yaml:"rotate_after"          env-default:"23h30m"`
+	RotationOverlap    time.Duration `yaml:"rotation_overlap"      env-default:"10s"`
+	Watchdog           watchdog      `yaml:"watchdog"`
+}
+
+// watchdog: stream_silence задает, сколько может молчать стрим данного
+// типа (aggTrade, kline_1m, !miniTicker@arr, ...) прежде чем переподключиться
+type watchdog struct {
+	PingInterval  time.Duration            `yaml:"ping_interval" env-default:"15s"`
+	DeadAfter     time.Duration            `yaml:"dead_after"    env-default:"45s"`
+	StreamSilence map[string]time.Duration `yaml:"stream_silence"`
+}
+
+// recorder - запись сырых фреймов WebSocket на диск для последующего воспроизведения
+type recorder struct {
+	Enabled      bool   `yaml:"enabled"`
+	Dir          string `yaml:"dir"            env-default:"./recordings"`
+	MaxFileSize  int64  `yaml:"max_file_size"  env-default:"268435456"`
+	RotateHourly bool   `yaml:"rotate_hourly"  env-default:"true"`
+}
+
+// replay - вместо подключения к бирже воспроизвести записи recorder.
+// mode: fast | realtime | speed (speed - во сколько раз быстрее)
+type replay struct {
+	Enabled bool    `yaml:"enabled"`
+	Dir     string  `yaml:"dir"     env-default:"./recordings"`
+	Mode    string  `yaml:"mode"    env-default:"realtime"`
+	Speed   float64 `yaml:"speed"   env-default:"1"`
+}
+
+// reconcile - сверка наших свечей с закрытыми kline биржи.
+// Нужны стримы сделок и <symbol>@kline_<interval> тех же символов.
+// Допуски относительные: 0.0001 = 0.01%
+type reconcile struct {
+	Enabled         bool          `yaml:"enabled"`
+	PriceTolerance  float64       `yaml:"price_tolerance"  env-default:"0"`
+	VolumeTolerance float64       `yaml:"volume_tolerance" env-default:"0.001"`
+	MaxWait         time.Duration `yaml:"max_wait"         env-default:"1m"`
+}
+
+// windows - свечи из сделок (enabled; их же строит reconcile.enabled для
+// сверки). Выводятся в консоль или в kafka.candles_topic, исправленные
+// опоздавшими сделками - повторно с revision + 1.
+// Свечи строятся по времени сделок. Свеча закрывается,
+// когда время самой новой сделки символа минус max_delay проходит ее конец.
+// late_policy - сделки в уже закрытые свечи: drop | update (свеча принимает
+// их еще allowed_lateness и выпускается заново) | side (отдельный вывод);
+// с drop и side опоздавшая сделка не попадает ни в одну свечу.
+// idle_timeout: символ без сделок столько по времени других символов
+// закрывает свечи вместе с ними (0 - ждать своей сделки).
+// intervals - свечи в формате Binance (1s, 3m, 15m, 4h, 1d, 3d, 1w, 1M) с теми же
+// границами, что у kline биржи; symbol_intervals - свой набор для символа.
+// timezone - пояс границ дней, недель и месяцев: UTC, Asia/Shanghai, +08:00.
+// gap_fill - плоские свечи (OHLC - close предыдущей, объем 0, synthetic) за
+// периоды без сделок, только для gap_fill_symbols (пусто - все); молчащие
+// символы двигает idle_timeout, символ без сделок дольше max_silence
+// заполнять перестают (0 - без ограничения)
+type windows struct {
+	Enabled         bool                `yaml:"enabled"`
+	Intervals       []string            `yaml:"intervals"        env-default:"10s,1m,1h,1d"`
+	SymbolIntervals map[string][]string `yaml:"symbol_intervals"`
+	Timezone        string              `yaml:"timezone"         env-default:"UTC"`
+	MaxDelay        time.Duration       `yaml:"max_delay"        env-default:"2s"`
+	LatePolicy      string              `yaml:"late_policy"      env-default:"drop"`
+	AllowedLateness time.Duration       `yaml:"allowed_lateness" env-default:"1m"`
+	IdleTimeout     time.Duration       `yaml:"idle_timeout"     env-default:"10s"`
+	GapFill         bool                `yaml:"gap_fill"`
+	GapFillSymbols  []string            `yaml:"gap_fill_symbols"`
+	MaxSilence      time.Duration       `yaml:"max_silence"      env-default:"1h"`
+}
+
+// book - лучшие bid/ask из стримов <symbol>@bookTicker.
+// emit_interval: 0 - BookStat на каждое обновление, иначе последнее
+// состояние изменившихся символов раз в интервал
+type book struct {
+	EmitInterval time.Duration `yaml:"emit_interval" env-default:"1s"`
+}
+
+// rest - REST API Binance для снимков стакана. Пустой base_url - боевой API,
+// для mockexchange - http://localhost:9443
+type rest struct {
+	BaseURL string        `yaml:"base_url"`
+	Timeout time.Duration `yaml:"timeout"  env-default:"10s"`
+}
+
+// orderBook - локальные стаканы по стримам <symbol>@depth или <symbol>@depth@100ms
+// (только binance): top_levels лучших уровней, глубина в ±depth_percents% от mid
+// и дисбаланс по top_levels уровням
+type orderBook struct {
+	Enabled       bool          `yaml:"enabled"`
+	SnapshotLimit int           `yaml:"snapshot_limit" env-default:"1000"`
+	TopLevels     int           `yaml:"top_levels"     env-default:"10"`
+	DepthPercents []float64     `yaml:"depth_percents" env-default:"0.5,1,2"`
+	EmitInterval  time.Duration `yaml:"emit_interval"  env-default:"1s"`
+	ResyncDelay   time.Duration `yaml:"resync_delay"   env-default:"1s"`
+}
+
+// metadata - exchangeInfo биржи: base/quote (пара BASE/QUOTE в событиях
+// и DailyStat), точность цены и объема по tickSize/stepSize; события
+// символов не в статусе TRADING отбрасываются; цены и объемы точнее шага
+// не округляются, а считаются (сводка при остановке). Источник - file
+// (exchangeInfo выбранной биржи в формате ответа /api/v3/exchangeInfo) или,
+// если file пуст, REST rest.base_url - только для binance, у других бирж
+// без file метаданные выключены
+type metadata struct {
+	Enabled         bool          `yaml:"enabled"`
+	File            string        `yaml:"file"`
+	RefreshInterval time.Duration `yaml:"refresh_interval" env-default:"1h"`
+}
+
+// processor: workers - сколько сообщений разбирается параллельно.
+// Сообщения одного стрима всегда разбираются одним воркером по порядку
+type processor struct {
+	Workers int `yaml:"workers" env-default:"10"`
+}
+
+// gaps - поиск пропусков в aggTrade ID. Скачок ID, не заполненный за grace,
+// считается пропуском; backfill догружает пропущенное по REST (только binance,
+// адрес из rest.base_url), если пропущено не больше max_backfill сделок.
+// Пока пропуск не закрыт (grace и догрузка), свечи символа не закрываются:
+// догруженные сделки не опаздывают в них при любом windows.max_delay
+type gaps struct {
+	Enabled     bool          `yaml:"enabled"`
+	Grace       time.Duration `yaml:"grace"        env-default:"2s"`
+	Backfill    bool          `yaml:"backfill"`
+	MaxBackfill int64         `yaml:"max_backfill" env-default:"10000"`
+}
+
+// deadLetter - сообщения, которые не удалось разобрать: сырой payload,
+// этап и ошибка. sinks: file (JSONL в dir) и/или kafka (топик
+// kafka.deadletter_topic, нужен kafka.enabled). Payload обрезается до max_payload байт,
+// сводка счетчиков по причинам пишется в лог раз в report_interval
+type deadLetter struct {
+	Enabled        bool          `yaml:"enabled"`
+	Sinks          []string      `yaml:"sinks"           env-default:"file"`
+	QueueSize      int           `yaml:"queue_size"      env-default:"10000"`
+	Dir            string        `yaml:"dir"             env-default:"./deadletters"`
+	MaxFileSize    int64         `yaml:"max_file_size"   env-default:"67108864"`
+	MaxPayload     int           `yaml:"max_payload"     env-default:"65536"`
+	ReportInterval time.Duration `yaml:"report_interval" env-default:"1m"`
+}
+
+// validation - проверка событий перед агрегаторами. actions - действие
+// по правилу: off | flag | drop | quarantine (в dead letters, нужен
+// deadletter.enabled). Правила: bounds (цены > 0, объемы >= 0), ohlc
+// (low <= open, close <= high), jump (изменение к последней цене больше max_jump;
+// после jump_keep скачков подряд новый уровень принимается), clock_skew
+// (время события опережает наши часы больше чем на max_skew)
+type validation struct {
+	Enabled  bool              `yaml:"enabled"`
+	Actions  map[string]string `yaml:"actions"   env-default:"bounds:drop,ohlc:drop,jump:quarantine,clock_skew:flag"`
+	MaxJump  float64           `yaml:"max_jump"  env-default:"0.5"`
+	MaxSkew  time.Duration     `yaml:"max_skew"  env-default:"5s"`
+	JumpKeep int               `yaml:"jump_keep" env-default:"3"`
+}
+
+// kafka - публикация DailyStat, BookStat, OrderBookStat, пропусков сделок, dead letters
+// и опоздавших сделок (windows.late_policy: side); вместо вывода в консоль
+type kafka struct {
+	Enabled         bool          `yaml:"enabled"`
+	Brokers         []string      `yaml:"brokers"           env-default:"localhost:9092"`
+	DailyStatsTopic string        `yaml:"daily_stats_topic" env-default:"daily-stats"`
+	BookStatsTopic  string        `yaml:"book_stats_topic"  env-default:"book-stats"`
+	OrderBookTopic  string        `yaml:"orderbook_topic"   env-default:"orderbook"`
+	GapsTopic       string        `yaml:"gaps_topic"        env-default:"trade-gaps"`
+	DeadLetterTopic string        `yaml:"deadletter_topic"  env-default:"dead-letters"`
+	LateTradesTopic string        `yaml:"late_trades_topic" env-default:"late-trades"`
+	CandlesTopic    string        `yaml:"candles_topic"     env-default:"candles"`
+	BatchSize       int           `yaml:"batch_size"        env-default:"100"`
+	BatchTimeout    time.Duration `yaml:"batch_timeout"     env-default:"1s"`
+	MaxAttempts     int           `yaml:"max_attempts"      env-default:"3"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"     env-default:"10s"`
+}
+
 func MustLoad() *Config {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
@@ -0,0 +1,157 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+type bookKey struct {
+	exchange string
+	symbol   string
+}
+
+// BookProcessor держит в памяти лучшие bid/ask по каждому символу
+// и выпускает BookStat со спредом, mid и microprice
+type BookProcessor struct {
+	inputChan          <-chan models.UniversalTrade
+	outputChanBookStat chan<- *models.BookStat
+
+	// emitInterval > 0 - выпускать не каждое обновление, а последнее
+	// состояние изменившихся символов раз в интервал
+	emitInterval time.Duration
+
+	mu    sync.RWMutex
+	books map[bookKey]*models.BookStat
+	dirty map[bookKey]struct{}
+}
+
+// NewBookProcessor creates a new BookProcessor.
+func NewBookProcessor(
+	inChan <-chan models.UniversalTrade,
+	outBookStat chan<- *models.BookStat,
+	emitInterval time.Duration,
+) *BookProcessor {
+	return &BookProcessor{
+		inputChan:          inChan,
+		outputChanBookStat: outBookStat,
+		emitInterval:       emitInterval,
+		books:              make(map[bookKey]*models.BookStat),
+		dirty:              make(map[bookKey]struct{}),
+	}
+}
+
+func (bp *BookProcessor) Start(ctx context.Context) {
+	if bp.emitInterval > 0 {
+		go bp.periodicEmitter(ctx)
+	}
+	go bp.processIncoming(ctx)
+}
+
+// Best возвращает текущие лучшие цены символа
+func (bp *BookProcessor) Best(exchange, symbol string) (models.BookStat, bool) {
+	bp.mu.RLock()
+	defer bp.mu.RUnlock()
+
+	book, ok := bp.books[bookKey{exchange: exchange, symbol: symbol}]
+	if !ok {
+		return models.BookStat{}, false
+	}
+	return *book, true
+}
+
+func (bp *BookProcessor) processIncoming(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case trade, ok := <-bp.inputChan:
+			if !ok {
+				return
+			}
+			if trade.EventType == websocket.BookTicker {
+				bp.processBookTicker(ctx, trade)
+			}
+		}
+	}
+}
+
+func (bp *BookProcessor) processBookTicker(ctx context.Context, trade models.UniversalTrade) {
+	if trade.BidPrice.IsZero() || trade.AskPrice.IsZero() {
+		return
+	}
+	// Перекрестный стакан - ошибка данных, спред по нему отрицательный
+	if trade.BidPrice.GreaterThan(trade.AskPrice) {
+		slog.Debug("Crossed book ignored",
+			"symbol", trade.Symbol,
+			"bid", trade.BidPrice,
+			"ask", trade.AskPrice)
+		return
+	}
+
+	key := bookKey{exchange: trade.Exchange, symbol: trade.Symbol}
+	stat := &models.BookStat{
+		Exchange:  trade.Exchange,
+		Symbol:    trade.Symbol,
+		BidPrice:  trade.BidPrice,
+		BidQty:    trade.BidQty,
+		AskPrice:  trade.AskPrice,
+		AskQty:    trade.AskQty,
+		UpdateID:  trade.UpdateID,
+		Timestamp: trade.Timestamp,
+	}
+
+	bp.mu.Lock()
+	// После переподключения обновления могут прийти повторно - старые пропускаем
+	if prev, ok := bp.books[key]; ok && trade.UpdateID != 0 && trade.UpdateID <= prev.UpdateID {
+		bp.mu.Unlock()
+		return
+	}
+	bp.books[key] = stat
+	if bp.emitInterval > 0 {
+		bp.dirty[key] = struct{}{}
+	}
+	bp.mu.Unlock()
+
+	if bp.emitInterval == 0 {
+		out := *stat
+		select {
+		case bp.outputChanBookStat <- &out:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// periodicEmitter раз в emitInterval выпускает символы, у которых менялись цены
+func (bp *BookProcessor) periodicEmitter(ctx context.Context) {
+	ticker := time.NewTicker(bp.emitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bp.mu.Lock()
+			stats := make([]*models.BookStat, 0, len(bp.dirty))
+			for key := range bp.dirty {
+				out := *bp.books[key]
+				stats = append(stats, &out)
+			}
+			clear(bp.dirty)
+			bp.mu.Unlock()
+
+			for _, stat := range stats {
+				select {
+				case bp.outputChanBookStat <- stat:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
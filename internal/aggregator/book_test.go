@@ -0,0 +1,76 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+func TestBookStat(t *testing.T) {
+	tests := []struct {
+		name                     string
+		bid, bidQty, ask, askQty string
+		// пусто - обновление отброшено
+		spread, bps, mid, micro string
+	}{
+		{name: "skewed sizes", bid: "100", bidQty: "1", ask: "101", askQty: "3",
+			spread: "1", bps: "99.50", mid: "100.5", micro: "100.25"},
+		{name: "equal sizes", bid: "100.00", bidQty: "2", ask: "100.01", askQty: "2",
+			spread: "0.01", bps: "1.00", mid: "100.005", micro: "100.005"},
+		// Пустая сторона тянет microprice к себе целиком
+		{name: "empty bid size", bid: "100", bidQty: "0", ask: "102", askQty: "5",
+			spread: "2", bps: "198.02", mid: "101", micro: "100"},
+		// Объемов нет совсем - microprice равен mid
+		{name: "zero sizes", bid: "100", bidQty: "0", ask: "102", askQty: "0",
+			spread: "2", bps: "198.02", mid: "101", micro: "101"},
+		{name: "locked book", bid: "100", bidQty: "1", ask: "100", askQty: "1",
+			spread: "0", bps: "0", mid: "100", micro: "100"},
+		{name: "crossed book", bid: "101", bidQty: "1", ask: "100", askQty: "1"},
+		{name: "zero bid", bid: "0", bidQty: "1", ask: "100", askQty: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := make(chan *models.BookStat, 1)
+			bp := NewBookProcessor(nil, out, 0)
+			bp.processBookTicker(context.Background(), models.UniversalTrade{
+				Exchange:  "binance",
+				Symbol:    "BTCUSDT",
+				EventType: websocket.BookTicker,
+				BidPrice:  decimal.MustParse(tt.bid),
+				BidQty:    decimal.MustParse(tt.bidQty),
+				AskPrice:  decimal.MustParse(tt.ask),
+				AskQty:    decimal.MustParse(tt.askQty),
+			})
+
+			_, ok := bp.Best("binance", "BTCUSDT")
+			if tt.spread == "" {
+				if ok || len(out) > 0 {
+					t.Errorf("bid %s ask %s accepted, want ignored", tt.bid, tt.ask)
+				}
+				return
+			}
+			if !ok || len(out) != 1 {
+				t.Fatalf("bid %s ask %s ignored", tt.bid, tt.ask)
+			}
+
+			stat := <-out
+			for _, v := range []struct {
+				field     string
+				got, want decimal.Decimal
+			}{
+				{"spread", stat.Spread(), decimal.MustParse(tt.spread)},
+				{"spread bps", stat.SpreadBps(), decimal.MustParse(tt.bps)},
+				{"mid", stat.MidPrice(), decimal.MustParse(tt.mid)},
+				{"microprice", stat.MicroPrice(), decimal.MustParse(tt.micro)},
+			} {
+				if !v.got.Equal(v.want) {
+					t.Errorf("%s = %s, want %s", v.field, v.got, v.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package aggregator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIntervals - свечи, которые строятся, если интервалы не заданы
+var DefaultIntervals = []string{"10s", "1m", "1h", "1d"}
+
+// epochMonday - номер дня первого понедельника эпохи Unix (1970-01-05):
+// недельные свечи Binance начинаются с понедельника
+const epochMonday = 4
+
+// Interval - длительность свечи в формате Binance: 1s, 3m, 15m, 4h, 1d, 3d, 1w, 1M.
+// Границы - как у kline Binance: секунды, минуты, часы и дни отсчитываются
+// от начала эпохи Unix, недели - с понедельника, месяцы - с первого числа.
+// Все границы - в часовом поясе интервала (у Binance по умолчанию UTC)
+type Interval struct {
+	n    int
+	unit byte // 's', 'm', 'h', 'd', 'w', 'M'
+	loc  *time.Location
+}
+
+// ParseInterval разбирает интервал; loc == nil - UTC
+func ParseInterval(s string, loc *time.Location) (Interval, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return Interval{}, fmt.Errorf("invalid interval %q", s)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	unit := s[len(s)-1]
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return Interval{}, fmt.Errorf("invalid interval %q", s)
+	}
+
+	iv := Interval{n: n, unit: unit, loc: loc}
+	switch unit {
+	case 's', 'm', 'h':
+		// Свечи внутри дня должны укладываться в сутки целиком, как у Binance
+		if (24*time.Hour)%iv.fixed() != 0 {
+			return Interval{}, fmt.Errorf("interval %q does not divide a day", s)
+		}
+	case 'd', 'w', 'M':
+	default:
+		return Interval{}, fmt.Errorf("unknown interval unit in %q", s)
+	}
+	return iv, nil
+}
+
+// ParseIntervals разбирает список интервалов, повторы отбрасываются
+func ParseIntervals(names []string, loc *time.Location) ([]Interval, error) {
+	intervals := make([]Interval, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		iv, err := ParseInterval(name, loc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[iv.String()]; ok {
+			continue
+		}
+		seen[iv.String()] = struct{}{}
+		intervals = append(intervals, iv)
+	}
+	return intervals, nil
+}
+
+// ParseTimezone - часовой пояс границ свечей: "UTC", "Asia/Shanghai"
+// или смещение, как параметр timeZone у Binance: "+08:00", "-5", "+5:30"
+func ParseTimezone(s string) (*time.Location, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "UTC") {
+		return time.UTC, nil
+	}
+	if s[0] != '+' && s[0] != '-' {
+		return time.LoadLocation(s)
+	}
+
+	hours, minutes, _ := strings.Cut(s[1:], ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h > 14 {
+		return nil, fmt.Errorf("invalid timezone offset %q", s)
+	}
+	m := 0
+	if minutes != "" {
+		if m, err = strconv.Atoi(minutes); err != nil || m >= 60 {
+			return nil, fmt.Errorf("invalid timezone offset %q", s)
+		}
+	}
+
+	offset := h*3600 + m*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("UTC"+s, offset), nil
+}
+
+// String - имя интервала, как у kline Binance
+func (iv Interval) String() string {
+	return strconv.Itoa(iv.n) + string(iv.unit)
+}
+
+// Start - начало свечи, в которую попадает t
+func (iv Interval) Start(t time.Time) time.Time {
+	t = t.In(iv.loc)
+
+	switch iv.unit {
+	case 'd':
+		days := civilDays(t)
+		return dayStart(days-mod(days, int64(iv.n)), iv.loc)
+	case 'w':
+		days := civilDays(t)
+		return dayStart(days-mod(days-epochMonday, int64(7*iv.n)), iv.loc)
+	case 'M':
+		months := int64(t.Year())*12 + int64(t.Month()) - 1
+		months -= mod(months, int64(iv.n))
+		return time.Date(int(months/12), time.Month(months%12+1), 1, 0, 0, 0, 0, iv.loc)
+	}
+
+	// Внутри дня - от эпохи по местному времени: с поясом +05:30 часовые
+	// свечи начинаются в :30 UTC
+	_, offset := t.Zone()
+	local := t.UnixMilli() + int64(offset)*1000
+	local -= mod(local, iv.fixed().Milliseconds())
+	return time.UnixMilli(local - int64(offset)*1000).In(iv.loc)
+}
+
+// End - конец свечи, которая начинается в start (не включительно)
+func (iv Interval) End(start time.Time) time.Time {
+	start = start.In(iv.loc)
+
+	switch iv.unit {
+	case 'd':
+		return start.AddDate(0, 0, iv.n)
+	case 'w':
+		return start.AddDate(0, 0, 7*iv.n)
+	case 'M':
+		return start.AddDate(0, iv.n, 0)
+	}
+	return start.Add(iv.fixed())
+}
+
+// Duration - примерная длительность (месяц - 30 дней), для сравнения интервалов
+func (iv Interval) Duration() time.Duration {
+	switch iv.unit {
+	case 'd':
+		return time.Duration(iv.n) * 24 * time.Hour
+	case 'w':
+		return time.Duration(iv.n) * 7 * 24 * time.Hour
+	case 'M':
+		return time.Duration(iv.n) * 30 * 24 * time.Hour
+	}
+	return iv.fixed()
+}
+
+// fixed - точная длительность интервала внутри дня
+func (iv Interval) fixed() time.Duration {
+	switch iv.unit {
+	case 's':
+		return time.Duration(iv.n) * time.Second
+	case 'm':
+		return time.Duration(iv.n) * time.Minute
+	case 'h':
+		return time.Duration(iv.n) * time.Hour
+	}
+	return 0
+}
+
+// civilDays - номер календарного дня t (в его поясе) от 1970-01-01
+func civilDays(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+func dayStart(days int64, loc *time.Location) time.Time {
+	y, m, d := time.Unix(days*86400, 0).UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// mod - остаток, неотрицательный и для отрицательных a
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalStartEnd(t *testing.T) {
+	tests := []struct {
+		interval string
+		tz       string
+		at       string
+		start    string
+		end      string
+	}{
+		{"1s", "UTC", "2024-01-01T00:00:00.999Z", "2024-01-01T00:00:00Z", "2024-01-01T00:00:01Z"},
+		{"15m", "UTC", "2024-01-01T10:44:59Z", "2024-01-01T10:30:00Z", "2024-01-01T10:45:00Z"},
+		{"4h", "UTC", "2024-03-10T03:59:59Z", "2024-03-10T00:00:00Z", "2024-03-10T04:00:00Z"},
+		{"1d", "UTC", "2024-02-29T23:59:59Z", "2024-02-29T00:00:00Z", "2024-03-01T00:00:00Z"},
+		// До эпохи остаток отрицательный
+		{"1d", "UTC", "1969-12-31T23:00:00Z", "1969-12-31T00:00:00Z", "1970-01-01T00:00:00Z"},
+		// 3d - от 1970-01-01, как у Binance
+		{"3d", "UTC", "2024-01-01T12:00:00Z", "2023-12-31T00:00:00Z", "2024-01-03T00:00:00Z"},
+
+		// Недели - с понедельника
+		{"1w", "UTC", "2024-01-07T23:59:59Z", "2024-01-01T00:00:00Z", "2024-01-08T00:00:00Z"},
+		{"1w", "UTC", "2024-01-08T00:00:00Z", "2024-01-08T00:00:00Z", "2024-01-15T00:00:00Z"},
+		{"1w", "UTC", "2025-01-01T00:00:00Z", "2024-12-30T00:00:00Z", "2025-01-06T00:00:00Z"},
+
+		// Месяцы - с первого числа, разной длины
+		{"1M", "UTC", "2024-02-29T12:00:00Z", "2024-02-01T00:00:00Z", "2024-03-01T00:00:00Z"},
+		{"1M", "UTC", "2023-12-31T23:59:59Z", "2023-12-01T00:00:00Z", "2024-01-01T00:00:00Z"},
+		{"1M", "UTC", "2024-01-31T00:00:00Z", "2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"},
+		{"3M", "UTC", "2024-05-15T00:00:00Z", "2024-04-01T00:00:00Z", "2024-07-01T00:00:00Z"},
+
+		// Границы - в поясе интервала
+		{"1d", "+08:00", "2024-01-01T15:59:59Z", "2023-12-31T16:00:00Z", "2024-01-01T16:00:00Z"},
+		{"1d", "+08:00", "2024-01-01T16:00:00Z", "2024-01-01T16:00:00Z", "2024-01-02T16:00:00Z"},
+		{"1h", "+5:30", "2024-01-01T10:29:59Z", "2024-01-01T09:30:00Z", "2024-01-01T10:30:00Z"},
+		{"4h", "-5", "2024-01-01T04:59:59Z", "2024-01-01T01:00:00Z", "2024-01-01T05:00:00Z"},
+		{"1w", "+08:00", "2024-01-07T16:30:00Z", "2024-01-07T16:00:00Z", "2024-01-14T16:00:00Z"},
+		{"1M", "+08:00", "2024-01-31T17:00:00Z", "2024-01-31T16:00:00Z", "2024-02-29T16:00:00Z"},
+		{"1M", "-5", "2024-03-01T04:00:00Z", "2024-02-01T05:00:00Z", "2024-03-01T05:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		loc, err := ParseTimezone(tt.tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, err := ParseInterval(tt.interval, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at := mustTime(t, tt.at)
+		start := iv.Start(at)
+		if want := mustTime(t, tt.start); !start.Equal(want) {
+			t.Errorf("%s %s Start(%s) = %s, want %s", tt.interval, tt.tz, tt.at, start.UTC(), want)
+		}
+		if end, want := iv.End(start), mustTime(t, tt.end); !end.Equal(want) {
+			t.Errorf("%s %s End(%s) = %s, want %s", tt.interval, tt.tz, tt.start, end.UTC(), want)
+		}
+	}
+}
+
+// Переход на летнее время: сутки короче, часы считаются по местному времени
+func TestIntervalDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+
+	day, _ := ParseInterval("1d", loc)
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, loc)
+	start, end := day.Start(at), day.End(day.Start(at))
+	if want := time.Date(2024, 3, 10, 0, 0, 0, 0, loc); !start.Equal(want) {
+		t.Errorf("1d Start = %s, want %s", start, want)
+	}
+	if d := end.Sub(start); d != 23*time.Hour {
+		t.Errorf("1d on DST day lasts %s, want 23h", d)
+	}
+
+	hour, _ := ParseInterval("1h", loc)
+	at = time.Date(2024, 3, 10, 3, 30, 0, 0, loc)
+	if want := time.Date(2024, 3, 10, 3, 0, 0, 0, loc); !hour.Start(at).Equal(want) {
+		t.Errorf("1h Start = %s, want %s", hour.Start(at), want)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for _, s := range []string{"1s", "3m", "15m", "4h", "12h", "1d", "3d", "1w", "1M"} {
+		iv, err := ParseInterval(s, nil)
+		if err != nil || iv.String() != s {
+			t.Errorf("ParseInterval(%q) = %v, %v", s, iv, err)
+		}
+	}
+	// 7m и 5h не делят сутки, у Binance таких нет
+	for _, s := range []string{"", "m", "0m", "-1m", "7m", "5h", "1y", "1.5h"} {
+		if _, err := ParseInterval(s, nil); err == nil {
+			t.Errorf("ParseInterval(%q) succeeded", s)
+		}
+	}
+
+	intervals, err := ParseIntervals([]string{"1m", "1h", "1m"}, nil)
+	if err != nil || len(intervals) != 2 {
+		t.Errorf("ParseIntervals with a repeat = %v, %v", intervals, err)
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	for in, offset := range map[string]int{
+		"":       0,
+		"UTC":    0,
+		"+08:00": 8 * 3600,
+		"-5":     -5 * 3600,
+		"+5:30":  5*3600 + 30*60,
+	} {
+		loc, err := ParseTimezone(in)
+		if err != nil {
+			t.Errorf("ParseTimezone(%q) error = %v", in, err)
+			continue
+		}
+		if _, got := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); got != offset {
+			t.Errorf("ParseTimezone(%q) offset = %d, want %d", in, got, offset)
+		}
+	}
+	for _, in := range []string{"+15", "+5:60", "+x", "Mars/Olympus"} {
+		if _, err := ParseTimezone(in); err == nil {
+			t.Errorf("ParseTimezone(%q) succeeded", in)
+		}
+	}
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
@@ -38,13 +38,16 @@ func (mp *MetricsProcessor) processIncoming() {
 
 func (mp *MetricsProcessor) processMiniTicker(trade models.UniversalTrade) {
 	// Проверяем, что у нас есть данные miniTicker
-	if trade.OpenPrice == 0 && trade.HighPrice == 0 && trade.LowPrice == 0 {
+	if trade.OpenPrice.IsZero() && trade.HighPrice.IsZero() && trade.LowPrice.IsZero() {
 		slog.Warn("Received miniTicker with empty OHLC data", "symbol", trade.Symbol)
 		return
 	}
 
 	stat := &models.DailyStat{
 		Symbol:      trade.Symbol,
+		Pair:        trade.Pair,
+		Base:        trade.Base,
+		Quote:       trade.Quote,
 		OpenPrice:   trade.OpenPrice,
 		HighPrice:   trade.HighPrice,
 		LowPrice:    trade.LowPrice,
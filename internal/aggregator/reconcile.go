@@ -0,0 +1,297 @@
+package aggregator
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// diffScale - точность относительного расхождения
+const diffScale = 10
+
+// DiscrepancyKind - что не сошлось
+type DiscrepancyKind string
+
+const (
+	// OHLCV нашей свечи расходится с kline биржи больше допуска
+	DiscrepancyMismatch DiscrepancyKind = "mismatch"
+	// Биржа закрыла свечу, а наш агрегатор ее не выпустил
+	DiscrepancyMissingWindow DiscrepancyKind = "missing_window"
+	// Мы выпустили свечу, а биржа по этому символу и интервалу ее не прислала
+	DiscrepancyMissingKline DiscrepancyKind = "missing_kline"
+)
+
+// ReconcileConfig - допуски задаются относительными: 0.0001 = 0.01%
+type ReconcileConfig struct {
+	PriceTolerance  decimal.Decimal
+	VolumeTolerance decimal.Decimal
+	// MaxWait - сколько ждать вторую половину пары, прежде чем считать ее пропущенной
+	MaxWait time.Duration
+}
+
+// FieldDiff - расхождение одного поля свечи
+type FieldDiff struct {
+	Field    string // open, high, low, close, volume
+	Ours     decimal.Decimal
+	Exchange decimal.Decimal
+	Relative decimal.Decimal // |ours - exchange| / |exchange|
+}
+
+// Discrepancy - результат сверки одной свечи
+type Discrepancy struct {
+	Symbol    string
+	Interval  string
+	StartTime time.Time
+	Kind      DiscrepancyKind
+	Fields    []FieldDiff // только для mismatch
+}
+
+// ReconcileStats - счетчики сверки
+type ReconcileStats struct {
+	Matched       int64
+	Mismatched    int64
+	MissingWindow int64
+	MissingKline  int64
+}
+
+type candleKey struct {
+	symbol   string
+	interval string
+	start    int64 // unix ms
+}
+
+type seriesKey struct {
+	symbol   string
+	interval string
+}
+
+// candlePair - наша свеча и kline биржи за один и тот же период
+type candlePair struct {
+	window  *models.Window
+	kline   *models.UniversalTrade
+	arrived time.Time
+}
+
+// Reconciler сравнивает закрытые биржей kline (x=true) со свечами,
+// которые выпустил WindowAggregator, по символу, интервалу и началу свечи
+type Reconciler struct {
+	cfg ReconcileConfig
+
+	windowsChan <-chan *models.Window
+	klinesChan  <-chan models.UniversalTrade
+	outputChan  chan<- Discrepancy
+
+	mu      sync.Mutex
+	pending map[candleKey]*candlePair
+	// серии, по которым приходят kline: только по ним есть с чем сверять
+	klineSeries map[seriesKey]struct{}
+	stats       ReconcileStats
+}
+
+func NewReconciler(
+	cfg ReconcileConfig,
+	windows <-chan *models.Window,
+	klines <-chan models.UniversalTrade,
+	out chan<- Discrepancy,
+) *Reconciler {
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = time.Minute
+	}
+
+	return &Reconciler{
+		cfg:         cfg,
+		windowsChan: windows,
+		klinesChan:  klines,
+		outputChan:  out,
+		pending:     make(map[candleKey]*candlePair),
+		klineSeries: make(map[seriesKey]struct{}),
+	}
+}
+
+func (r *Reconciler) Start(ctx context.Context) {
+	sweep := time.NewTicker(time.Second)
+	defer sweep.Stop()
+
+	windows, klines := r.windowsChan, r.klinesChan
+
+	for windows != nil || klines != nil {
+		select {
+		case <-ctx.Done():
+			return
+
+		case w, ok := <-windows:
+			if !ok {
+				windows = nil
+				continue
+			}
+			r.addWindow(ctx, w)
+
+		case k, ok := <-klines:
+			if !ok {
+				klines = nil
+				continue
+			}
+			r.addKline(ctx, k)
+
+		case now := <-sweep.C:
+			r.expire(ctx, now)
+		}
+	}
+}
+
+// Stats возвращает счетчики сверки
+func (r *Reconciler) Stats() ReconcileStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *Reconciler) addWindow(ctx context.Context, w *models.Window) {
+	// Исправления опоздавшими сделками не сверяем: пара уже сверена по первому выпуску
+	if w.Revision > 0 {
+		return
+	}
+	snapshot := w.Snapshot()
+
+	key := candleKey{symbol: snapshot.Symbol, interval: snapshot.Interval, start: snapshot.StartTime.UnixMilli()}
+	r.match(ctx, key, func(p *candlePair) { p.window = snapshot })
+}
+
+func (r *Reconciler) addKline(ctx context.Context, k models.UniversalTrade) {
+	// Незакрытая свеча еще меняется - сверять нечего
+	if !k.Closed {
+		return
+	}
+
+	r.mu.Lock()
+	r.klineSeries[seriesKey{symbol: k.Symbol, interval: k.Interval}] = struct{}{}
+	r.mu.Unlock()
+
+	key := candleKey{symbol: k.Symbol, interval: k.Interval, start: k.OpenTime.UnixMilli()}
+	r.match(ctx, key, func(p *candlePair) { p.kline = &k })
+}
+
+// match кладет половину пары и сверяет, если вторая уже есть
+func (r *Reconciler) match(ctx context.Context, key candleKey, set func(*candlePair)) {
+	r.mu.Lock()
+	p, ok := r.pending[key]
+	if !ok {
+		p = &candlePair{arrived: time.Now()}
+		r.pending[key] = p
+	}
+	set(p)
+
+	if p.window == nil || p.kline == nil {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.pending, key)
+
+	fields := r.compare(p.window, p.kline)
+	if len(fields) == 0 {
+		r.stats.Matched++
+		r.mu.Unlock()
+		return
+	}
+	r.stats.Mismatched++
+	r.mu.Unlock()
+
+	r.report(ctx, Discrepancy{
+		Symbol:    key.symbol,
+		Interval:  key.interval,
+		StartTime: time.UnixMilli(key.start),
+		Kind:      DiscrepancyMismatch,
+		Fields:    fields,
+	})
+}
+
+func (r *Reconciler) compare(w *models.Window, k *models.UniversalTrade) []FieldDiff {
+	var fields []FieldDiff
+
+	check := func(field string, ours, exchange, tolerance decimal.Decimal) {
+		rel := relativeDiff(ours, exchange)
+		if rel.GreaterThan(tolerance) {
+			fields = append(fields, FieldDiff{Field: field, Ours: ours, Exchange: exchange, Relative: rel})
+		}
+	}
+
+	check("open", w.Open, k.OpenPrice, r.cfg.PriceTolerance)
+	check("high", w.High, k.HighPrice, r.cfg.PriceTolerance)
+	check("low", w.Low, k.LowPrice, r.cfg.PriceTolerance)
+	check("close", w.Close, k.Price, r.cfg.PriceTolerance)
+	check("volume", w.Quantity, k.Volume, r.cfg.VolumeTolerance)
+
+	return fields
+}
+
+// expire сообщает о парах, которые так и не собрались за MaxWait.
+// Свеча без kline - пропуск, только если kline этой серии вообще приходят
+// (на интервал 10s у биржи kline нет)
+func (r *Reconciler) expire(ctx context.Context, now time.Time) {
+	var missing []Discrepancy
+
+	r.mu.Lock()
+	for key, p := range r.pending {
+		if now.Sub(p.arrived) < r.cfg.MaxWait {
+			continue
+		}
+		delete(r.pending, key)
+
+		d := Discrepancy{Symbol: key.symbol, Interval: key.interval, StartTime: time.UnixMilli(key.start)}
+		switch {
+		case p.window == nil:
+			d.Kind = DiscrepancyMissingWindow
+			r.stats.MissingWindow++
+		default:
+			if _, ok := r.klineSeries[seriesKey{symbol: key.symbol, interval: key.interval}]; !ok {
+				continue
+			}
+			d.Kind = DiscrepancyMissingKline
+			r.stats.MissingKline++
+		}
+		missing = append(missing, d)
+	}
+	r.mu.Unlock()
+
+	for _, d := range missing {
+		r.report(ctx, d)
+	}
+}
+
+func (r *Reconciler) report(ctx context.Context, d Discrepancy) {
+	attrs := []any{
+		"symbol", d.Symbol,
+		"interval", d.Interval,
+		"start", d.StartTime.UTC().Format(time.RFC3339),
+		"kind", d.Kind,
+	}
+	for _, f := range d.Fields {
+		attrs = append(attrs, f.Field, f.Ours.String()+" vs "+f.Exchange.String())
+	}
+	slog.Warn("⚖️ Candle does not match exchange kline", attrs...)
+
+	if r.outputChan == nil {
+		return
+	}
+	select {
+	case r.outputChan <- d:
+	case <-ctx.Done():
+	}
+}
+
+// relativeDiff - |ours - exchange| / |exchange|; при нулевом значении биржи
+// любое ненулевое расхождение считается полным (1)
+func relativeDiff(ours, exchange decimal.Decimal) decimal.Decimal {
+	diff := ours.Sub(exchange).Abs()
+	if diff.IsZero() {
+		return decimal.Zero
+	}
+	if exchange.IsZero() {
+		return decimal.FromInt(1)
+	}
+	return diff.Div(exchange.Abs(), diffScale)
+}
@@ -0,0 +1,176 @@
+package aggregator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+const testMaxWait = time.Minute
+
+// testReconciler - сверка без горутины Start: половины пар подаются
+// напрямую, expire вызывается с явным now
+type testReconciler struct {
+	r   *Reconciler
+	out chan Discrepancy
+}
+
+func newTestReconciler() *testReconciler {
+	out := make(chan Discrepancy, 100)
+	r := NewReconciler(ReconcileConfig{
+		PriceTolerance:  decimal.MustParse("0.0001"),
+		VolumeTolerance: decimal.MustParse("0.001"),
+		MaxWait:         testMaxWait,
+	}, nil, nil, out)
+	return &testReconciler{r: r, out: out}
+}
+
+// window - наша свеча через at после testStart; ohlcv - open, high, low, close, volume
+func (tr *testReconciler) window(symbol, interval string, at time.Duration, revision int, ohlcv ...string) {
+	tr.r.addWindow(context.Background(), &models.Window{
+		Symbol:    symbol,
+		Interval:  interval,
+		StartTime: testStart.Add(at),
+		Revision:  revision,
+		Open:      decimal.MustParse(ohlcv[0]),
+		High:      decimal.MustParse(ohlcv[1]),
+		Low:       decimal.MustParse(ohlcv[2]),
+		Close:     decimal.MustParse(ohlcv[3]),
+		Quantity:  decimal.MustParse(ohlcv[4]),
+	})
+}
+
+// kline - закрытая kline биржи через at после testStart
+func (tr *testReconciler) kline(symbol, interval string, at time.Duration, ohlcv ...string) {
+	tr.r.addKline(context.Background(), models.UniversalTrade{
+		Symbol:    symbol,
+		EventType: "kline",
+		Interval:  interval,
+		OpenTime:  testStart.Add(at),
+		Closed:    true,
+		OpenPrice: decimal.MustParse(ohlcv[0]),
+		HighPrice: decimal.MustParse(ohlcv[1]),
+		LowPrice:  decimal.MustParse(ohlcv[2]),
+		Price:     decimal.MustParse(ohlcv[3]),
+		Volume:    decimal.MustParse(ohlcv[4]),
+	})
+}
+
+func (tr *testReconciler) discrepancies() []Discrepancy {
+	var d []Discrepancy
+	for len(tr.out) > 0 {
+		d = append(d, <-tr.out)
+	}
+	return d
+}
+
+func TestReconcileMatchWithinTolerance(t *testing.T) {
+	tr := newTestReconciler()
+	// close расходится на 0.00005, объем - на 0.0005: оба в допуске
+	tr.window("BTCUSDT", "1m", 0, 0, "100", "110", "90", "100.005", "10.005")
+	tr.kline("BTCUSDT", "1m", 0, "100", "110", "90", "100", "10")
+
+	if d := tr.discrepancies(); len(d) != 0 {
+		t.Errorf("discrepancies = %+v, want none", d)
+	}
+	if s := tr.r.Stats(); s != (ReconcileStats{Matched: 1}) {
+		t.Errorf("stats = %+v, want 1 matched", s)
+	}
+}
+
+func TestReconcileMismatch(t *testing.T) {
+	tr := newTestReconciler()
+	tr.kline("BTCUSDT", "1m", 0, "100", "110", "90", "100", "10")
+	tr.window("BTCUSDT", "1m", 0, 0, "100", "110", "90", "101", "12")
+
+	d := tr.discrepancies()
+	if len(d) != 1 || d[0].Kind != DiscrepancyMismatch || !d[0].StartTime.Equal(testStart) {
+		t.Fatalf("discrepancies = %+v, want one mismatch", d)
+	}
+	want := []struct{ field, ours, exchange, relative string }{
+		{"close", "101", "100", "0.01"},
+		{"volume", "12", "10", "0.2"},
+	}
+	if len(d[0].Fields) != len(want) {
+		t.Fatalf("fields = %+v, want close and volume", d[0].Fields)
+	}
+	for i, w := range want {
+		f := d[0].Fields[i]
+		if f.Field != w.field || f.Ours.String() != w.ours || f.Exchange.String() != w.exchange ||
+			!f.Relative.Equal(decimal.MustParse(w.relative)) {
+			t.Errorf("field %d = %s %s vs %s (%s), want %s %s vs %s (%s)",
+				i, f.Field, f.Ours, f.Exchange, f.Relative, w.field, w.ours, w.exchange, w.relative)
+		}
+	}
+	if s := tr.r.Stats(); s != (ReconcileStats{Mismatched: 1}) {
+		t.Errorf("stats = %+v, want 1 mismatched", s)
+	}
+}
+
+func TestReconcileMissingWindow(t *testing.T) {
+	tr := newTestReconciler()
+	tr.kline("BTCUSDT", "1m", 0, "100", "110", "90", "100", "10")
+
+	now := time.Now()
+	tr.r.expire(context.Background(), now.Add(testMaxWait/2))
+	if d := tr.discrepancies(); len(d) != 0 {
+		t.Fatalf("discrepancies before MaxWait = %+v, want none", d)
+	}
+
+	tr.r.expire(context.Background(), now.Add(testMaxWait))
+	d := tr.discrepancies()
+	if len(d) != 1 || d[0].Kind != DiscrepancyMissingWindow || d[0].Symbol != "BTCUSDT" || d[0].Interval != "1m" {
+		t.Fatalf("discrepancies = %+v, want missing_window for BTCUSDT 1m", d)
+	}
+	if s := tr.r.Stats(); s != (ReconcileStats{MissingWindow: 1}) {
+		t.Errorf("stats = %+v, want 1 missing window", s)
+	}
+}
+
+// Свеча без kline - пропуск, только если по ее серии kline приходят
+func TestReconcileMissingKline(t *testing.T) {
+	tr := newTestReconciler()
+	tr.window("BTCUSDT", "1m", 0, 0, "100", "110", "90", "100", "10")
+	tr.kline("BTCUSDT", "1m", 0, "100", "110", "90", "100", "10")
+
+	tr.window("BTCUSDT", "1m", time.Minute, 0, "100", "110", "90", "100", "10")
+	// У биржи нет kline 10s, а по ETHUSDT kline не подписаны
+	tr.window("BTCUSDT", "10s", 0, 0, "100", "110", "90", "100", "10")
+	tr.window("ETHUSDT", "1m", 0, 0, "100", "110", "90", "100", "10")
+
+	tr.r.expire(context.Background(), time.Now().Add(testMaxWait))
+	d := tr.discrepancies()
+	if len(d) != 1 || d[0].Kind != DiscrepancyMissingKline || d[0].Symbol != "BTCUSDT" ||
+		d[0].Interval != "1m" || !d[0].StartTime.Equal(testStart.Add(time.Minute)) {
+		t.Fatalf("discrepancies = %+v, want missing_kline for BTCUSDT 1m at +1m", d)
+	}
+	if s := tr.r.Stats(); s != (ReconcileStats{Matched: 1, MissingKline: 1}) {
+		t.Errorf("stats = %+v, want 1 matched, 1 missing kline", s)
+	}
+	if len(tr.r.pending) != 0 {
+		t.Errorf("pending = %d, want expired pairs removed", len(tr.r.pending))
+	}
+}
+
+// Исправления свечи (Revision > 0) не сверяются: пара сверена по первому выпуску
+func TestReconcileIgnoresRevisions(t *testing.T) {
+	tr := newTestReconciler()
+	tr.window("BTCUSDT", "1m", 0, 0, "100", "110", "90", "100", "10")
+	tr.kline("BTCUSDT", "1m", 0, "100", "110", "90", "100", "10")
+	tr.window("BTCUSDT", "1m", 0, 1, "100", "150", "90", "150", "11")
+	tr.window("BTCUSDT", "1m", time.Minute, 1, "100", "150", "90", "150", "11")
+
+	tr.r.expire(context.Background(), time.Now().Add(testMaxWait))
+	if d := tr.discrepancies(); len(d) != 0 {
+		t.Errorf("discrepancies = %+v, want none", d)
+	}
+	if s := tr.r.Stats(); s != (ReconcileStats{Matched: 1}) {
+		t.Errorf("stats = %+v, want 1 matched", s)
+	}
+	if len(tr.r.pending) != 0 {
+		t.Errorf("pending = %d, want revisions not tracked", len(tr.r.pending))
+	}
+}
@@ -0,0 +1,156 @@
+package aggregator
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// quoteScale - знаков в quote-объемах свечи, как у kline Binance:
+// price * quantity дает до 16 знаков, и сумма быстро уходит из int64
+const quoteScale = 8
+
+// rollupPlan - из чего строится каждая свеча набора. Из сделок - только самая
+// мелкая, остальные собираются из закрытых свечей самого крупного интервала,
+// который укладывается в них целиком: 1s -> 1m -> 5m -> 1h -> 1d.
+// Интервал, в который не укладывается ни один мельче (3m при 5m), тоже
+// строится из сделок
+type rollupPlan struct {
+	intervals []Interval // по возрастанию длительности
+	names     []string   // имена интервалов, чтобы не собирать их на каждую свечу
+	source    []int      // номер интервала-источника, -1 - из сделок
+	targets   [][]int    // какие интервалы собираются из этого
+}
+
+func newRollupPlan(intervals []Interval) *rollupPlan {
+	intervals = slices.Clone(intervals)
+	slices.SortStableFunc(intervals, func(a, b Interval) int {
+		return cmp.Compare(a.Duration(), b.Duration())
+	})
+
+	plan := &rollupPlan{
+		intervals: intervals,
+		names:     make([]string, len(intervals)),
+		source:    make([]int, len(intervals)),
+		targets:   make([][]int, len(intervals)),
+	}
+	for i, iv := range intervals {
+		plan.names[i] = iv.String()
+		plan.source[i] = -1
+		for j := i - 1; j >= 0; j-- {
+			if nests(intervals[j], iv) {
+				plan.source[i] = j
+				plan.targets[j] = append(plan.targets[j], i)
+				break
+			}
+		}
+	}
+	return plan
+}
+
+// nests - каждая свеча big складывается из целых свечей small
+func nests(small, big Interval) bool {
+	if small.loc.String() != big.loc.String() {
+		return false
+	}
+
+	switch {
+	case small.fixed() > 0 && big.fixed() > 0:
+		return big.fixed()%small.fixed() == 0
+	case small.fixed() > 0:
+		// Интервалы внутри дня делят сутки, а календарные свечи начинаются в полночь
+		return true
+	case small.unit == big.unit:
+		return big.n%small.n == 0
+	case small.unit == 'd' && small.n == 1:
+		return big.fixed() == 0
+	}
+	return false
+}
+
+// addTrade - сделка в свечу. Open и Close - по времени сделок, а не по порядку прихода
+func addTrade(window *models.Window, trade models.UniversalTrade) {
+	if window.Trades == 0 || trade.Timestamp.Before(window.FirstTradeTime) {
+		window.Open = trade.Price
+		window.FirstTradeTime = trade.Timestamp
+	}
+	if window.Trades == 0 || !trade.Timestamp.Before(window.LastTradeTime) {
+		window.Close = trade.Price
+		window.LastTradeTime = trade.Timestamp
+	}
+
+	if trade.Price.GreaterThan(window.High) {
+		window.High = trade.Price
+	}
+	if trade.Price.LessThan(window.Low) || window.Low.IsZero() {
+		window.Low = trade.Price
+	}
+
+	window.Quantity = window.Quantity.Add(trade.Quantity)
+	window.Trades++
+
+	quote := trade.Price.Mul(trade.Quantity).Rescale(quoteScale)
+	window.QuoteVolume = window.QuoteVolume.Add(quote)
+	if trade.IsBuyerMaker {
+		window.TakerSellVolume = window.TakerSellVolume.Add(trade.Quantity)
+		window.TakerSellQuote = window.TakerSellQuote.Add(quote)
+	} else {
+		window.TakerBuyVolume = window.TakerBuyVolume.Add(trade.Quantity)
+		window.TakerBuyQuote = window.TakerBuyQuote.Add(quote)
+	}
+	if trade.Quantity.GreaterThan(window.MaxTradeSize) {
+		window.MaxTradeSize = trade.Quantity
+	}
+
+	id := trade.AggTradeID
+	if id == 0 {
+		id = trade.TradeID
+	}
+	addTradeIDs(window, id, id)
+}
+
+// mergeWindow - закрытая мелкая свеча в крупную, по тем же правилам, что и сделка
+func mergeWindow(dst, src *models.Window) {
+	if src.Trades == 0 {
+		return
+	}
+
+	if dst.Trades == 0 || src.FirstTradeTime.Before(dst.FirstTradeTime) {
+		dst.Open = src.Open
+		dst.FirstTradeTime = src.FirstTradeTime
+	}
+	if dst.Trades == 0 || !src.LastTradeTime.Before(dst.LastTradeTime) {
+		dst.Close = src.Close
+		dst.LastTradeTime = src.LastTradeTime
+	}
+
+	if src.High.GreaterThan(dst.High) {
+		dst.High = src.High
+	}
+	if src.Low.LessThan(dst.Low) || dst.Low.IsZero() {
+		dst.Low = src.Low
+	}
+
+	dst.Quantity = dst.Quantity.Add(src.Quantity)
+	dst.Trades += src.Trades
+
+	dst.QuoteVolume = dst.QuoteVolume.Add(src.QuoteVolume)
+	dst.TakerBuyVolume = dst.TakerBuyVolume.Add(src.TakerBuyVolume)
+	dst.TakerBuyQuote = dst.TakerBuyQuote.Add(src.TakerBuyQuote)
+	dst.TakerSellVolume = dst.TakerSellVolume.Add(src.TakerSellVolume)
+	dst.TakerSellQuote = dst.TakerSellQuote.Add(src.TakerSellQuote)
+	dst.MaxTradeSize = decimal.Max(dst.MaxTradeSize, src.MaxTradeSize)
+	addTradeIDs(dst, src.FirstTradeID, src.LastTradeID)
+}
+
+// addTradeIDs расширяет диапазон ID сделок свечи; 0 - ID нет
+func addTradeIDs(window *models.Window, first, last int64) {
+	if first != 0 && (window.FirstTradeID == 0 || first < window.FirstTradeID) {
+		window.FirstTradeID = first
+	}
+	if last > window.LastTradeID {
+		window.LastTradeID = last
+	}
+}
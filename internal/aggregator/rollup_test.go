@@ -0,0 +1,100 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+func TestRollupPlan(t *testing.T) {
+	intervals, err := ParseIntervals([]string{"1d", "1h", "3m", "1s", "1M", "5m", "1m", "1w"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := newRollupPlan(intervals)
+
+	sources := make(map[string]string)
+	for level, source := range plan.source {
+		sources[plan.names[level]] = "trades"
+		if source >= 0 {
+			sources[plan.names[level]] = plan.names[source]
+		}
+	}
+	// 3m не складывается из 5m, 1M - из недель
+	want := map[string]string{
+		"1s": "trades", "1m": "1s", "3m": "1m", "5m": "1m",
+		"1h": "5m", "1d": "1h", "1w": "1d", "1M": "1d",
+	}
+	for name, source := range want {
+		if sources[name] != source {
+			t.Errorf("%s built from %s, want %s", name, sources[name], source)
+		}
+	}
+
+	// Интервалы в разных поясах друг из друга не собираются
+	shanghai, _ := ParseTimezone("+08:00")
+	day, _ := ParseInterval("1d", shanghai)
+	hour, _ := ParseInterval("1h", time.UTC)
+	if nests(hour, day) {
+		t.Error("1h UTC nests into 1d +08:00")
+	}
+}
+
+// Свечи, собранные из мелких, совпадают со свечами прямо из сделок
+func TestRollupMatchesTrades(t *testing.T) {
+	rolled := newTestWindows(t, WindowConfig{}, "1s", "1m", "5m")
+	direct := newTestWindows(t, WindowConfig{}, "5m")
+	directMinute := newTestWindows(t, WindowConfig{}, "1m")
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	at := time.Duration(0)
+	for id := int64(1); at < 12*time.Minute; id++ {
+		trade := models.UniversalTrade{
+			Symbol:       "BTCUSDT",
+			EventType:    "aggTrade",
+			AggTradeID:   id,
+			Timestamp:    testStart.Add(at),
+			Price:        decimal.MustParse(fmt.Sprintf("%d.%02d", 100+rng.IntN(5), rng.IntN(100))),
+			Quantity:     decimal.MustParse(fmt.Sprintf("0.%03d", 1+rng.IntN(999))),
+			IsBuyerMaker: rng.IntN(2) == 0,
+		}
+		for _, tw := range []*testWindows{rolled, direct, directMinute} {
+			tw.wa.processAggTrade(context.Background(), trade)
+		}
+		at += time.Duration(rng.IntN(3000)) * time.Millisecond
+	}
+
+	for _, tc := range []struct {
+		interval string
+		direct   *testWindows
+	}{
+		{"5m", direct},
+		{"1m", directMinute},
+	} {
+		got, want := rolled.windows("BTCUSDT", tc.interval), tc.direct.windows("BTCUSDT", tc.interval)
+		if len(want) == 0 || !slices.Equal(starts(got), starts(want)) {
+			t.Fatalf("%s starts = %v, want %v", tc.interval, starts(got), starts(want))
+		}
+		for i := range want {
+			if g, w := summary(got[i]), summary(want[i]); g != w {
+				t.Errorf("%s candle %d:\n got %s\nwant %s", tc.interval, i, g, w)
+			}
+		}
+	}
+}
+
+// summary - все поля свечи, которые считаются из сделок
+func summary(w *models.Window) string {
+	return fmt.Sprintf("%s-%s ohlc %s/%s/%s/%s qty %s quote %s buy %s/%s sell %s/%s max %s trades %d ids %d-%d at %s-%s",
+		w.StartTime.Format(time.TimeOnly), w.EndTime.Format(time.TimeOnly),
+		w.Open, w.High, w.Low, w.Close, w.Quantity, w.QuoteVolume,
+		w.TakerBuyVolume, w.TakerBuyQuote, w.TakerSellVolume, w.TakerSellQuote,
+		w.MaxTradeSize, w.Trades, w.FirstTradeID, w.LastTradeID,
+		w.FirstTradeTime.Format(time.StampMilli), w.LastTradeTime.Format(time.StampMilli))
+}
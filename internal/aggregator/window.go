@@ -2,188 +2,609 @@
 package aggregator
 
 import (
+	"cmp"
 	"context"
-	"fmt"
 	"log/slog"
 	"math"
-	"strings"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
 	"github.com/WWoi/web-parcer/internal/models"
 )
 
 const (
-	interval10s = "10s"
-	interval1h  = "1h"
-	interval1d  = "1d"
+	defaultMaxDelay = 2 * time.Second
+	idleCheckPeriod = time.Second
 )
 
+// LatePolicy - что делать со сделкой, свеча которой уже закрыта.
+// С LateDrop и LateSide опоздавшая хотя бы для одной свечи сделка не попадает
+// ни в одну: иначе крупные свечи разошлись бы с суммой мелких, а сделка была бы
+// одновременно учтена и отброшена. С LateUpdate сделка исправляет все свечи,
+// которые еще ее принимают
+type LatePolicy string
+
+const (
+	// LateDrop - сделка отбрасывается (Stats.Dropped)
+	LateDrop LatePolicy = "drop"
+	// LateUpdate - закрытая свеча ждет опоздавших AllowedLateness и выпускается
+	// заново с Revision + 1
+	LateUpdate LatePolicy = "update"
+	// LateSide - сделка отбрасывается и уходит в отдельный канал (WithLateTrades)
+	LateSide LatePolicy = "side"
+)
+
+type WindowConfig struct {
+	// Intervals - свечи всех символов; пусто - DefaultIntervals в UTC
+	Intervals []Interval
+	// SymbolIntervals - свой набор свечей для символа ("BTCUSDT")
+	SymbolIntervals map[string][]Interval
+	// MaxDelay - насколько сделки символа могут опаздывать относительно самой
+	// новой из них: watermark = время самой новой сделки - MaxDelay.
+	// Свеча закрывается, когда watermark доходит до ее конца
+	MaxDelay time.Duration
+	// LatePolicy - что делать со сделками в уже закрытые свечи
+	LatePolicy LatePolicy
+	// AllowedLateness - для LateUpdate: сколько закрытая свеча еще принимает сделки
+	AllowedLateness time.Duration
+	// IdleTimeout - символ, по которому столько (по времени событий) нет сделок,
+	// пока другие символы идут, получает общий watermark: иначе его последняя
+	// свеча не закроется до следующей сделки. 0 - не продвигать
+	IdleTimeout time.Duration
+	// GapFill - за периоды без сделок выпускать плоские свечи (OHLC - close
+	// предыдущей, объем 0, Synthetic). Молчащие символы двигает только
+	// IdleTimeout, без него пропуски заполняются на следующей сделке
+	GapFill bool
+	// GapFillSymbols - заполнять только эти символы; пусто - все
+	GapFillSymbols []string
+	// MaxSilence - символ без сделок дольше (по watermark) перестает
+	// заполняться и забывается до следующей сделки. 0 - без ограничения
+	MaxSilence time.Duration
+}
+
+// WindowStats - счетчики агрегатора свечей
+type WindowStats struct {
+	Late      int64 // сделок, опоздавших хотя бы в одну закрытую свечу
+	Updated   int64 // из них исправили закрытые свечи (LateUpdate)
+	Dropped   int64 // из них в закрытые свечи не попали
+	Revisions int64 // повторных выпусков свечей
+	Synthetic int64 // плоских свечей за периоды без сделок (GapFill)
+	Retired   int64 // символов, забытых после MaxSilence
+}
+
+// WindowOption - дополнительная настройка агрегатора свечей
+type WindowOption func(*WindowAggregator)
+
+// WithLateTrades отдает опоздавшие сделки в канал (для LateSide)
+func WithLateTrades(out chan<- models.UniversalTrade) WindowOption {
+	return func(wa *WindowAggregator) {
+		wa.lateChan = out
+	}
+}
+
+// WatermarkHold - кто может придержать закрытие свечей символа:
+// processor.GapDetector, пока ждет или догружает пропущенные сделки
+type WatermarkHold interface {
+	Pending(symbol string) bool
+}
+
+// WithWatermarkHold не двигает watermark символа, пока hold.Pending: иначе
+// догруженные сделки пришли бы в уже закрытые свечи и опоздали
+func WithWatermarkHold(hold WatermarkHold) WindowOption {
+	return func(wa *WindowAggregator) {
+		wa.hold = hold
+	}
+}
+
+// windowKey - свеча символа: номер интервала в плане символа и начало свечи
+type windowKey struct {
+	level int
+	start int64 // unix ms
+}
+
+// candle - свеча, которую строит агрегатор
+type candle struct {
+	window *models.Window
+	key    windowKey
+	end    time.Time
+	closed bool // выпущена; с LateUpdate еще принимает опоздавшие сделки
+}
+
+// symbolWindows - свечи и время событий символа. Меняется только в горутине Start
+type symbolWindows struct {
+	symbol    string
+	plan      *rollupPlan
+	maxEvent  time.Time // время самой новой сделки
+	watermark time.Time // свечи с концом не позже закрыты
+	next      time.Time // ближайший конец или срок хранения свечи: раньше advance нечего делать
+	candles   map[windowKey]*candle
+
+	// Только с GapFill, по интервалам плана: конец и close последней
+	// выпущенной свечи, с них продолжаются плоские свечи
+	gapFill   bool
+	retired   bool // молчит дольше MaxSilence: не заполняется
+	filled    []time.Time
+	lastClose []decimal.Decimal
+}
+
+// WindowAggregator строит свечи по времени сделок (event time), поэтому
+// догруженные, воспроизведенные и задержанные сделки попадают в свою свечу,
+// а replay дает те же свечи, что и live. Свечи закрывает watermark символа.
+// Из сделок строится только самая мелкая свеча, крупные собираются из
+// закрытых мелких (rollupPlan)
 type WindowAggregator struct {
+	cfg       WindowConfig
 	inputChan <-chan models.UniversalTrade
+	lateChan  chan<- models.UniversalTrade
+	hold      WatermarkHold
 
-	windowsMap sync.Map // key: <coin_name>:<interval>:<start_time_unix> value: *models.Window
+	plan        *rollupPlan
+	symbolPlans map[string]*rollupPlan
+	gapFill     map[string]struct{} // GapFillSymbols; nil - все символы
+	symbols     map[string]*symbolWindows
+	direct      []bool    // буфер applyTrade
+	due         []*candle // буфер advance
 
-	lastPrices       sync.Map // key: <coin_name> value: <cost>
+	lastPrices       map[string]decimal.Decimal
 	outputChanWindow chan<- *models.Window
+
+	mu    sync.Mutex
+	stats WindowStats
 }
 
 func NewWindowAggregator(
+	cfg WindowConfig,
 	inChan <-chan models.UniversalTrade,
 	outWindown chan<- *models.Window,
+	opts ...WindowOption,
 ) *WindowAggregator {
-	return &WindowAggregator{
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultMaxDelay
+	}
+	if cfg.LatePolicy == "" {
+		cfg.LatePolicy = LateDrop
+	}
+	if len(cfg.Intervals) == 0 {
+		cfg.Intervals, _ = ParseIntervals(DefaultIntervals, time.UTC)
+	}
+
+	wa := &WindowAggregator{
+		cfg:              cfg,
 		inputChan:        inChan,
 		outputChanWindow: outWindown,
+		plan:             newRollupPlan(cfg.Intervals),
+		symbolPlans:      make(map[string]*rollupPlan, len(cfg.SymbolIntervals)),
+		symbols:          make(map[string]*symbolWindows),
+		lastPrices:       make(map[string]decimal.Decimal),
+	}
+	for symbol, intervals := range cfg.SymbolIntervals {
+		wa.symbolPlans[symbol] = newRollupPlan(intervals)
+	}
+	if len(cfg.GapFillSymbols) > 0 {
+		wa.gapFill = make(map[string]struct{}, len(cfg.GapFillSymbols))
+		for _, symbol := range cfg.GapFillSymbols {
+			wa.gapFill[symbol] = struct{}{}
+		}
+	}
+	for _, opt := range opts {
+		opt(wa)
 	}
+	return wa
 }
 
 func (wa *WindowAggregator) Start(ctx context.Context) {
-	// Запускаем обработчик входящих трейдов
-	go wa.processIncoming()
-
-	// Запускаем периодическую проверку завершенных свечей
-	go wa.periodicWindowCloser(ctx)
-
-	<-ctx.Done()
-}
-
-// periodicWindowCloser периодически проверяет и закрывает завершенные свечи
-func (wa *WindowAggregator) periodicWindowCloser(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	idle := time.NewTicker(idleCheckPeriod)
+	defer idle.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			now := time.Now()
-			wa.closeExpiredWindows(now)
+
+		case trade, ok := <-wa.inputChan:
+			if !ok {
+				return
+			}
+			wa.processAggTrade(ctx, trade)
+
+		case <-idle.C:
+			wa.advanceIdle(ctx)
 		}
 	}
 }
 
-// closeExpiredWindows проверяет все активные окна и закрывает те, что уже завершились
-func (wa *WindowAggregator) closeExpiredWindows(now time.Time) {
-	wa.windowsMap.Range(func(key, value any) bool {
-		keyStr := key.(string)
-		parts := strings.Split(keyStr, ":")
+// Stats возвращает счетчики опоздавших сделок
+func (wa *WindowAggregator) Stats() WindowStats {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	return wa.stats
+}
 
-		if len(parts) != 3 {
-			return true
-		}
+func (wa *WindowAggregator) processAggTrade(ctx context.Context, trade models.UniversalTrade) {
+	if trade.Timestamp.IsZero() {
+		trade.Timestamp = time.Now()
+	}
 
-		window := value.(*models.Window)
-		interval := parts[1]
-		intervalDuration := getIntervalDuration(interval)
+	sw, ok := wa.symbols[trade.Symbol]
+	if !ok {
+		sw = wa.newSymbol(trade.Symbol)
+		wa.symbols[trade.Symbol] = sw
+	}
 
-		// Время окончания свечи = время начала + длительность интервала
-		windowEndTime := window.StartTime.Add(intervalDuration)
+	// Сначала сделка, потом watermark: сделка, которая сама двигает watermark,
+	// не может опоздать в свою свечу
+	if late, updated := wa.applyTrade(ctx, sw, trade); late {
+		wa.handleLate(ctx, trade, updated)
+	}
 
-		// Если текущее время больше времени окончания, закрываем свечу
-		if now.After(windowEndTime) || now.Equal(windowEndTime) {
-			window.Mu.Lock()
-			if window.Trades > 0 {
-				window.EndTime = windowEndTime
-				wa.outputChanWindow <- window
-			}
-			window.Mu.Unlock()
-			wa.windowsMap.Delete(keyStr)
+	if trade.Timestamp.After(sw.maxEvent) {
+		// Пропуски до этой сделки заполняются по прежнему времени последней
+		// сделки: иначе символ, который вернулся после тишины дольше
+		// MaxSilence, получил бы плоские свечи за всю тишину
+		wa.advance(ctx, sw, trade.Timestamp.Add(-wa.cfg.MaxDelay))
+		// Остаток такой тишины не заполняется: ряд начинается с этой сделки
+		if sw.gapFill && wa.silent(sw, trade.Timestamp) {
+			clear(sw.filled)
 		}
+		sw.maxEvent = trade.Timestamp
+	}
+	sw.retired = false
+
+	// Проверяем, нужно ли обновить lastPrice для уведомлений
+	if wa.shouldUpdateLastPrice(&trade) {
+		wa.lastPrices[trade.Symbol] = trade.Price
+	}
+}
 
+// shouldUpdateLastPrice проверяет, достаточно ли изменилась цена для обновления
+func (wa *WindowAggregator) shouldUpdateLastPrice(trade *models.UniversalTrade) bool {
+	last, exist := wa.lastPrices[trade.Symbol]
+	if !exist || last.IsZero() {
 		return true
-	})
+	}
+
+	// Порог - эвристика для уведомлений, здесь точность float64 достаточна
+	price := trade.Price.Float64()
+	percentForCoin := getPercent(price)
+	change := math.Abs(price-last.Float64()) / last.Float64()
+
+	return change >= percentForCoin
 }
 
-func (wa *WindowAggregator) processIncoming() {
-	for trade := range wa.inputChan {
-		wa.processAggTrade(trade)
+func (wa *WindowAggregator) newSymbol(symbol string) *symbolWindows {
+	sw := &symbolWindows{
+		symbol:  symbol,
+		plan:    wa.planFor(symbol),
+		candles: make(map[windowKey]*candle),
+	}
+	if !wa.cfg.GapFill {
+		return sw
+	}
+	if _, ok := wa.gapFill[symbol]; ok || wa.gapFill == nil {
+		sw.gapFill = true
+		sw.filled = make([]time.Time, len(sw.plan.intervals))
+		sw.lastClose = make([]decimal.Decimal, len(sw.plan.intervals))
 	}
+	return sw
 }
 
-func (wa *WindowAggregator) processAggTrade(trade models.UniversalTrade) {
-	// Всегда обновляем окна для всех трейдов
-	wa.updateWindow(trade, interval10s)
-	wa.updateWindow(trade, interval1h)
-	wa.updateWindow(trade, interval1d)
+// planFor - набор свечей символа
+func (wa *WindowAggregator) planFor(symbol string) *rollupPlan {
+	if plan, ok := wa.symbolPlans[symbol]; ok {
+		return plan
+	}
+	return wa.plan
+}
 
-	// Проверяем, нужно ли обновить lastPrice для уведомлений
-	if wa.shouldUpdateLastPrice(&trade) {
-		wa.lastPrices.Store(trade.Symbol, trade.Price)
+// applyTrade кладет сделку в свечи, которые строятся из сделок. Обычно это
+// одна открытая свеча: крупные получат сделку, когда она закроется. Если же
+// свеча уже закрыта и ушла в крупные: с LateUpdate сделка идет в них напрямую
+// (исправляет их или опаздывает и в них), с LateDrop и LateSide - никуда
+func (wa *WindowAggregator) applyTrade(ctx context.Context, sw *symbolWindows, trade models.UniversalTrade) (late, updated bool) {
+	plan := sw.plan
+	if wa.cfg.LatePolicy != LateUpdate && wa.isLate(sw, trade.Timestamp) {
+		return true, false
+	}
+
+	// direct[i] - свеча интервала i сделку не удержала, крупные берут ее сами
+	direct := wa.direct[:0]
+	for level, iv := range plan.intervals {
+		if source := plan.source[level]; source >= 0 && !direct[source] {
+			direct = append(direct, false)
+			continue
+		}
+
+		start := iv.Start(trade.Timestamp)
+		c, ok := sw.candles[windowKey{level: level, start: start.UnixMilli()}]
+		switch {
+		case !ok && !iv.End(start).After(sw.watermark):
+			// Свеча закрыта и уже удалена - или ее не было, а watermark ушел дальше
+			late = true
+			direct = append(direct, true)
+
+		case !ok:
+			c = wa.newCandle(sw, level, start)
+			addTrade(c.window, trade)
+			direct = append(direct, false)
+
+		case !c.closed:
+			addTrade(c.window, trade)
+			direct = append(direct, false)
+
+		default:
+			addTrade(c.window, trade)
+			c.window.Revision++
+			wa.emit(ctx, c.window)
+			wa.mu.Lock()
+			wa.stats.Revisions++
+			wa.mu.Unlock()
+			late, updated = true, true
+			direct = append(direct, true)
+		}
 	}
+	wa.direct = direct
+	return late, updated
 }
 
-// shouldUpdateLastPrice проверяет, достаточно ли изменилась цена для обновления
-func (wa *WindowAggregator) shouldUpdateLastPrice(trade *models.UniversalTrade) bool {
-	lastPrice, exist := wa.lastPrices.Load(trade.Symbol)
-	if !exist {
-		return true
+// isLate - свеча хотя бы одного интервала, который строится из сделок,
+// для момента at уже закрыта
+func (wa *WindowAggregator) isLate(sw *symbolWindows, at time.Time) bool {
+	plan := sw.plan
+	for level, iv := range plan.intervals {
+		if plan.source[level] >= 0 {
+			continue
+		}
+		start := iv.Start(at)
+		c, ok := sw.candles[windowKey{level: level, start: start.UnixMilli()}]
+		if ok && c.closed || !ok && !iv.End(start).After(sw.watermark) {
+			return true
+		}
 	}
+	return false
+}
 
-	percentForCoin := getPercent(trade.Price)
-	lastPrice64 := lastPrice.(float64)
+func (wa *WindowAggregator) newCandle(sw *symbolWindows, level int, start time.Time) *candle {
+	c := &candle{
+		window: &models.Window{
+			Symbol:    sw.symbol,
+			Interval:  sw.plan.names[level],
+			StartTime: start,
+		},
+		key: windowKey{level: level, start: start.UnixMilli()},
+		end: sw.plan.intervals[level].End(start),
+	}
+	sw.candles[c.key] = c
+	if sw.next.IsZero() || c.end.Before(sw.next) {
+		sw.next = c.end
+	}
 
-	change := math.Abs((trade.Price - lastPrice64) / lastPrice64)
+	// Свечи открываются на каждой сделке горячего пути: аргументы лога не собираем зря
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		slog.Debug("📊 Window started",
+			"symbol", sw.symbol,
+			"interval", c.window.Interval,
+			"start", start.Format("15:04:05"))
+	}
+	return c
+}
 
-	return change >= percentForCoin
+// handleLate - сделка не попала хотя бы в одну свечу: ее свеча закрыта
+func (wa *WindowAggregator) handleLate(ctx context.Context, trade models.UniversalTrade, updated bool) {
+	wa.mu.Lock()
+	wa.stats.Late++
+	if updated {
+		wa.stats.Updated++
+	} else {
+		wa.stats.Dropped++
+	}
+	wa.mu.Unlock()
+
+	slog.Debug("Late trade",
+		"symbol", trade.Symbol,
+		"timestamp", trade.Timestamp,
+		"policy", wa.cfg.LatePolicy)
+
+	if wa.cfg.LatePolicy != LateSide || wa.lateChan == nil {
+		return
+	}
+	select {
+	case wa.lateChan <- trade:
+	case <-ctx.Done():
+	}
 }
 
-func getIntervalDuration(interval string) time.Duration {
-	switch interval {
-	case interval10s:
-		return 10 * time.Second
-	case interval1h:
-		return time.Hour
-	case interval1d:
-		return 24 * time.Hour
-	default:
-		return 0
+// advance двигает watermark символа, закрывает свечи, которые он прошел,
+// и собирает из них крупные
+func (wa *WindowAggregator) advance(ctx context.Context, sw *symbolWindows, watermark time.Time) {
+	if !watermark.After(sw.watermark) {
+		return
+	}
+	if wa.hold != nil && wa.hold.Pending(sw.symbol) {
+		return
+	}
+	sw.watermark = watermark
+	if sw.next.IsZero() || watermark.Before(sw.next) {
+		return
+	}
+
+	sw.next = time.Time{}
+	due := wa.due[:0]
+	for _, c := range sw.candles {
+		if !c.closed && !c.end.After(watermark) {
+			due = append(due, c)
+			continue
+		}
+		wa.expire(sw, c)
+	}
+
+	// От мелких к крупным: крупная свеча закрывается, когда в нее уже ушли все мелкие
+	slices.SortFunc(due, byLevel)
+	for i := 0; i < len(due); i++ {
+		c := due[i]
+		c.closed = true
+		c.window.EndTime = c.end
+		wa.fillGaps(ctx, sw, c.key.level, c.window.StartTime)
+		wa.emit(ctx, c.window)
+		if sw.gapFill {
+			sw.filled[c.key.level] = c.end
+			sw.lastClose[c.key.level] = c.window.Close
+		}
+
+		// Крупная свеча, которую открыла эта, тоже может быть пройдена watermark
+		n := len(due)
+		if due = wa.rollup(sw, c, due); len(due) > n {
+			slices.SortFunc(due[i+1:], byLevel)
+		}
+		wa.expire(sw, c)
+	}
+	clear(due)
+	wa.due = due[:0]
+
+	if sw.gapFill {
+		wa.fillTail(ctx, sw)
 	}
 }
 
-func (wa *WindowAggregator) updateWindow(trade models.UniversalTrade, interval string) {
-	intervalDuration := getIntervalDuration(interval)
-	if intervalDuration == 0 {
+// fillGaps выпускает плоские свечи интервала за периоды без сделок: от конца
+// последней выпущенной свечи до until, но не дальше watermark и MaxSilence
+func (wa *WindowAggregator) fillGaps(ctx context.Context, sw *symbolWindows, level int, until time.Time) {
+	if !sw.gapFill || sw.retired || sw.filled[level].IsZero() {
 		return
 	}
 
-	// ВАЖНО: Используем текущее время, а не время из трейда
-	now := time.Now()
-	windowStartTime := now.Truncate(intervalDuration)
-	key := fmt.Sprintf("%s:%s:%d", trade.Symbol, interval, windowStartTime.Unix())
+	iv := sw.plan.intervals[level]
+	last := sw.lastClose[level]
+	for start := sw.filled[level]; start.Before(until); start = iv.End(start) {
+		end := iv.End(start)
+		if end.After(sw.watermark) || wa.silent(sw, start) {
+			return
+		}
+
+		wa.emit(ctx, &models.Window{
+			Symbol:    sw.symbol,
+			Interval:  sw.plan.names[level],
+			Open:      last,
+			High:      last,
+			Low:       last,
+			Close:     last,
+			StartTime: start,
+			EndTime:   end,
+			Synthetic: true,
+		})
+		sw.filled[level] = end
+
+		wa.mu.Lock()
+		wa.stats.Synthetic++
+		wa.mu.Unlock()
+	}
+}
+
+// fillTail заполняет пропуски до watermark и забывает символ, который
+// молчит дольше MaxSilence
+func (wa *WindowAggregator) fillTail(ctx context.Context, sw *symbolWindows) {
+	for level, iv := range sw.plan.intervals {
+		wa.fillGaps(ctx, sw, level, sw.watermark)
+
+		// Следующая плоская свеча закроется с концом своего периода
+		if filled := sw.filled[level]; !filled.IsZero() && !sw.retired {
+			if end := iv.End(filled); sw.next.IsZero() || end.Before(sw.next) {
+				sw.next = end
+			}
+		}
+	}
+
+	if !sw.retired && wa.silent(sw, sw.watermark) {
+		sw.retired = true
+		clear(sw.filled)
+
+		wa.mu.Lock()
+		wa.stats.Retired++
+		wa.mu.Unlock()
+
+		slog.Info("💤 Symbol retired from gap fill",
+			"symbol", sw.symbol,
+			"last_trade", sw.maxEvent,
+			"max_silence", wa.cfg.MaxSilence)
+	}
+
+	// Открытые свечи забытого символа еще закрываются, потом он удаляется
+	if sw.retired && len(sw.candles) == 0 {
+		delete(wa.symbols, sw.symbol)
+	}
+}
 
-	windowInterface, isNew := wa.windowsMap.LoadOrStore(key, &models.Window{
-		Symbol:    trade.Symbol,
-		Interval:  interval,
-		StartTime: windowStartTime,
-	})
+// silent - к моменту t символ молчит дольше MaxSilence
+func (wa *WindowAggregator) silent(sw *symbolWindows, t time.Time) bool {
+	return wa.cfg.MaxSilence > 0 && t.Sub(sw.maxEvent) >= wa.cfg.MaxSilence
+}
 
-	window := windowInterface.(*models.Window)
+// expire удаляет свечу, срок хранения которой прошел, остальные сдвигают sw.next
+func (wa *WindowAggregator) expire(sw *symbolWindows, c *candle) {
+	expires := c.end
+	if c.closed && wa.cfg.LatePolicy == LateUpdate {
+		// Закрытые свечи хранятся для исправлений только с LateUpdate
+		expires = expires.Add(wa.cfg.AllowedLateness)
+	}
 
-	window.Mu.Lock()
-	defer window.Mu.Unlock()
+	if !expires.After(sw.watermark) {
+		delete(sw.candles, c.key)
+		return
+	}
+	if sw.next.IsZero() || expires.Before(sw.next) {
+		sw.next = expires
+	}
+}
 
-	if window.Open == 0 {
-		window.Open = trade.Price
-		if isNew {
-			slog.Info("📊 Window started",
-				"symbol", trade.Symbol,
-				"interval", interval,
-				"start", windowStartTime.Format("15:04:05"))
+// rollup добавляет закрытую свечу в крупные, которые из нее собираются;
+// новые крупные свечи, которые уже пора закрыть, дописываются в due
+func (wa *WindowAggregator) rollup(sw *symbolWindows, c *candle, due []*candle) []*candle {
+	for _, level := range sw.plan.targets[c.key.level] {
+		start := sw.plan.intervals[level].Start(c.window.StartTime)
+		parent, ok := sw.candles[windowKey{level: level, start: start.UnixMilli()}]
+		if !ok {
+			parent = wa.newCandle(sw, level, start)
+			if !parent.end.After(sw.watermark) {
+				due = append(due, parent)
+			}
 		}
+		mergeWindow(parent.window, c.window)
 	}
+	return due
+}
 
-	window.Close = trade.Price
+func byLevel(a, b *candle) int {
+	return cmp.Compare(a.key.level, b.key.level)
+}
 
-	if trade.Price > window.High {
-		window.High = trade.Price
+// advanceIdle подтягивает watermark символов без сделок к общему: время
+// событий других символов показывает, что их свечи давно пора закрыть
+func (wa *WindowAggregator) advanceIdle(ctx context.Context) {
+	if wa.cfg.IdleTimeout <= 0 {
+		return
+	}
+
+	var latest, watermark time.Time
+	for _, sw := range wa.symbols {
+		if sw.maxEvent.After(latest) {
+			latest = sw.maxEvent
+		}
+		if sw.watermark.After(watermark) {
+			watermark = sw.watermark
+		}
 	}
 
-	if trade.Price < window.Low || window.Low == 0 {
-		window.Low = trade.Price
+	for _, sw := range wa.symbols {
+		if latest.Sub(sw.maxEvent) >= wa.cfg.IdleTimeout {
+			wa.advance(ctx, sw, watermark)
+		}
 	}
+}
 
-	window.Quantity += trade.Quantity
-	window.Trades++
+func (wa *WindowAggregator) emit(ctx context.Context, window *models.Window) {
+	select {
+	case wa.outputChanWindow <- window.Snapshot():
+	case <-ctx.Done():
+	}
 }
@@ -0,0 +1,259 @@
+package aggregator
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testWindows - агрегатор без горутины Start: сделки подаются напрямую,
+// выпущенные свечи копятся в буфере
+type testWindows struct {
+	wa  *WindowAggregator
+	out chan *models.Window
+	all []*models.Window
+}
+
+func newTestWindows(t *testing.T, cfg WindowConfig, intervals ...string) *testWindows {
+	t.Helper()
+	var err error
+	if cfg.Intervals, err = ParseIntervals(intervals, time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxDelay == 0 {
+		cfg.MaxDelay = time.Second
+	}
+	out := make(chan *models.Window, 10000)
+	return &testWindows{wa: NewWindowAggregator(cfg, nil, out), out: out}
+}
+
+// trade - сделка символа через at после testStart
+func (tw *testWindows) trade(symbol string, at time.Duration, price string) {
+	tw.wa.processAggTrade(context.Background(), models.UniversalTrade{
+		Symbol:    symbol,
+		EventType: "aggTrade",
+		Timestamp: testStart.Add(at),
+		Price:     decimal.MustParse(price),
+		Quantity:  decimal.MustParse("1"),
+	})
+}
+
+// windows - все выпущенные свечи символа и интервала по порядку выпуска
+func (tw *testWindows) windows(symbol, interval string) []*models.Window {
+	for len(tw.out) > 0 {
+		tw.all = append(tw.all, <-tw.out)
+	}
+
+	var windows []*models.Window
+	for _, w := range tw.all {
+		if w.Symbol == symbol && w.Interval == interval {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// starts - начала свечей в секундах от testStart
+func starts(windows []*models.Window) []int {
+	var s []int
+	for _, w := range windows {
+		s = append(s, int(w.StartTime.Sub(testStart)/time.Second))
+	}
+	return s
+}
+
+func TestGapFillFlatCandles(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{GapFill: true}, "10s")
+	tw.trade("BTCUSDT", 1*time.Second, "100")
+	tw.trade("BTCUSDT", 45*time.Second, "101")
+	tw.trade("BTCUSDT", 62*time.Second, "102")
+
+	windows := tw.windows("BTCUSDT", "10s")
+	if got, want := starts(windows), []int{0, 10, 20, 30, 40, 50}; !slices.Equal(got, want) {
+		t.Fatalf("starts = %v, want %v", got, want)
+	}
+
+	for i, w := range windows {
+		synthetic := i != 0 && i != 4
+		if w.Synthetic != synthetic {
+			t.Errorf("%d: Synthetic = %v, want %v", i, w.Synthetic, synthetic)
+		}
+		if !synthetic {
+			continue
+		}
+		prev := "100"
+		if i == 5 {
+			prev = "101"
+		}
+		for _, p := range []decimal.Decimal{w.Open, w.High, w.Low, w.Close} {
+			if p.String() != prev {
+				t.Errorf("%d: OHLC = %s/%s/%s/%s, want %s", i, w.Open, w.High, w.Low, w.Close, prev)
+			}
+		}
+		if w.Trades != 0 || !w.Quantity.IsZero() || !w.EndTime.Equal(w.StartTime.Add(10*time.Second)) {
+			t.Errorf("%d: synthetic candle %+v", i, w)
+		}
+	}
+	if s := tw.wa.Stats(); s.Synthetic != 4 {
+		t.Errorf("Synthetic = %d, want 4", s.Synthetic)
+	}
+}
+
+// Символ вернулся после тишины дольше MaxSilence, пока никто другой не
+// торговал: плоские свечи - только первые MaxSilence тишины
+func TestGapFillMaxSilenceOnResume(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{GapFill: true, MaxSilence: 45 * time.Second}, "10s", "1m")
+	tw.trade("BTCUSDT", 0, "100")
+	tw.trade("BTCUSDT", 155*time.Second, "101")
+	tw.trade("BTCUSDT", 190*time.Second, "102")
+	tw.trade("BTCUSDT", 230*time.Second, "103")
+
+	var synthetic []int
+	windows := tw.windows("BTCUSDT", "10s")
+	for _, w := range windows {
+		if w.Synthetic {
+			synthetic = append(synthetic, int(w.StartTime.Sub(testStart)/time.Second))
+		}
+	}
+	// 10-40 - до MaxSilence, дальше - только после возврата, где тишина короче
+	if want := []int{10, 20, 30, 40, 160, 170, 180, 200, 210}; !slices.Equal(synthetic, want) {
+		t.Errorf("synthetic 10s = %v, want %v", synthetic, want)
+	}
+
+	for _, w := range tw.windows("BTCUSDT", "1m") {
+		if w.Synthetic {
+			t.Errorf("synthetic 1m candle at %s", w.StartTime.Sub(testStart))
+		}
+	}
+	if s := tw.wa.Stats(); s.Retired != 1 {
+		t.Errorf("Retired = %d, want 1", s.Retired)
+	}
+}
+
+// Молчащий символ двигают сделки других символов (IdleTimeout); после
+// MaxSilence он забывается. Символы не из GapFillSymbols не заполняются
+func TestGapFillRetiresIdleSymbol(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{
+		GapFill:        true,
+		GapFillSymbols: []string{"ETHUSDT"},
+		MaxSilence:     30 * time.Second,
+		IdleTimeout:    5 * time.Second,
+	}, "10s")
+
+	tw.trade("ETHUSDT", 1*time.Second, "50")
+	for at := time.Second; at <= 120*time.Second; at += 20 * time.Second {
+		tw.trade("BTCUSDT", at, "100")
+		tw.wa.advanceIdle(context.Background())
+	}
+
+	eth := tw.windows("ETHUSDT", "10s")
+	// Последняя плоская свеча начинается раньше, чем через MaxSilence после сделки
+	if got, want := starts(eth), []int{0, 10, 20, 30}; !slices.Equal(got, want) {
+		t.Errorf("ETHUSDT starts = %v, want %v", got, want)
+	}
+	if _, ok := tw.wa.symbols["ETHUSDT"]; ok {
+		t.Error("retired ETHUSDT is still tracked")
+	}
+
+	for _, w := range tw.windows("BTCUSDT", "10s") {
+		if w.Synthetic {
+			t.Errorf("BTCUSDT is not in GapFillSymbols, got synthetic %s", w.StartTime.Sub(testStart))
+		}
+	}
+	if s := tw.wa.Stats(); s.Retired != 1 || s.Synthetic != 3 {
+		t.Errorf("stats = %+v, want Retired 1, Synthetic 3", s)
+	}
+}
+
+// lateTrades - сделка в закрытую свечу: [0,10s) закрывается сделкой на 12s
+func lateTrades(tw *testWindows) {
+	tw.trade("BTCUSDT", 1*time.Second, "100")
+	tw.trade("BTCUSDT", 12*time.Second, "101")
+	tw.trade("BTCUSDT", 5*time.Second, "150")
+}
+
+func TestLateDrop(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{}, "10s", "1m")
+	lateTrades(tw)
+
+	windows := tw.windows("BTCUSDT", "10s")
+	if len(windows) != 1 || windows[0].Trades != 1 || windows[0].High.String() != "100" {
+		t.Fatalf("10s windows at %v, want one candle without the late trade", starts(windows))
+	}
+	if s := tw.wa.Stats(); s.Late != 1 || s.Dropped != 1 || s.Revisions != 0 {
+		t.Errorf("stats = %+v, want 1 late, 1 dropped", s)
+	}
+
+	// Минутная свеча еще открыта, но отброшенная сделка не попадает и в нее:
+	// минута остается суммой 10s свечей
+	tw.trade("BTCUSDT", 62*time.Second, "102")
+	minute := tw.windows("BTCUSDT", "1m")
+	if len(minute) != 1 || minute[0].Trades != 2 || minute[0].High.String() != "101" {
+		t.Errorf("1m windows at %v, want one candle with 2 trades, high 101", starts(minute))
+	}
+}
+
+func TestLateUpdate(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{LatePolicy: LateUpdate, AllowedLateness: 5 * time.Second}, "10s", "1m")
+	lateTrades(tw)
+
+	windows := tw.windows("BTCUSDT", "10s")
+	if len(windows) != 2 {
+		t.Fatalf("10s windows = %d, want first release and revision", len(windows))
+	}
+	if rev := windows[1]; rev.Revision != 1 || rev.Trades != 2 || rev.High.String() != "150" || rev.Close.String() != "150" {
+		t.Errorf("revision = %+v, want revision 1 with both trades, close 150", rev)
+	}
+	if windows[0].Revision != 0 || windows[0].Trades != 1 {
+		t.Errorf("first release changed after emit: %+v", windows[0])
+	}
+
+	// После AllowedLateness свеча забыта: опоздавшая отбрасывается
+	tw.trade("BTCUSDT", 20*time.Second, "103")
+	tw.trade("BTCUSDT", 6*time.Second, "160")
+	if s := tw.wa.Stats(); s.Late != 2 || s.Updated != 1 || s.Dropped != 1 || s.Revisions != 1 {
+		t.Errorf("stats = %+v, want 2 late, 1 updated, 1 dropped, 1 revision", s)
+	}
+
+	// Обе опоздавшие попали в открытую минутную свечу, в том числе
+	// отброшенная для 10s
+	tw.trade("BTCUSDT", 62*time.Second, "104")
+	minute := tw.windows("BTCUSDT", "1m")
+	if len(minute) != 1 || minute[0].Trades != 5 || minute[0].High.String() != "160" {
+		t.Errorf("1m windows at %v, want one candle with 5 trades, high 160", starts(minute))
+	}
+}
+
+func TestLateSide(t *testing.T) {
+	tw := newTestWindows(t, WindowConfig{LatePolicy: LateSide}, "10s", "1m")
+	late := make(chan models.UniversalTrade, 1)
+	WithLateTrades(late)(tw.wa)
+	lateTrades(tw)
+
+	select {
+	case trade := <-late:
+		if trade.Price.String() != "150" {
+			t.Errorf("late trade price = %s, want 150", trade.Price)
+		}
+	default:
+		t.Fatal("late trade was not sent to the side channel")
+	}
+	if windows := tw.windows("BTCUSDT", "10s"); len(windows) != 1 || windows[0].Trades != 1 {
+		t.Errorf("10s windows at %v, want one candle without the late trade", starts(windows))
+	}
+	if s := tw.wa.Stats(); s.Late != 1 || s.Dropped != 1 {
+		t.Errorf("stats = %+v, want 1 late, 1 dropped", s)
+	}
+
+	// Ушедшая в боковой канал сделка не учтена ни в одной свече
+	tw.trade("BTCUSDT", 62*time.Second, "102")
+	if minute := tw.windows("BTCUSDT", "1m"); len(minute) != 1 || minute[0].Trades != 2 {
+		t.Errorf("1m windows at %v, want one candle with 2 trades", starts(minute))
+	}
+}
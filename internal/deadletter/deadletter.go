@@ -0,0 +1,249 @@
+// Package deadletter - сообщения, которые пайплайн не смог обработать:
+// сырой payload, этап и ошибка уходят в ограниченную очередь, а из нее в синки
+// (файл, Kafka), со счетчиками по причинам
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+)
+
+const (
+	defaultQueueSize      = 10000
+	defaultMaxPayload     = 64 << 10
+	defaultReportInterval = time.Minute
+)
+
+// Stage - этап, на котором сообщение отбраковано
+type Stage string
+
+const (
+	// Сообщение целиком не разобралось
+	StageDecode Stage = "decode"
+	// Сообщение разобралось, но его элемент не сконвертировался (тикер из массива)
+	StageConvert Stage = "convert"
+	// Событие разобралось, но не прошло проверку данных
+	StageValidate Stage = "validate"
+)
+
+// Причины для счетчиков
+const (
+	ReasonInvalidJSON   = "invalid_json"
+	ReasonWrongType     = "wrong_type"
+	ReasonInvalidNumber = "invalid_number"
+	ReasonOther         = "other"
+)
+
+// Letter - отбракованное сообщение
+type Letter struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Exchange   string    `json:"exchange,omitempty"`
+	Stage      Stage     `json:"stage"`
+	Reason     string    `json:"reason"`
+	Error      string    `json:"error"`
+	Payload    string    `json:"payload"`             // сырое сообщение, обрезается до MaxPayload
+	Truncated  bool      `json:"truncated,omitempty"` // payload обрезан
+}
+
+// Classify сводит ошибку разбора к короткой причине для счетчиков
+func Classify(err error) string {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ReasonInvalidJSON
+	case errors.As(err, &typeErr):
+		return ReasonWrongType
+	case errors.Is(err, decimal.ErrSyntax), errors.Is(err, decimal.ErrRange):
+		return ReasonInvalidNumber
+	default:
+		return ReasonOther
+	}
+}
+
+// Sink - куда пишутся отбракованные сообщения
+type Sink interface {
+	Write(ctx context.Context, l Letter) error
+	Close() error
+}
+
+type Config struct {
+	QueueSize      int           // сколько писем ждут записи, остальные отбрасываются
+	MaxPayload     int           // сколько байт payload сохранять
+	ReportInterval time.Duration // как часто писать в лог сводку счетчиков
+}
+
+// Stats - счетчики очереди. Ключ ByReason - "<stage>/<reason>"
+type Stats struct {
+	ByReason map[string]int64
+	Written  int64
+	Dropped  int64 // очередь была полна
+	Failed   int64 // синк вернул ошибку
+}
+
+// Queue принимает письма без блокировки и пишет их во все синки.
+// Вместо полного payload в логе ошибок - одна сводка счетчиков за интервал
+type Queue struct {
+	cfg     Config
+	sinks   []Sink
+	letters chan Letter
+
+	mu      sync.Mutex
+	stats   Stats
+	changed bool
+}
+
+func NewQueue(cfg Config, sinks ...Sink) *Queue {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MaxPayload <= 0 {
+		cfg.MaxPayload = defaultMaxPayload
+	}
+	if cfg.ReportInterval <= 0 {
+		cfg.ReportInterval = defaultReportInterval
+	}
+
+	return &Queue{
+		cfg:     cfg,
+		sinks:   sinks,
+		letters: make(chan Letter, cfg.QueueSize),
+		stats:   Stats{ByReason: make(map[string]int64)},
+	}
+}
+
+// Put ставит письмо в очередь: счетчик причины растет всегда,
+// а если очередь полна, само письмо отбрасывается
+func (q *Queue) Put(l Letter) {
+	if l.ReceivedAt.IsZero() {
+		l.ReceivedAt = time.Now()
+	}
+	if len(l.Payload) > q.cfg.MaxPayload {
+		l.Payload = truncate(l.Payload, q.cfg.MaxPayload)
+		l.Truncated = true
+	}
+
+	q.mu.Lock()
+	q.stats.ByReason[string(l.Stage)+"/"+l.Reason]++
+	q.changed = true
+	q.mu.Unlock()
+
+	select {
+	case q.letters <- l:
+	default:
+		q.mu.Lock()
+		q.stats.Dropped++
+		q.mu.Unlock()
+	}
+}
+
+// truncate обрезает s до n байт, не разрезая многобайтовый символ UTF-8
+func truncate(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := q.stats
+	s.ByReason = maps.Clone(q.stats.ByReason)
+	return s
+}
+
+// Start пишет письма до отмены контекста, затем дописывает очередь и закрывает синки
+func (q *Queue) Start(ctx context.Context) {
+	report := time.NewTicker(q.cfg.ReportInterval)
+	defer report.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.drain()
+			q.close()
+			q.report()
+			return
+
+		case l := <-q.letters:
+			q.write(ctx, l)
+
+		case <-report.C:
+			q.report()
+		}
+	}
+}
+
+// drain дописывает остаток очереди: контекст уже отменен, синкам нужен свой
+func (q *Queue) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for {
+		select {
+		case l := <-q.letters:
+			q.write(ctx, l)
+		default:
+			return
+		}
+	}
+}
+
+func (q *Queue) write(ctx context.Context, l Letter) {
+	failed := false
+	for _, sink := range q.sinks {
+		if err := sink.Write(ctx, l); err != nil {
+			failed = true
+			slog.Error("❌ Could not write dead letter", "error", err)
+		}
+	}
+
+	q.mu.Lock()
+	if failed {
+		q.stats.Failed++
+	} else {
+		q.stats.Written++
+	}
+	q.mu.Unlock()
+}
+
+func (q *Queue) close() {
+	for _, sink := range q.sinks {
+		if err := sink.Close(); err != nil {
+			slog.Error("Could not close dead letter sink", "error", err)
+		}
+	}
+}
+
+// report пишет сводку, если с прошлого раза были новые письма
+func (q *Queue) report() {
+	q.mu.Lock()
+	if !q.changed {
+		q.mu.Unlock()
+		return
+	}
+	q.changed = false
+	stats := q.stats
+	stats.ByReason = maps.Clone(q.stats.ByReason)
+	q.mu.Unlock()
+
+	attrs := make([]any, 0, 2*len(stats.ByReason)+6)
+	for reason, n := range stats.ByReason {
+		attrs = append(attrs, reason, n)
+	}
+	attrs = append(attrs, "written", stats.Written, "dropped", stats.Dropped, "failed", stats.Failed)
+	slog.Warn("☠️ Dead letters", attrs...)
+}
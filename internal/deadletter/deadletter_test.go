@@ -0,0 +1,38 @@
+package deadletter
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"abcdef", 3, "abc"},
+		{"цена", 4, "це"}, // граница символа
+		{"цена", 3, "ц"},  // середина второго символа
+		{"ц€", 4, "ц"},    // € - три байта
+		{"€€", 2, ""},     // первый символ не помещается
+		{"a😀b", 4, "a"},   // четыре байта
+		{"a😀b", 5, "a😀"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.in, tt.n)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPutTruncatesAtRune(t *testing.T) {
+	q := NewQueue(Config{MaxPayload: 7})
+	q.Put(Letter{Payload: `{"s":"цена"}`})
+
+	l := <-q.letters
+	if !l.Truncated || l.Payload != `{"s":"` {
+		t.Errorf("payload = %q truncated %v, want %q", l.Payload, l.Truncated, `{"s":"`)
+	}
+}
@@ -0,0 +1,126 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultFilePrefix  = "deadletter"
+	defaultMaxFileSize = 64 << 20
+)
+
+// FileSink пишет письма строками JSON в <dir>/<prefix>-<YYYYMMDD>-<seq>.jsonl.
+// Новый файл - каждые сутки или по достижении MaxFileSize
+type FileSink struct {
+	dir         string
+	prefix      string
+	maxFileSize int64
+
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+	fileDay time.Time
+}
+
+func NewFileSink(dir string, maxFileSize int64) (*FileSink, error) {
+	if dir == "" {
+		return nil, errors.New("dead letter dir is not set")
+	}
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create dead letter dir: %w", err)
+	}
+
+	return &FileSink{dir: dir, prefix: defaultFilePrefix, maxFileSize: maxFileSize}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, l Letter) error {
+	day := l.ReceivedAt.UTC().Truncate(24 * time.Hour)
+	if s.file == nil || !day.Equal(s.fileDay) || s.size >= s.maxFileSize {
+		if err := s.Close(); err != nil {
+			return err
+		}
+		if err := s.open(day); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	n, err := s.buf.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// Писем мало, а терять их при падении обидно - сбрасываем сразу
+	return s.buf.Flush()
+}
+
+func (s *FileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	err := errors.Join(s.buf.Flush(), s.file.Close())
+	s.file, s.buf = nil, nil
+	return err
+}
+
+// open создает новый файл; существующие никогда не перезаписываются
+func (s *FileSink) open(day time.Time) error {
+	for seq := 0; ; seq++ {
+		name := fmt.Sprintf("%s-%s-%04d.jsonl", s.prefix, day.Format("20060102"), seq)
+
+		file, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not open dead letter file: %w", err)
+		}
+
+		s.file = file
+		s.buf = bufio.NewWriter(file)
+		s.size = 0
+		s.fileDay = day
+		return nil
+	}
+}
+
+// ChanSink отдает письма в канал - например, kafka.Producer с топиком DLQ
+type ChanSink struct {
+	out chan<- Letter
+}
+
+func NewChanSink(out chan<- Letter) *ChanSink {
+	return &ChanSink{out: out}
+}
+
+func (s *ChanSink) Write(ctx context.Context, l Letter) error {
+	select {
+	case s.out <- l:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close закрывает канал: producer дописывает батч и останавливается
+func (s *ChanSink) Close() error {
+	close(s.out)
+	return nil
+}
@@ -0,0 +1,43 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/rest"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// BinanceBackfill догружает пропущенные aggTrade по REST
+// в том же виде, в каком они пришли бы из WebSocket
+type BinanceBackfill struct {
+	client *rest.Client
+}
+
+func NewBinanceBackfill(client *rest.Client) *BinanceBackfill {
+	return &BinanceBackfill{client: client}
+}
+
+func (b *BinanceBackfill) AggTrades(ctx context.Context, symbol string, fromID int64, limit int) ([]models.UniversalTrade, error) {
+	raw, err := b.client.AggTrades(ctx, symbol, fromID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	trades := make([]models.UniversalTrade, 0, len(raw))
+	for _, t := range raw {
+		t.EventType = websocket.AggTrade
+		t.Symbol = strings.ToUpper(symbol)
+		t.EventTime = t.TradeTime
+
+		trade, err := convertAggTradeToUniversalTrade(t)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert AggTrade %d: %w", t.AggregateTradeID, err)
+		}
+		trade.Backfilled = true
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
@@ -0,0 +1,272 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// BinanceAdapter - Binance Spot: стримы в адресе подключения или через SUBSCRIBE,
+// ping присылает сервер, данные - события с полем "e"
+type BinanceAdapter struct {
+	websocket.BinanceProtocol
+	baseURL string
+}
+
+func NewBinance(baseURL string) *BinanceAdapter {
+	if baseURL == "" {
+		baseURL = websocket.BaseURL
+	}
+	return &BinanceAdapter{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (b *BinanceAdapter) Name() string {
+	return Binance
+}
+
+func (b *BinanceAdapter) StreamName(symbol string, kind websocket.StreamKind) (string, error) {
+	if kind.IsMarketWide() {
+		symbol = ""
+	}
+
+	st := websocket.NewStream(symbol, kind)
+	if err := st.Validate(); err != nil {
+		return "", err
+	}
+	return st.Name(), nil
+}
+
+// Endpoint - у Binance стримы передаются прямо в адресе подключения
+func (b *BinanceAdapter) Endpoint(streams []string) (string, []string, error) {
+	parsed, err := websocket.ParseStreams(streams)
+	if err != nil {
+		return "", nil, err
+	}
+
+	url, err := websocket.BuildURL(b.baseURL, parsed)
+	if err != nil {
+		return "", nil, err
+	}
+	return url, nil, nil
+}
+
+func (b *BinanceAdapter) SubscribeEndpoint() string {
+	return b.baseURL + "/stream"
+}
+
+// Heartbeat - Binance сам присылает ping, отвечаем на них в клиенте;
+// свои пинги обычные, по интервалу watchdog
+func (b *BinanceAdapter) Heartbeat() websocket.Heartbeat {
+	return websocket.Heartbeat{}
+}
+
+func (b *BinanceAdapter) Decode(rawMsg []byte) ([]models.UniversalTrade, error) {
+	return b.parse(rawMsg)
+}
+
+// arrayRoutingKey - все массивы (!miniTicker@arr) идут одной очередью:
+// первый символ массива от сообщения к сообщению разный
+var arrayRoutingKey = []byte("[")
+
+// RoutingKey - символ "s": порядок сохраняется по символу во всех его стримах,
+// в combined- и raw-сообщениях одинаково
+func (b *BinanceAdapter) RoutingKey(rawMsg []byte) []byte {
+	data := bytes.TrimLeft(rawMsg, " \t\r\n")
+	if len(data) == 0 || data[0] == '[' {
+		return arrayRoutingKey
+	}
+	if bytes.HasPrefix(data, []byte(`{"stream"`)) {
+		if bytes.HasSuffix(peekField(data, "stream"), []byte("@arr")) {
+			return arrayRoutingKey
+		}
+	}
+	return peekField(data, "s")
+}
+
+// binanceEnvelope - combined-сообщение {"stream":"...","data":...}.
+// data не разбирается: его тип определяется по полю "e" (см. peekEventType),
+// а у bookTicker, где "e" нет, - по имени стрима
+type binanceEnvelope struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// parse разбирает сообщение за один проход по каждому уровню:
+// конверт -> тип события по "e" без разбора -> сразу в конкретную структуру.
+// Поддерживаются combined (/stream) и raw (/ws) сообщения, объекты и массивы
+func (b *BinanceAdapter) parse(rawMsg []byte) ([]models.UniversalTrade, error) {
+	data := bytes.TrimLeft(rawMsg, " \t\r\n")
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+
+	var stream string
+	if bytes.HasPrefix(data, []byte(`{"stream"`)) {
+		var env binanceEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			return nil, fmt.Errorf("could not parse JSON: %w", err)
+		}
+		if len(env.Data) == 0 {
+			return nil, fmt.Errorf("no data field found")
+		}
+		data = env.Data
+		stream = env.Stream
+	}
+
+	// !miniTicker@arr - массив тикеров
+	if data[0] == '[' {
+		var tickersArray []models.MiniTicker
+		if err := json.Unmarshal(data, &tickersArray); err != nil {
+			return nil, fmt.Errorf("could not parse ticker array: %w", err)
+		}
+		return b.parseTickerArray(tickersArray)
+	}
+
+	eventType, ok := peekEventType(data)
+	if !ok && isBookTicker(stream, data) {
+		eventType, ok = websocket.BookTicker, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("no event type field found")
+	}
+
+	var (
+		unTrade models.UniversalTrade
+		err     error
+	)
+
+	switch eventType {
+	case websocket.AggTrade:
+		var aggTrade models.AggTrade
+		if err := json.Unmarshal(data, &aggTrade); err != nil {
+			return nil, fmt.Errorf("could not parse AggTrade: %w", err)
+		}
+
+		unTrade, err = convertAggTradeToUniversalTrade(aggTrade)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert AggTrade: %w", err)
+		}
+
+	case websocket.Trade:
+		var trade models.Trade
+		if err := json.Unmarshal(data, &trade); err != nil {
+			return nil, fmt.Errorf("could not parse Trade: %w", err)
+		}
+
+		unTrade, err = convertTradeToUniversalTrade(trade)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert Trade: %w", err)
+		}
+
+	case websocket.MiniTicker:
+		var miniTicker models.MiniTicker
+		if err := json.Unmarshal(data, &miniTicker); err != nil {
+			return nil, fmt.Errorf("could not parse MiniTicker: %w", err)
+		}
+
+		unTrade, err = convertMiniTickerToUniversalTrade(miniTicker)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert MiniTicker: %w", err)
+		}
+
+	case websocket.Kline:
+		var kline models.Kline
+		if err := json.Unmarshal(data, &kline); err != nil {
+			return nil, fmt.Errorf("could not parse Kline: %w", err)
+		}
+
+		unTrade, err = convertKlineToUniversalTrade(kline)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert Kline: %w", err)
+		}
+
+	case websocket.BookTicker:
+		var bookTicker models.BookTicker
+		if err := json.Unmarshal(data, &bookTicker); err != nil {
+			return nil, fmt.Errorf("could not parse BookTicker: %w", err)
+		}
+
+		unTrade, err = convertBookTickerToUniversalTrade(bookTicker)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert BookTicker: %w", err)
+		}
+
+	case websocket.DepthUpdate:
+		var depth models.DepthUpdate
+		if err := json.Unmarshal(data, &depth); err != nil {
+			return nil, fmt.Errorf("could not parse DepthUpdate: %w", err)
+		}
+
+		unTrade, err = convertDepthUpdateToUniversalTrade(depth)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert DepthUpdate: %w", err)
+		}
+
+	default:
+		slog.Warn("Unknown even type received", "type", eventType)
+		return nil, nil
+	}
+
+	return []models.UniversalTrade{unTrade}, nil
+}
+
+// peekEventType достает значение "e" без разбора JSON.
+// Binance ставит "e" первым полем события, поэтому обычно хватает проверки префикса;
+// иначе ищем ключ по всему объекту (вложенных объектов с "e" в событиях нет)
+func peekEventType(data []byte) (string, bool) {
+	rest, ok := bytes.CutPrefix(data, []byte(`{"e":"`))
+	if !ok {
+		i := bytes.Index(data, []byte(`"e":"`))
+		if i < 0 {
+			return "", false
+		}
+		rest = data[i+len(`"e":"`):]
+	}
+
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return "", false
+	}
+	return string(rest[:end]), true
+}
+
+// isBookTicker - spot bookTicker приходит без "e": в combined-режиме его выдает
+// имя стрима, в raw (/ws) - набор полей {"u","s","b","B","a","A"}
+func isBookTicker(stream string, data []byte) bool {
+	if stream != "" {
+		return strings.HasSuffix(stream, "@"+string(websocket.KindBookTicker))
+	}
+	return bytes.Contains(data, []byte(`"u":`)) &&
+		bytes.Contains(data, []byte(`"B":`)) &&
+		bytes.Contains(data, []byte(`"A":`))
+}
+
+// parseTickerArray конвертирует тикеры массива. Невалидные тикеры
+// отбрасываются и возвращаются в *models.PartialError вместе с удачными
+func (b *BinanceAdapter) parseTickerArray(tickers []models.MiniTicker) ([]models.UniversalTrade, error) {
+	trades := make([]models.UniversalTrade, 0, len(tickers))
+	var partial *models.PartialError
+
+	for _, ticker := range tickers {
+		trade, err := convertMiniTickerToUniversalTrade(ticker)
+		if err != nil {
+			if partial == nil {
+				partial = &models.PartialError{}
+			}
+			raw, _ := json.Marshal(ticker)
+			partial.Skipped = append(partial.Skipped, models.SkippedItem{Raw: raw, Err: err})
+			continue
+		}
+		trades = append(trades, trade)
+	}
+
+	if partial != nil {
+		return trades, partial
+	}
+	return trades, nil
+}
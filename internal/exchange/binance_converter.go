@@ -0,0 +1,183 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+func convertAggTradeToUniversalTrade(model models.AggTrade) (models.UniversalTrade, error) {
+	price, err := decimal.Parse(model.Price)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	quantity, err := decimal.Parse(model.Quantity)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	// Время сделки, а не отправки: по нему сделка попадает в свечу
+	ts := model.TradeTime
+	if ts == 0 {
+		ts = model.EventTime
+	}
+
+	return models.UniversalTrade{
+		Exchange:     Binance,
+		Symbol:       model.Symbol,
+		Timestamp:    time.UnixMilli(ts),
+		EventType:    model.EventType,
+		Price:        price,
+		Quantity:     quantity,
+		IsBuyerMaker: model.IsBuyer,
+		AggTradeID:   model.AggregateTradeID,
+		FirstTradeID: model.FirstTradeID,
+		LastTradeID:  model.LastTradeID,
+	}, nil
+}
+
+// convertTradeToUniversalTrade - время берем из самой сделки: для
+// отдельных сделок важен момент исполнения, а не отправки события
+func convertTradeToUniversalTrade(model models.Trade) (models.UniversalTrade, error) {
+	price, err := decimal.Parse(model.Price)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	quantity, err := decimal.Parse(model.Quantity)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:      Binance,
+		Symbol:        model.Symbol,
+		Timestamp:     time.UnixMilli(model.TradeTime),
+		EventType:     model.EventType,
+		Price:         price,
+		Quantity:      quantity,
+		IsBuyerMaker:  model.IsBuyer,
+		TradeID:       model.TradeID,
+		BuyerOrderID:  model.BuyerOrderID,
+		SellerOrderID: model.SellerOrderID,
+	}, nil
+}
+
+func convertMiniTickerToUniversalTrade(model models.MiniTicker) (models.UniversalTrade, error) {
+	cPrice, err := decimal.Parse(model.ClosePrice)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	oPrice, err := decimal.Parse(model.OpenPrice)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	hPrice, err := decimal.Parse(model.HighPrice)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	lPrice, err := decimal.Parse(model.LowPrice)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	volume, err := decimal.Parse(model.TotalBaseVol)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	quoteVolume, err := decimal.Parse(model.TotalQuoteVol)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:    Binance,
+		Symbol:      model.Symbol,
+		Timestamp:   time.UnixMilli(model.EventTime),
+		EventType:   model.EventType,
+		Price:       cPrice,
+		OpenPrice:   oPrice,
+		HighPrice:   hPrice,
+		LowPrice:    lPrice,
+		Volume:      volume,
+		QuoteVolume: quoteVolume,
+	},
+	nil
+}
+
+// convertKlineToUniversalTrade - цена закрытия идет в Price: пока свеча
+// не закрыта (x=false), это текущая цена
+func convertKlineToUniversalTrade(model models.Kline) (models.UniversalTrade, error) {
+	k := model.Kline
+
+	v, err := parseDecimals(k.OpenPrice, k.HighPrice, k.LowPrice, k.ClosePrice, k.BaseVolume, k.QuoteVolume)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:    Binance,
+		Symbol:      model.Symbol,
+		Timestamp:   time.UnixMilli(model.EventTime),
+		EventType:   model.EventType,
+		OpenPrice:   v[0],
+		HighPrice:   v[1],
+		LowPrice:    v[2],
+		Price:       v[3],
+		Volume:      v[4],
+		QuoteVolume: v[5],
+		Interval:    k.Interval,
+		OpenTime:    time.UnixMilli(k.StartTime),
+		CloseTime:   time.UnixMilli(k.CloseTime),
+		Closed:      k.IsClosed,
+		TradeCount:  k.Trades,
+	}, nil
+}
+
+// convertBookTickerToUniversalTrade - у spot bookTicker нет времени события,
+// поэтому берем время получения
+func convertBookTickerToUniversalTrade(model models.BookTicker) (models.UniversalTrade, error) {
+	v, err := parseDecimals(model.BidPrice, model.BidQty, model.AskPrice, model.AskQty)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	ts := time.Now()
+	if model.EventTime > 0 {
+		ts = time.UnixMilli(model.EventTime)
+	}
+
+	return models.UniversalTrade{
+		Exchange:  Binance,
+		Symbol:    model.Symbol,
+		Timestamp: ts,
+		EventType: websocket.BookTicker,
+		BidPrice:  v[0],
+		BidQty:    v[1],
+		AskPrice:  v[2],
+		AskQty:    v[3],
+		UpdateID:  model.UpdateID,
+	}, nil
+}
+
+func convertDepthUpdateToUniversalTrade(model models.DepthUpdate) (models.UniversalTrade, error) {
+	bids, err := models.ParseLevels(model.Bids)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	asks, err := models.ParseLevels(model.Asks)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:      Binance,
+		Symbol:        model.Symbol,
+		Timestamp:     time.UnixMilli(model.EventTime),
+		EventType:     model.EventType,
+		FirstUpdateID: model.FirstUpdateID,
+		UpdateID:      model.FinalUpdateID,
+		Bids:          bids,
+		Asks:          asks,
+	}, nil
+}
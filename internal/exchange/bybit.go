@@ -0,0 +1,330 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// BybitURL - публичный spot endpoint Bybit v5
+const BybitURL = "wss://stream.bybit.com/v5/public/spot"
+
+const (
+	// Bybit закрывает соединение без ping дольше 10 минут, рекомендует каждые 20с
+	bybitPingInterval = 20 * time.Second
+	// Для spot в одном запросе не больше 10 топиков
+	bybitMaxArgs = 10
+)
+
+// Топики: publicTrade.BTCUSDT, tickers.BTCUSDT, kline.1.BTCUSDT, orderbook.1.BTCUSDT
+var bybitTopicRe = regexp.MustCompile(`^(publicTrade|tickers|kline\.(1|3|5|15|30|60|120|240|360|720|D|W|M)|orderbook\.(1|50|200))\.[A-Z0-9]+$`)
+
+// Интервалы Binance -> Bybit
+var bybitIntervals = map[string]string{
+	"1m": "1", "3m": "3", "5m": "5", "15m": "15", "30m": "30",
+	"1h": "60", "2h": "120", "4h": "240", "6h": "360", "12h": "720",
+	"1d": "D", "1w": "W", "1M": "M",
+}
+
+var bybitPing = []byte(`{"op":"ping"}`)
+
+// BybitAdapter - Bybit v5 public spot: все подписки запросами {"op":"subscribe"},
+// heartbeat - {"op":"ping"} со стороны клиента
+type BybitAdapter struct {
+	url string
+}
+
+func NewBybit(baseURL string) *BybitAdapter {
+	if baseURL == "" {
+		baseURL = BybitURL
+	}
+	return &BybitAdapter{url: baseURL}
+}
+
+func (b *BybitAdapter) Name() string {
+	return Bybit
+}
+
+func (b *BybitAdapter) StreamName(symbol string, kind websocket.StreamKind) (string, error) {
+	symbol = strings.ToUpper(symbol)
+
+	switch kind {
+	case websocket.KindAggTrade, websocket.KindTrade:
+		return "publicTrade." + symbol, nil
+	case websocket.KindMiniTicker:
+		return "tickers." + symbol, nil
+	case websocket.KindBookTicker:
+		return "orderbook.1." + symbol, nil
+	}
+
+	if interval, ok := strings.CutPrefix(string(kind), "kline_"); ok {
+		if bi, ok := bybitIntervals[interval]; ok {
+			return "kline." + bi + "." + symbol, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s %q", ErrUnsupportedKind, Bybit, kind)
+}
+
+func (b *BybitAdapter) Endpoint(streams []string) (string, []string, error) {
+	for _, name := range streams {
+		if err := b.ValidateStream(name); err != nil {
+			return "", nil, err
+		}
+	}
+	return b.url, streams, nil
+}
+
+func (b *BybitAdapter) SubscribeEndpoint() string {
+	return b.url
+}
+
+func (b *BybitAdapter) Heartbeat() websocket.Heartbeat {
+	return websocket.Heartbeat{Interval: bybitPingInterval, Payload: bybitPing}
+}
+
+// ==================== Протокол подписок ====================
+
+type bybitRequest struct {
+	ReqID string   `json:"req_id"`
+	Op    string   `json:"op"`
+	Args  []string `json:"args"`
+}
+
+type bybitResponse struct {
+	Success bool   `json:"success"`
+	RetMsg  string `json:"ret_msg"`
+	ReqID   string `json:"req_id"`
+	Op      string `json:"op"`
+}
+
+func (b *BybitAdapter) EncodeRequest(method websocket.Method, id int64, streams []string) ([][]byte, error) {
+	var op string
+	switch method {
+	case websocket.MethodSubscribe:
+		op = "subscribe"
+	case websocket.MethodUnsubscribe:
+		op = "unsubscribe"
+	default:
+		return nil, fmt.Errorf("%s %s: %w", Bybit, method, websocket.ErrUnsupported)
+	}
+
+	frame, err := json.Marshal(bybitRequest{
+		ReqID: strconv.FormatInt(id, 10),
+		Op:    op,
+		Args:  streams,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{frame}, nil
+}
+
+// DecodeResponse - ответы это объекты с "op" и без "topic":
+// {"success":true,"ret_msg":"","conn_id":"...","req_id":"1","op":"subscribe"}
+func (b *BybitAdapter) DecodeResponse(msg []byte) (websocket.Response, bool) {
+	if len(msg) == 0 || msg[0] != '{' ||
+		!bytes.Contains(msg, []byte(`"op"`)) ||
+		bytes.Contains(msg, []byte(`"topic"`)) {
+		return websocket.Response{}, false
+	}
+
+	var resp bybitResponse
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return websocket.Response{}, false
+	}
+
+	// pong и ответы без нашего req_id ни к какому запросу не относятся
+	id, err := strconv.ParseInt(resp.ReqID, 10, 64)
+	if resp.Op == "ping" || resp.Op == "pong" || err != nil {
+		return websocket.Response{}, true
+	}
+
+	r := websocket.Response{ID: id, HasID: true}
+	if !resp.Success {
+		r.Err = &websocket.ResponseError{Msg: resp.RetMsg}
+	}
+	return r, true
+}
+
+func (b *BybitAdapter) AcksByID() bool {
+	return true
+}
+
+func (b *BybitAdapter) MaxStreamsPerRequest() int {
+	return bybitMaxArgs
+}
+
+func (b *BybitAdapter) ValidateStream(name string) error {
+	if !bybitTopicRe.MatchString(name) {
+		return fmt.Errorf("%w: %s %q", websocket.ErrInvalidStream, Bybit, name)
+	}
+	return nil
+}
+
+// ==================== Разбор сообщений ====================
+
+// RoutingKey - топик: publicTrade.BTCUSDT, tickers.BTCUSDT, ...
+func (b *BybitAdapter) RoutingKey(rawMsg []byte) []byte {
+	return peekField(rawMsg, "topic")
+}
+
+// bybitEnvelope - сообщение публичного стрима:
+// {"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":...,"data":[...]}
+// data - массив для publicTrade и объект для tickers и orderbook
+type bybitEnvelope struct {
+	Topic string          `json:"topic"`
+	Ts    int64           `json:"ts"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (b *BybitAdapter) Decode(rawMsg []byte) ([]models.UniversalTrade, error) {
+	var env bybitEnvelope
+	if err := json.Unmarshal(rawMsg, &env); err != nil {
+		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	}
+
+	channel, _, _ := strings.Cut(env.Topic, ".")
+
+	switch channel {
+	case "publicTrade":
+		var trades []models.BybitTrade
+		if err := json.Unmarshal(env.Data, &trades); err != nil {
+			return nil, fmt.Errorf("could not parse publicTrade: %w", err)
+		}
+
+		return parseBybitTrades(trades)
+
+	case "tickers":
+		var ticker models.BybitTicker
+		if err := json.Unmarshal(env.Data, &ticker); err != nil {
+			return nil, fmt.Errorf("could not parse tickers: %w", err)
+		}
+
+		trade, err := convertBybitTicker(ticker, env.Ts)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert tickers: %w", err)
+		}
+		return []models.UniversalTrade{trade}, nil
+
+	case "orderbook":
+		// Лучшие цены есть только в orderbook.1, в глубоких стаканах приходят дельты
+		if !strings.HasPrefix(env.Topic, "orderbook.1.") {
+			return nil, nil
+		}
+
+		var book models.BybitOrderbook
+		if err := json.Unmarshal(env.Data, &book); err != nil {
+			return nil, fmt.Errorf("could not parse orderbook: %w", err)
+		}
+
+		trade, ok, err := convertBybitBook(book, env.Ts)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert orderbook: %w", err)
+		}
+		if !ok {
+			return nil, nil
+		}
+		return []models.UniversalTrade{trade}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// parseBybitTrades конвертирует сделки сообщения. Невалидные сделки
+// отбрасываются и возвращаются в *models.PartialError вместе с удачными
+func parseBybitTrades(trades []models.BybitTrade) ([]models.UniversalTrade, error) {
+	out := make([]models.UniversalTrade, 0, len(trades))
+	var partial *models.PartialError
+
+	for _, t := range trades {
+		trade, err := convertBybitTrade(t)
+		if err != nil {
+			if partial == nil {
+				partial = &models.PartialError{}
+			}
+			raw, _ := json.Marshal(t)
+			partial.Skipped = append(partial.Skipped, models.SkippedItem{
+				Raw: raw,
+				Err: fmt.Errorf("could not convert publicTrade: %w", err),
+			})
+			continue
+		}
+		out = append(out, trade)
+	}
+
+	if partial != nil {
+		return out, partial
+	}
+	return out, nil
+}
+
+// convertBybitTrade - сделки других бирж идут дальше как aggTrade:
+// для пайплайна это просто сделка
+func convertBybitTrade(t models.BybitTrade) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.Price, t.Quantity)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:     Bybit,
+		Symbol:       t.Symbol,
+		Timestamp:    time.UnixMilli(t.TradeTime),
+		EventType:    websocket.AggTrade,
+		Price:        v[0],
+		Quantity:     v[1],
+		IsBuyerMaker: t.Side == "Sell", // тейкер продавал - значит мейкер покупал
+	}, nil
+}
+
+func convertBybitTicker(t models.BybitTicker, ts int64) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.LastPrice, t.PrevPrice24h, t.HighPrice24h, t.LowPrice24h, t.Volume24h, t.Turnover24h)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:    Bybit,
+		Symbol:      t.Symbol,
+		Timestamp:   time.UnixMilli(ts),
+		EventType:   websocket.MiniTicker,
+		Price:       v[0],
+		OpenPrice:   v[1],
+		HighPrice:   v[2],
+		LowPrice:    v[3],
+		Volume:      v[4],
+		QuoteVolume: v[5],
+	}, nil
+}
+
+// convertBybitBook - пустая сторона (рынок без заявок) лучших цен не дает
+func convertBybitBook(b models.BybitOrderbook, ts int64) (models.UniversalTrade, bool, error) {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 || len(b.Bids[0]) < 2 || len(b.Asks[0]) < 2 {
+		return models.UniversalTrade{}, false, nil
+	}
+
+	v, err := parseDecimals(b.Bids[0][0], b.Bids[0][1], b.Asks[0][0], b.Asks[0][1])
+	if err != nil {
+		return models.UniversalTrade{}, false, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:  Bybit,
+		Symbol:    b.Symbol,
+		Timestamp: time.UnixMilli(ts),
+		EventType: websocket.BookTicker,
+		BidPrice:  v[0],
+		BidQty:    v[1],
+		AskPrice:  v[2],
+		AskQty:    v[3],
+		UpdateID:  b.UpdateID,
+	}, true, nil
+}
@@ -0,0 +1,38 @@
+package exchange
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// Невалидная сделка отбрасывается, остальные сделки сообщения проходят
+func TestBybitDecodePartial(t *testing.T) {
+	msg := []byte(`{"topic":"publicTrade.BTCUSDT","type":"snapshot","ts":1700000000000,"data":[
+		{"T":1700000000000,"s":"BTCUSDT","S":"Buy","v":"0.5","p":"37000.1","i":"1"},
+		{"T":1700000000001,"s":"BTCUSDT","S":"Sell","v":"0.1","p":"oops","i":"2"},
+		{"T":1700000000002,"s":"BTCUSDT","S":"Sell","v":"0.2","p":"37000.2","i":"3"}]}`)
+
+	trades, err := NewBybit("").Decode(msg)
+
+	var partial *models.PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("Decode error = %v, want *models.PartialError", err)
+	}
+	if len(partial.Skipped) != 1 {
+		t.Errorf("skipped = %d, want 1", len(partial.Skipped))
+	}
+	if len(trades) != 2 {
+		t.Fatalf("trades = %d, want 2", len(trades))
+	}
+	if trades[1].Price.String() != "37000.2" || !trades[1].IsBuyerMaker {
+		t.Errorf("second trade = %s maker %v, want 37000.2 maker true", trades[1].Price, trades[1].IsBuyerMaker)
+	}
+
+	// Без ошибок - nil, а не пустой PartialError
+	ok := []byte(`{"topic":"publicTrade.BTCUSDT","ts":1,"data":[{"T":1,"s":"BTCUSDT","S":"Buy","v":"1","p":"2","i":"1"}]}`)
+	if _, err := NewBybit("").Decode(ok); err != nil {
+		t.Errorf("Decode error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,275 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// CoinbaseURL - market data endpoint Coinbase Advanced Trade
+const CoinbaseURL = "wss://advanced-trade-ws.coinbase.com"
+
+const coinbaseMaxProducts = 100
+
+// Стримы Coinbase записываем как channel:product_id, например market_trades:BTC-USD
+var coinbaseStreamRe = regexp.MustCompile(`^(market_trades|ticker|ticker_batch|level2|candles):[A-Z0-9]+-[A-Z0-9]+$`)
+
+// CoinbaseAdapter - Coinbase Advanced Trade: один канал на запрос
+// {"type":"subscribe","channel":"...","product_ids":[...]}, подтверждений по id нет.
+// Чтобы соединение не закрывали на тихих рынках, вместе с подпиской
+// открывается канал heartbeats
+type CoinbaseAdapter struct {
+	url string
+}
+
+func NewCoinbase(baseURL string) *CoinbaseAdapter {
+	if baseURL == "" {
+		baseURL = CoinbaseURL
+	}
+	return &CoinbaseAdapter{url: baseURL}
+}
+
+func (c *CoinbaseAdapter) Name() string {
+	return Coinbase
+}
+
+func (c *CoinbaseAdapter) StreamName(symbol string, kind websocket.StreamKind) (string, error) {
+	symbol = strings.ToUpper(symbol)
+
+	switch kind {
+	case websocket.KindAggTrade, websocket.KindTrade:
+		return "market_trades:" + symbol, nil
+	case websocket.KindMiniTicker:
+		return "ticker:" + symbol, nil
+	case websocket.KindKline("5m"):
+		// Coinbase отдает только пятиминутные свечи
+		return "candles:" + symbol, nil
+	}
+	return "", fmt.Errorf("%w: %s %q", ErrUnsupportedKind, Coinbase, kind)
+}
+
+func (c *CoinbaseAdapter) Endpoint(streams []string) (string, []string, error) {
+	for _, name := range streams {
+		if err := c.ValidateStream(name); err != nil {
+			return "", nil, err
+		}
+	}
+	return c.url, streams, nil
+}
+
+func (c *CoinbaseAdapter) SubscribeEndpoint() string {
+	return c.url
+}
+
+// Heartbeat - обычные WebSocket ping, живость обеспечивает канал heartbeats
+func (c *CoinbaseAdapter) Heartbeat() websocket.Heartbeat {
+	return websocket.Heartbeat{}
+}
+
+// ==================== Протокол подписок ====================
+
+type coinbaseRequest struct {
+	Type       string   `json:"type"`
+	Channel    string   `json:"channel"`
+	ProductIDs []string `json:"product_ids,omitempty"`
+}
+
+type coinbaseControl struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Message string `json:"message"`
+}
+
+func (c *CoinbaseAdapter) EncodeRequest(method websocket.Method, _ int64, streams []string) ([][]byte, error) {
+	var typ string
+	switch method {
+	case websocket.MethodSubscribe:
+		typ = "subscribe"
+	case websocket.MethodUnsubscribe:
+		typ = "unsubscribe"
+	default:
+		return nil, fmt.Errorf("%s %s: %w", Coinbase, method, websocket.ErrUnsupported)
+	}
+
+	// Группируем продукты по каналам, сохраняя порядок каналов
+	var channels []string
+	products := make(map[string][]string)
+	for _, name := range streams {
+		channel, product, _ := strings.Cut(name, ":")
+		if _, ok := products[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		products[channel] = append(products[channel], product)
+	}
+
+	requests := make([]coinbaseRequest, 0, len(channels)+1)
+	for _, channel := range channels {
+		requests = append(requests, coinbaseRequest{Type: typ, Channel: channel, ProductIDs: products[channel]})
+	}
+	if method == websocket.MethodSubscribe {
+		requests = append(requests, coinbaseRequest{Type: typ, Channel: "heartbeats"})
+	}
+
+	frames := make([][]byte, 0, len(requests))
+	for _, req := range requests {
+		frame, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// DecodeResponse - у Coinbase нет ответов по id: подтверждения (канал
+// subscriptions), heartbeats и ошибки просто не пускаем дальше
+func (c *CoinbaseAdapter) DecodeResponse(msg []byte) (websocket.Response, bool) {
+	if len(msg) == 0 || msg[0] != '{' {
+		return websocket.Response{}, false
+	}
+	if !bytes.Contains(msg, []byte(`"subscriptions"`)) &&
+		!bytes.Contains(msg, []byte(`"heartbeats"`)) &&
+		!bytes.Contains(msg, []byte(`"error"`)) {
+		return websocket.Response{}, false
+	}
+
+	var ctl coinbaseControl
+	if err := json.Unmarshal(msg, &ctl); err != nil {
+		return websocket.Response{}, false
+	}
+
+	switch {
+	case ctl.Type == "error":
+		slog.Warn("⚠️ Coinbase rejected request", "message", ctl.Message)
+		return websocket.Response{}, true
+	case ctl.Channel == "subscriptions", ctl.Channel == "heartbeats":
+		return websocket.Response{}, true
+	}
+	return websocket.Response{}, false
+}
+
+func (c *CoinbaseAdapter) AcksByID() bool {
+	return false
+}
+
+func (c *CoinbaseAdapter) MaxStreamsPerRequest() int {
+	return coinbaseMaxProducts
+}
+
+func (c *CoinbaseAdapter) ValidateStream(name string) error {
+	if !coinbaseStreamRe.MatchString(name) {
+		return fmt.Errorf("%w: %s %q", websocket.ErrInvalidStream, Coinbase, name)
+	}
+	return nil
+}
+
+// ==================== Разбор сообщений ====================
+
+// RoutingKey - канал: в одном сообщении бывают события разных продуктов
+func (c *CoinbaseAdapter) RoutingKey(rawMsg []byte) []byte {
+	return peekField(rawMsg, "channel")
+}
+
+type coinbaseEnvelope struct {
+	Channel   string          `json:"channel"`
+	Timestamp time.Time       `json:"timestamp"`
+	Events    json.RawMessage `json:"events"`
+}
+
+func (c *CoinbaseAdapter) Decode(rawMsg []byte) ([]models.UniversalTrade, error) {
+	var env coinbaseEnvelope
+	if err := json.Unmarshal(rawMsg, &env); err != nil {
+		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	}
+
+	switch env.Channel {
+	case "market_trades":
+		var events []models.CoinbaseTradesEvent
+		if err := json.Unmarshal(env.Events, &events); err != nil {
+			return nil, fmt.Errorf("could not parse market_trades: %w", err)
+		}
+
+		var out []models.UniversalTrade
+		for _, ev := range events {
+			for _, t := range ev.Trades {
+				trade, err := convertCoinbaseTrade(t)
+				if err != nil {
+					return nil, fmt.Errorf("could not convert market_trades: %w", err)
+				}
+				out = append(out, trade)
+			}
+		}
+		return out, nil
+
+	case "ticker", "ticker_batch":
+		var events []models.CoinbaseTickerEvent
+		if err := json.Unmarshal(env.Events, &events); err != nil {
+			return nil, fmt.Errorf("could not parse ticker: %w", err)
+		}
+
+		var out []models.UniversalTrade
+		for _, ev := range events {
+			for _, t := range ev.Tickers {
+				trade, err := convertCoinbaseTicker(t, env.Timestamp)
+				if err != nil {
+					return nil, fmt.Errorf("could not convert ticker: %w", err)
+				}
+				out = append(out, trade)
+			}
+		}
+		return out, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func convertCoinbaseTrade(t models.CoinbaseTrade) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.Price, t.Size)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:     Coinbase,
+		Symbol:       normalizeSymbol(t.ProductID),
+		Timestamp:    t.Time,
+		EventType:    websocket.AggTrade,
+		Price:        v[0],
+		Quantity:     v[1],
+		IsBuyerMaker: t.Side == "SELL",
+	}, nil
+}
+
+// convertCoinbaseTicker - цены открытия в тикере нет,
+// восстанавливаем ее по изменению за 24ч
+func convertCoinbaseTicker(t models.CoinbaseTicker, ts time.Time) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.Price, t.High24h, t.Low24h, t.Volume24h, t.PricePercentChg24h)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	// open = price * 100 / (100 + change%)
+	hundred := decimal.FromInt(100)
+	open := v[0].Mul(hundred).Div(hundred.Add(v[4]), v[0].Scale())
+
+	return models.UniversalTrade{
+		Exchange:  Coinbase,
+		Symbol:    normalizeSymbol(t.ProductID),
+		Timestamp: ts,
+		EventType: websocket.MiniTicker,
+		Price:     v[0],
+		OpenPrice: open,
+		HighPrice: v[1],
+		LowPrice:  v[2],
+		Volume:    v[3],
+	}, nil
+}
@@ -0,0 +1,117 @@
+// Package exchange - адаптеры бирж: куда подключаться, как подписываться,
+// как держать соединение живым и как разбирать сообщения в UniversalTrade
+package exchange
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const (
+	Binance  = "binance"
+	Bybit    = "bybit"
+	OKX      = "okx"
+	Coinbase = "coinbase"
+)
+
+// ErrUnknownExchange - адаптера для биржи нет
+var ErrUnknownExchange = errors.New("unknown exchange")
+
+// ErrUnsupportedKind - биржа не отдает такой тип данных
+var ErrUnsupportedKind = errors.New("stream kind is not supported by exchange")
+
+// Exchange - все, что пайплайну нужно знать о бирже.
+// Протокол подписок (websocket.Protocol) у каждой биржи свой
+type Exchange interface {
+	websocket.Protocol
+
+	Name() string
+	// StreamName - имя стрима на бирже для символа в ее формате
+	// ("BTCUSDT" у Bybit, "BTC-USDT" у OKX, "BTC-USD" у Coinbase)
+	StreamName(symbol string, kind websocket.StreamKind) (string, error)
+	// Endpoint возвращает адрес подключения для набора стримов и стримы,
+	// на которые нужно подписаться уже после подключения
+	Endpoint(streams []string) (url string, subscribe []string, err error)
+	// SubscribeEndpoint - адрес подключения без стримов, все подписки
+	// отправляются запросами (пул шардов)
+	SubscribeEndpoint() string
+	Heartbeat() websocket.Heartbeat
+	// Decode разбирает сообщение с данными в UniversalTrade.
+	// Неизвестные события пропускаются без ошибки. Если отброшена только
+	// часть сообщения, вместе с событиями возвращается *models.PartialError
+	Decode(rawMsg []byte) ([]models.UniversalTrade, error)
+	// RoutingKey достает из сообщения без разбора ключ его стрима
+	// (имя стрима, топик, инструмент). Сообщения с одним ключом процессор
+	// разбирает строго по порядку. nil - ключа нет
+	RoutingKey(rawMsg []byte) []byte
+}
+
+// New возвращает адаптер биржи по имени.
+// baseURL переопределяет адрес биржи (например, локальный mockexchange)
+func New(name, baseURL string) (Exchange, error) {
+	switch strings.ToLower(name) {
+	case "", Binance:
+		return NewBinance(baseURL), nil
+	case Bybit:
+		return NewBybit(baseURL), nil
+	case OKX:
+		return NewOKX(baseURL), nil
+	case Coinbase:
+		return NewCoinbase(baseURL), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownExchange, name)
+	}
+}
+
+// ClientOptions - настройки WSclient для работы с биржей
+func ClientOptions(ex Exchange) []websocket.Option {
+	return []websocket.Option{
+		websocket.WithProtocol(ex),
+		websocket.WithHeartbeat(ex.Heartbeat()),
+	}
+}
+
+// normalizeSymbol приводит символ к общему виду: "BTC-USDT" -> "BTCUSDT"
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.ReplaceAll(symbol, "-", ""))
+}
+
+// parseDecimals разбирает несколько чисел-строк за раз без потери точности
+func parseDecimals(values ...string) ([]decimal.Decimal, error) {
+	out := make([]decimal.Decimal, len(values))
+	for i, v := range values {
+		d, err := decimal.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = d
+	}
+	return out, nil
+}
+
+// peekField достает строковое значение поля без разбора JSON: первое
+// вхождение "field":"...". Экранированные кавычки в значениях ключей не встречаются
+func peekField(data []byte, field string) []byte {
+	prefix := make([]byte, 0, len(field)+5)
+	prefix = append(prefix, '"')
+	prefix = append(prefix, field...)
+	prefix = append(prefix, `":"`...)
+
+	i := bytes.Index(data, prefix)
+	if i < 0 {
+		return nil
+	}
+	rest := data[i+len(prefix):]
+
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return nil
+	}
+	return rest[:end]
+}
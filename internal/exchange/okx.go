@@ -0,0 +1,313 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// OKXURL - публичный endpoint OKX v5
+const OKXURL = "wss://ws.okx.com:8443/ws/v5/public"
+
+const (
+	// OKX закрывает соединение, если 30 секунд нет ни данных, ни "ping"
+	okxPingInterval = 25 * time.Second
+	okxMaxArgs      = 100
+)
+
+// Стримы OKX записываем как channel:instId, например trades:BTC-USDT.
+// Свечи на /ws/v5/public не отдаются (они на /business), поэтому их здесь нет
+var okxStreamRe = regexp.MustCompile(`^(trades|tickers|bbo-tbt|books5):[A-Z0-9]+(-[A-Z0-9]+)+$`)
+
+var okxPing = []byte("ping")
+
+// OKXAdapter - OKX v5 public: подписки {"op":"subscribe","args":[{channel,instId}]},
+// heartbeat - текстовый "ping", сервер отвечает "pong"
+type OKXAdapter struct {
+	url string
+}
+
+func NewOKX(baseURL string) *OKXAdapter {
+	if baseURL == "" {
+		baseURL = OKXURL
+	}
+	return &OKXAdapter{url: baseURL}
+}
+
+func (o *OKXAdapter) Name() string {
+	return OKX
+}
+
+func (o *OKXAdapter) StreamName(symbol string, kind websocket.StreamKind) (string, error) {
+	symbol = strings.ToUpper(symbol)
+
+	switch kind {
+	case websocket.KindAggTrade, websocket.KindTrade:
+		// trades у OKX агрегирован по заявке тейкера - как aggTrade у Binance
+		return "trades:" + symbol, nil
+	case websocket.KindMiniTicker:
+		return "tickers:" + symbol, nil
+	case websocket.KindBookTicker:
+		return "bbo-tbt:" + symbol, nil
+	}
+	return "", fmt.Errorf("%w: %s %q", ErrUnsupportedKind, OKX, kind)
+}
+
+func (o *OKXAdapter) Endpoint(streams []string) (string, []string, error) {
+	for _, name := range streams {
+		if err := o.ValidateStream(name); err != nil {
+			return "", nil, err
+		}
+	}
+	return o.url, streams, nil
+}
+
+func (o *OKXAdapter) SubscribeEndpoint() string {
+	return o.url
+}
+
+func (o *OKXAdapter) Heartbeat() websocket.Heartbeat {
+	return websocket.Heartbeat{Interval: okxPingInterval, Payload: okxPing}
+}
+
+// ==================== Протокол подписок ====================
+
+type okxRequest struct {
+	ID   string          `json:"id"`
+	Op   string          `json:"op"`
+	Args []models.OKXArg `json:"args"`
+}
+
+// okxEvent - подтверждение или ошибка:
+// {"id":"1","event":"subscribe","arg":{...},"connId":"..."}
+// {"id":"1","event":"error","code":"60012","msg":"..."}
+type okxEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Code  string `json:"code"`
+	Msg   string `json:"msg"`
+}
+
+func (o *OKXAdapter) EncodeRequest(method websocket.Method, id int64, streams []string) ([][]byte, error) {
+	var op string
+	switch method {
+	case websocket.MethodSubscribe:
+		op = "subscribe"
+	case websocket.MethodUnsubscribe:
+		op = "unsubscribe"
+	default:
+		return nil, fmt.Errorf("%s %s: %w", OKX, method, websocket.ErrUnsupported)
+	}
+
+	args := make([]models.OKXArg, 0, len(streams))
+	for _, name := range streams {
+		channel, instID, _ := strings.Cut(name, ":")
+		args = append(args, models.OKXArg{Channel: channel, InstID: instID})
+	}
+
+	frame, err := json.Marshal(okxRequest{
+		ID:   strconv.FormatInt(id, 10),
+		Op:   op,
+		Args: args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{frame}, nil
+}
+
+func (o *OKXAdapter) DecodeResponse(msg []byte) (websocket.Response, bool) {
+	if bytes.Equal(msg, []byte("pong")) {
+		return websocket.Response{}, true
+	}
+	if len(msg) == 0 || msg[0] != '{' || !bytes.Contains(msg, []byte(`"event"`)) {
+		return websocket.Response{}, false
+	}
+
+	var ev okxEvent
+	if err := json.Unmarshal(msg, &ev); err != nil {
+		return websocket.Response{}, false
+	}
+
+	id, err := strconv.ParseInt(ev.ID, 10, 64)
+	if err != nil {
+		// Служебные события (notice, channel-conn-count) без id
+		return websocket.Response{}, true
+	}
+
+	r := websocket.Response{ID: id, HasID: true}
+	if ev.Event == "error" {
+		code, _ := strconv.Atoi(ev.Code)
+		r.Err = &websocket.ResponseError{Code: code, Msg: ev.Msg}
+	}
+	return r, true
+}
+
+func (o *OKXAdapter) AcksByID() bool {
+	return true
+}
+
+func (o *OKXAdapter) MaxStreamsPerRequest() int {
+	return okxMaxArgs
+}
+
+func (o *OKXAdapter) ValidateStream(name string) error {
+	if !okxStreamRe.MatchString(name) {
+		return fmt.Errorf("%w: %s %q", websocket.ErrInvalidStream, OKX, name)
+	}
+	return nil
+}
+
+// ==================== Разбор сообщений ====================
+
+// RoutingKey - инструмент из arg: BTC-USDT
+func (o *OKXAdapter) RoutingKey(rawMsg []byte) []byte {
+	return peekField(rawMsg, "instId")
+}
+
+type okxEnvelope struct {
+	Arg  models.OKXArg   `json:"arg"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (o *OKXAdapter) Decode(rawMsg []byte) ([]models.UniversalTrade, error) {
+	var env okxEnvelope
+	if err := json.Unmarshal(rawMsg, &env); err != nil {
+		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	}
+
+	switch env.Arg.Channel {
+	case "trades":
+		var trades []models.OKXTrade
+		if err := json.Unmarshal(env.Data, &trades); err != nil {
+			return nil, fmt.Errorf("could not parse trades: %w", err)
+		}
+
+		out := make([]models.UniversalTrade, 0, len(trades))
+		for _, t := range trades {
+			trade, err := convertOKXTrade(t)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert trades: %w", err)
+			}
+			out = append(out, trade)
+		}
+		return out, nil
+
+	case "tickers":
+		var tickers []models.OKXTicker
+		if err := json.Unmarshal(env.Data, &tickers); err != nil {
+			return nil, fmt.Errorf("could not parse tickers: %w", err)
+		}
+
+		out := make([]models.UniversalTrade, 0, len(tickers))
+		for _, t := range tickers {
+			trade, err := convertOKXTicker(t)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert tickers: %w", err)
+			}
+			out = append(out, trade)
+		}
+		return out, nil
+
+	case "bbo-tbt":
+		var books []models.OKXBook
+		if err := json.Unmarshal(env.Data, &books); err != nil {
+			return nil, fmt.Errorf("could not parse bbo-tbt: %w", err)
+		}
+
+		out := make([]models.UniversalTrade, 0, len(books))
+		for _, b := range books {
+			trade, ok, err := convertOKXBook(b, env.Arg.InstID)
+			if err != nil {
+				return nil, fmt.Errorf("could not convert bbo-tbt: %w", err)
+			}
+			if ok {
+				out = append(out, trade)
+			}
+		}
+		return out, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func convertOKXTrade(t models.OKXTrade) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.Price, t.Quantity)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	ts, err := strconv.ParseInt(t.Ts, 10, 64)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:     OKX,
+		Symbol:       normalizeSymbol(t.InstID),
+		Timestamp:    time.UnixMilli(ts),
+		EventType:    websocket.AggTrade,
+		Price:        v[0],
+		Quantity:     v[1],
+		IsBuyerMaker: t.Side == "sell",
+	}, nil
+}
+
+func convertOKXTicker(t models.OKXTicker) (models.UniversalTrade, error) {
+	v, err := parseDecimals(t.Last, t.Open24h, t.High24h, t.Low24h, t.Vol24h, t.VolCcy24h)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+	ts, err := strconv.ParseInt(t.Ts, 10, 64)
+	if err != nil {
+		return models.UniversalTrade{}, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:    OKX,
+		Symbol:      normalizeSymbol(t.InstID),
+		Timestamp:   time.UnixMilli(ts),
+		EventType:   websocket.MiniTicker,
+		Price:       v[0],
+		OpenPrice:   v[1],
+		HighPrice:   v[2],
+		LowPrice:    v[3],
+		Volume:      v[4],
+		QuoteVolume: v[5],
+	}, nil
+}
+
+// convertOKXBook - инструмент есть только в arg конверта
+func convertOKXBook(b models.OKXBook, instID string) (models.UniversalTrade, bool, error) {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 || len(b.Bids[0]) < 2 || len(b.Asks[0]) < 2 {
+		return models.UniversalTrade{}, false, nil
+	}
+
+	v, err := parseDecimals(b.Bids[0][0], b.Bids[0][1], b.Asks[0][0], b.Asks[0][1])
+	if err != nil {
+		return models.UniversalTrade{}, false, err
+	}
+	ts, err := strconv.ParseInt(b.Ts, 10, 64)
+	if err != nil {
+		return models.UniversalTrade{}, false, err
+	}
+
+	return models.UniversalTrade{
+		Exchange:  OKX,
+		Symbol:    normalizeSymbol(instID),
+		Timestamp: time.UnixMilli(ts),
+		EventType: websocket.BookTicker,
+		BidPrice:  v[0],
+		BidQty:    v[1],
+		AskPrice:  v[2],
+		AskQty:    v[3],
+		UpdateID:  b.SeqID,
+	}, true, nil
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/WWoi/web-parcer/internal/deadletter"
 	"github.com/WWoi/web-parcer/internal/models"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
@@ -24,11 +25,96 @@ type ProducerConfig struct {
 	WriteTimeout time.Duration // таймаут записи (10s)
 }
 
-type Producer struct {
+// Record - сообщение до сериализации: Value уходит в Kafka как JSON,
+// Key определяет партицию
+type Record struct {
+	ID    string
+	Key   string
+	Time  time.Time
+	Value any
+}
+
+// Converter превращает элемент входного канала в Record
+type Converter[T any] func(item T, messageID string) Record
+
+// DailyStatRecord - 24h статистика в формате KafkaMiniTicker
+func DailyStatRecord(stat *models.DailyStat, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   stat.Symbol,
+		Time:  stat.Timestamp,
+		Value: models.FromDailyStatIntoKafkaMiniTicker(stat, messageID),
+	}
+}
+
+// BookStatRecord - лучшие цены и спред в формате KafkaBookTicker
+func BookStatRecord(stat *models.BookStat, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   stat.Symbol,
+		Time:  stat.Timestamp,
+		Value: models.FromBookStatIntoKafkaBookTicker(stat, messageID),
+	}
+}
+
+// OrderBookStatRecord - срез локального стакана как есть
+func OrderBookStatRecord(stat *models.OrderBookStat, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   stat.Symbol,
+		Time:  stat.Timestamp,
+		Value: stat,
+	}
+}
+
+// TradeGapRecord - пропуск в последовательности сделок
+func TradeGapRecord(gap models.TradeGap, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   gap.Symbol,
+		Time:  gap.DetectedAt,
+		Value: gap,
+	}
+}
+
+// WindowRecord - свеча из сделок в формате KafkaCandle. Ключ - символ:
+// исправления свечи идут в ту же партицию после первого выпуска
+func WindowRecord(w *models.Window, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   w.Symbol,
+		Time:  w.EndTime,
+		Value: models.FromWindowIntoKafkaCandle(w, messageID),
+	}
+}
+
+// LateTradeRecord - сделка, опоздавшая в закрытую свечу
+func LateTradeRecord(trade models.UniversalTrade, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   trade.Symbol,
+		Time:  trade.Timestamp,
+		Value: trade,
+	}
+}
+
+// DeadLetterRecord - неразобранное сообщение для топика DLQ, ключ - биржа
+func DeadLetterRecord(l deadletter.Letter, messageID string) Record {
+	return Record{
+		ID:    messageID,
+		Key:   l.Exchange,
+		Time:  l.ReceivedAt,
+		Value: l,
+	}
+}
+
+// Producer батчами отправляет в один топик все, что приходит во входной канал
+type Producer[T any] struct {
 	writer      *kafka.Writer
 	config      ProducerConfig
-	inputChan   <-chan *models.DailyStat
-	batchBuffer []*models.KafkaMiniTicker
+	inputChan   <-chan T
+	convert     Converter[T]
+	batchBuffer []Record
 	batchTimer  *time.Timer
 
 	// метрики
@@ -37,7 +123,7 @@ type Producer struct {
 	batchesSent    int64
 }
 
-func NewProducer(cfg ProducerConfig, inChan <-chan *models.DailyStat) *Producer {
+func NewProducer[T any](cfg ProducerConfig, inChan <-chan T, convert Converter[T]) *Producer[T] {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(cfg.BrokersURL...),
 		Topic:        cfg.Topic,
@@ -63,16 +149,17 @@ func NewProducer(cfg ProducerConfig, inChan <-chan *models.DailyStat) *Producer
 		}),
 	}
 
-	return &Producer{
+	return &Producer[T]{
 		writer:      writer,
 		config:      cfg,
 		inputChan:   inChan,
-		batchBuffer: make([]*models.KafkaMiniTicker, 0, cfg.BatchSize),
+		convert:     convert,
+		batchBuffer: make([]Record, 0, cfg.BatchSize),
 		batchTimer:  time.NewTimer(cfg.BatchTimeout),
 	}
 }
 
-func (p *Producer) Start(ctx context.Context) {
+func (p *Producer[T]) Start(ctx context.Context) {
 	slog.Info("✴️ Kafka producer starting",
 		"topic", p.config.Topic,
 		"brokers", p.config.BrokersURL,
@@ -84,18 +171,18 @@ func (p *Producer) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			if len(p.batchBuffer) > 0 {
-				p.flushBatch(ctx)
-			}
+			p.flushOnStop()
 			slog.Info("Kafka producer stopped")
+			return
 
-		case stat := <-p.inputChan:
-			if stat == nil {
-				continue
+		case item, ok := <-p.inputChan:
+			if !ok {
+				p.flushOnStop()
+				slog.Info("Kafka producer stopped: input closed")
+				return
 			}
 
-			msg := models.FromDailyStatIntoKafkaMiniTicker(stat, uuid.New().String())
-			p.batchBuffer = append(p.batchBuffer, msg)
+			p.batchBuffer = append(p.batchBuffer, p.convert(item, uuid.New().String()))
 
 			if len(p.batchBuffer) >= p.config.BatchSize {
 				p.flushBatch(ctx)
@@ -111,7 +198,24 @@ func (p *Producer) Start(ctx context.Context) {
 	}
 }
 
-func (p *Producer) flushBatch(ctx context.Context) {
+// flushOnStop отправляет остаток батча: контекст приложения уже отменен,
+// поэтому запись идет со своим таймаутом
+func (p *Producer[T]) flushOnStop() {
+	if len(p.batchBuffer) == 0 {
+		return
+	}
+
+	timeout := p.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	p.flushBatch(ctx)
+}
+
+func (p *Producer[T]) flushBatch(ctx context.Context) {
 	if len(p.batchBuffer) == 0 {
 		return
 	}
@@ -120,19 +224,19 @@ func (p *Producer) flushBatch(ctx context.Context) {
 	messages := make([]kafka.Message, 0, batchSize)
 
 	// prepare batch
-	for _, msg := range p.batchBuffer {
-		jsonData, err := json.Marshal(msg)
+	for _, rec := range p.batchBuffer {
+		jsonData, err := json.Marshal(rec.Value)
 		if err != nil {
-			slog.Error("Could not convert into JSON", "error", err, "symbol", msg.Symbol)
+			slog.Error("Could not convert into JSON", "error", err, "key", rec.Key)
 			continue
 		}
 
 		messages = append(messages, kafka.Message{
-			Key:   []byte(msg.Symbol),
+			Key:   []byte(rec.Key),
 			Value: jsonData,
-			Time:  msg.Timestamp,
+			Time:  rec.Time,
 			Headers: []kafka.Header{
-				{Key: "message_id", Value: []byte(msg.MessageID)},
+				{Key: "message_id", Value: []byte(rec.ID)},
 			},
 		})
 	}
@@ -147,6 +251,7 @@ func (p *Producer) flushBatch(ctx context.Context) {
 		slog.Error("❌ Failed to sent batch to Kafka",
 			"error", err,
 			"batch_size", len(messages),
+			"topic", p.config.Topic,
 			"duration", duration)
 	} else {
 		p.messegesSent += int64(len(messages))
@@ -162,7 +267,7 @@ func (p *Producer) flushBatch(ctx context.Context) {
 	p.batchBuffer = p.batchBuffer[:0]
 }
 
-func (p *Producer) close() {
+func (p *Producer[T]) close() {
 	slog.Info("🚪 Closing Kafka producer",
 		"total_messages_sent", p.messegesSent,
 		"total_batches_sent", p.batchesSent,
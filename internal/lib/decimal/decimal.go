@@ -0,0 +1,545 @@
+// Package decimal - числа с фиксированной точкой для цен и объемов.
+// Биржи присылают их строками, чтобы не терять точность; float64 теряет ее
+// уже при разборе и накапливает ошибку при суммировании.
+package decimal
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+)
+
+// MaxScale - максимальное количество знаков после точки
+const MaxScale = 18
+
+var (
+	ErrSyntax = errors.New("decimal: invalid syntax")
+	ErrRange  = errors.New("decimal: value out of range")
+)
+
+var pow10 = [MaxScale + 1]int64{
+	1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18,
+}
+
+// Decimal - число coef * 10^-scale. Нулевое значение - ноль.
+// Если результат операции не помещается в int64, лишние знаки после
+// точки округляются (half away from zero): точность теряется только там,
+// где ее уже нельзя представить
+type Decimal struct {
+	coef  int64
+	scale uint8
+}
+
+// Zero - ноль
+var Zero Decimal
+
+// New возвращает coef * 10^-scale
+func New(coef int64, scale uint8) Decimal {
+	if coef == math.MinInt64 {
+		coef++
+	}
+	if scale > MaxScale {
+		return fromBig(big.NewInt(coef), int(scale))
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// FromInt возвращает целое число
+func FromInt(v int64) Decimal {
+	return New(v, 0)
+}
+
+// FromFloat округляет f до scale знаков после точки
+func FromFloat(f float64, scale uint8) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Zero
+	}
+	d, err := Parse(strconv.FormatFloat(f, 'f', int(min(scale, MaxScale)), 64))
+	if err != nil {
+		return Zero
+	}
+	return d
+}
+
+// maxExp - предел экспоненты в Parse: больше 19 знаков int64 не вместит
+const maxExp = 1000
+
+// Parse разбирает строку вида "-123.4500", "0.00000001", "1e-8".
+// Незначащие нули после точки отбрасываются
+func Parse(s string) (Decimal, error) {
+	if s == "" {
+		return Zero, ErrSyntax
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	exp := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'e' || s[i] == 'E' {
+			e, err := strconv.Atoi(s[i+1:])
+			if err != nil {
+				return Zero, ErrSyntax
+			}
+			// Дальше любая экспонента дает ноль или выход за int64, а scale
+			// не должен переполниться
+			exp = max(min(e, maxExp), -maxExp)
+			s = s[:i]
+			break
+		}
+	}
+
+	intPart, fracPart := s, ""
+	for i := 0; i < len(s); i++ {
+		if s[i] == '.' {
+			intPart, fracPart = s[:i], s[i+1:]
+			break
+		}
+	}
+	if intPart == "" && fracPart == "" {
+		return Zero, ErrSyntax
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Zero, ErrSyntax
+	}
+
+	for len(fracPart) > 0 && fracPart[len(fracPart)-1] == '0' {
+		fracPart = fracPart[:len(fracPart)-1]
+	}
+	for len(intPart) > 0 && intPart[0] == '0' {
+		intPart = intPart[1:]
+	}
+
+	digits := intPart + fracPart
+	scale := len(fracPart) - exp
+	for len(digits) > 0 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	if digits == "" {
+		return Zero, nil
+	}
+
+	// Положительная экспонента - дописываем нули
+	if scale < 0 {
+		if len(digits)-scale > 19 {
+			return Zero, ErrRange
+		}
+		for ; scale < 0; scale++ {
+			digits += "0"
+		}
+	}
+
+	// Лишние знаки после точки округляем, целую часть - никогда
+	var roundUp bool
+	if drop := max(scale-MaxScale, len(digits)-19); drop > 0 {
+		if drop > scale {
+			return Zero, ErrRange
+		}
+		// Все значащие цифры дальше MaxScale: "1e-20" - ноль. Ровно все -
+		// округляем по первой: "0.0000000000000000005" - 1e-18
+		if drop > len(digits) {
+			return Zero, nil
+		}
+		roundUp = digits[len(digits)-drop] >= '5'
+		digits = digits[:len(digits)-drop]
+		scale -= drop
+	}
+
+	var coef uint64
+	for i := 0; i < len(digits); i++ {
+		coef = coef*10 + uint64(digits[i]-'0')
+	}
+	if roundUp {
+		coef++
+	}
+	if coef == 0 {
+		return Zero, nil
+	}
+	for coef > math.MaxInt64 {
+		if scale == 0 {
+			return Zero, ErrRange
+		}
+		coef = (coef + 5) / 10
+		scale--
+	}
+
+	c := int64(coef)
+	if neg {
+		c = -c
+	}
+	return Decimal{coef: c, scale: uint8(scale)}, nil
+}
+
+// MustParse - Parse для констант, паникует на ошибке
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Coef - целое представление числа
+func (d Decimal) Coef() int64 {
+	return d.coef
+}
+
+// Scale - количество знаков после точки
+func (d Decimal) Scale() uint8 {
+	return d.scale
+}
+
+func (d Decimal) IsZero() bool {
+	return d.coef == 0
+}
+
+// Sign возвращает -1, 0 или 1
+func (d Decimal) Sign() int {
+	switch {
+	case d.coef < 0:
+		return -1
+	case d.coef > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: -d.coef, scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.coef < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Float64 - приближенное значение для отображения и эвристик, не для расчетов
+func (d Decimal) Float64() float64 {
+	return float64(d.coef) / float64(pow10[d.scale])
+}
+
+// String возвращает точное значение со всеми знаками scale: "16541.34000000"
+func (d Decimal) String() string {
+	return string(d.append(make([]byte, 0, 24)))
+}
+
+func (d Decimal) append(buf []byte) []byte {
+	if d.coef < 0 {
+		buf = append(buf, '-')
+	}
+
+	digits := strconv.FormatUint(absUint(d.coef), 10)
+	if d.scale == 0 {
+		return append(buf, digits...)
+	}
+
+	scale := int(d.scale)
+	if len(digits) <= scale {
+		buf = append(buf, '0', '.')
+		for range scale - len(digits) {
+			buf = append(buf, '0')
+		}
+		return append(buf, digits...)
+	}
+
+	point := len(digits) - scale
+	buf = append(buf, digits[:point]...)
+	buf = append(buf, '.')
+	return append(buf, digits[point:]...)
+}
+
+// Rescale приводит число к scale знакам после точки, округляя при уменьшении
+func (d Decimal) Rescale(scale uint8) Decimal {
+	scale = min(scale, MaxScale)
+	switch {
+	case scale == d.scale:
+		return d
+	case scale > d.scale:
+		if c, ok := mul64(d.coef, pow10[scale-d.scale]); ok {
+			return Decimal{coef: c, scale: scale}
+		}
+		// Не помещается - оставляем столько знаков, сколько влезает
+		return fromBig(toBigAt(d, scale), int(scale))
+	default:
+		return Decimal{coef: divRound(d.coef, pow10[d.scale-scale]), scale: scale}
+	}
+}
+
+// Cmp возвращает -1, 0 или 1
+func (d Decimal) Cmp(o Decimal) int {
+	if d.scale == o.scale {
+		return cmpInt(d.coef, o.coef)
+	}
+	if a, b, _, ok := align(d, o); ok {
+		return cmpInt(a, b)
+	}
+	return toBigAt(d, max(d.scale, o.scale)).Cmp(toBigAt(o, max(d.scale, o.scale)))
+}
+
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.Cmp(o) > 0
+}
+
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.Cmp(o) < 0
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	if a, b, scale, ok := align(d, o); ok {
+		if sum, ok := add64(a, b); ok {
+			return Decimal{coef: sum, scale: scale}
+		}
+	}
+
+	scale := max(d.scale, o.scale)
+	sum := new(big.Int).Add(toBigAt(d, scale), toBigAt(o, scale))
+	return fromBig(sum, int(scale))
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	scale := int(d.scale) + int(o.scale)
+
+	hi, lo := bits.Mul64(absUint(d.coef), absUint(o.coef))
+	if hi == 0 && lo <= math.MaxInt64 && scale <= MaxScale {
+		c := int64(lo)
+		if (d.coef < 0) != (o.coef < 0) {
+			c = -c
+		}
+		return Decimal{coef: c, scale: uint8(scale)}
+	}
+
+	prod := new(big.Int).Mul(toBig(d), toBig(o))
+	return fromBig(prod, scale)
+}
+
+// Div делит с округлением до scale знаков. Деление на ноль дает ноль
+func (d Decimal) Div(o Decimal, scale uint8) Decimal {
+	if o.coef == 0 {
+		return Zero
+	}
+	scale = min(scale, MaxScale)
+
+	// d/o * 10^scale = d.coef * 10^(scale + o.scale - d.scale) / o.coef
+	num, den := toBig(d), toBig(o)
+	if e := int(scale) + int(o.scale) - int(d.scale); e >= 0 {
+		num.Mul(num, bigPow10(e))
+	} else {
+		den.Mul(den, bigPow10(-e))
+	}
+	return fromBig(bigDivRound(num, den), int(scale))
+}
+
+// Min возвращает меньшее из чисел
+func Min(a, b Decimal) Decimal {
+	if b.LessThan(a) {
+		return b
+	}
+	return a
+}
+
+// Max возвращает большее из чисел
+func Max(a, b Decimal) Decimal {
+	if b.GreaterThan(a) {
+		return b
+	}
+	return a
+}
+
+// ==================== Сериализация ====================
+
+// MarshalJSON пишет точное значение строкой, как это делают биржи
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 26)
+	buf = append(buf, '"')
+	buf = d.append(buf)
+	return append(buf, '"'), nil
+}
+
+// UnmarshalJSON принимает и строку, и число
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return d.append(nil), nil
+}
+
+func (d *Decimal) UnmarshalText(data []byte) error {
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// ==================== Внутренняя арифметика ====================
+
+// align приводит оба числа к большему scale без big.Int, если это возможно
+func align(a, b Decimal) (int64, int64, uint8, bool) {
+	switch {
+	case a.scale == b.scale:
+		return a.coef, b.coef, a.scale, true
+	case a.scale < b.scale:
+		c, ok := mul64(a.coef, pow10[b.scale-a.scale])
+		return c, b.coef, b.scale, ok
+	default:
+		c, ok := mul64(b.coef, pow10[a.scale-b.scale])
+		return a.coef, c, a.scale, ok
+	}
+}
+
+func add64(a, b int64) (int64, bool) {
+	sum := a + b
+	// Переполнение: оба слагаемых одного знака, а сумма - другого
+	if (a > 0 && b > 0 && sum < 0) || (a < 0 && b < 0 && sum >= 0) {
+		return 0, false
+	}
+	return sum, true
+}
+
+func mul64(a, b int64) (int64, bool) {
+	hi, lo := bits.Mul64(absUint(a), absUint(b))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, false
+	}
+	c := int64(lo)
+	if (a < 0) != (b < 0) {
+		c = -c
+	}
+	return c, true
+}
+
+// divRound делит с округлением half away from zero
+func divRound(a, b int64) int64 {
+	q, r := a/b, a%b
+	if 2*absUint(r) >= absUint(b) {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func absUint(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toBig(d Decimal) *big.Int {
+	return big.NewInt(d.coef)
+}
+
+func toBigAt(d Decimal, scale uint8) *big.Int {
+	x := toBig(d)
+	if scale > d.scale {
+		x.Mul(x, bigPow10(int(scale-d.scale)))
+	}
+	return x
+}
+
+func bigPow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func bigDivRound(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	r2 := new(big.Int).Abs(r)
+	r2.Lsh(r2, 1)
+	if r2.Cmp(new(big.Int).Abs(den)) >= 0 {
+		if (num.Sign() < 0) != (den.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+var (
+	bigMaxInt64 = big.NewInt(math.MaxInt64)
+	bigMinInt64 = big.NewInt(-math.MaxInt64)
+	bigTen      = big.NewInt(10)
+)
+
+// fromBig убирает знаки после точки, пока число не поместится в int64
+// и scale не станет допустимым. Целую часть не трогаем: если не помещается
+// она, значение ограничивается пределом int64
+func fromBig(x *big.Int, scale int) Decimal {
+	x = new(big.Int).Set(x)
+	for scale > 0 && (scale > MaxScale || x.Cmp(bigMaxInt64) > 0 || x.Cmp(bigMinInt64) < 0) {
+		x = bigDivRound(x, bigTen)
+		scale--
+	}
+
+	switch {
+	case x.Sign() == 0:
+		return Zero
+	case x.Cmp(bigMaxInt64) > 0:
+		return Decimal{coef: math.MaxInt64}
+	case x.Cmp(bigMinInt64) < 0:
+		return Decimal{coef: -math.MaxInt64}
+	}
+	return Decimal{coef: x.Int64(), scale: uint8(scale)}
+}
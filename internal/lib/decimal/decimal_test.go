@@ -0,0 +1,169 @@
+package decimal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{in: "16541.34000000", want: "16541.34"},
+		{in: "-123.4500", want: "-123.45"},
+		{in: "+7", want: "7"},
+		{in: "0.00000001", want: "0.00000001"},
+		{in: "000.000", want: "0"},
+		{in: ".5", want: "0.5"},
+		{in: "5.", want: "5"},
+		{in: "1e-8", want: "0.00000001"},
+		{in: "1.5E3", want: "1500"},
+		{in: "-2.5e-2", want: "-0.025"},
+
+		// Больше MaxScale знаков - округление
+		{in: "0.1234567890123456789", want: "0.123456789012345679"},
+		{in: "0.0000000000000000005", want: "0.000000000000000001"},
+		{in: "0.0000000000000000004", want: "0"},
+		{in: "1e-20", want: "0"},
+		{in: "0.0000000000000000000001", want: "0"},
+		{in: "1e-99999999999999", want: "0"},
+
+		// Больше 19 цифр - теряются знаки после точки, не целая часть
+		{in: "12345678901234567.891", want: "12345678901234567.89"},
+		{in: "9223372036854775807", want: "9223372036854775807"},
+		{in: "99999999999999999999", err: ErrRange},
+		{in: "1e19", err: ErrRange},
+		{in: "1e99999999999999", err: ErrRange},
+
+		{in: "", err: ErrSyntax},
+		{in: "-", err: ErrSyntax},
+		{in: ".", err: ErrSyntax},
+		{in: "1.2.3", err: ErrSyntax},
+		{in: "1e", err: ErrSyntax},
+		{in: "abc", err: ErrSyntax},
+		{in: "NaN", err: ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	for in, want := range map[string]string{
+		`"0.01000000"`: "0.01",
+		`42.5`:         "42.5",
+		`"1e-20"`:      "0",
+		`null`:         "0",
+	} {
+		var d Decimal
+		if err := d.UnmarshalJSON([]byte(in)); err != nil {
+			t.Errorf("UnmarshalJSON(%s) error = %v", in, err)
+			continue
+		}
+		if d.String() != want {
+			t.Errorf("UnmarshalJSON(%s) = %s, want %s", in, d, want)
+		}
+	}
+}
+
+func TestRescale(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale uint8
+		want  string
+	}{
+		{in: "1.25", scale: 1, want: "1.3"},
+		{in: "-1.25", scale: 1, want: "-1.3"},
+		{in: "1.24", scale: 1, want: "1.2"},
+		{in: "1.5", scale: 4, want: "1.5000"},
+		{in: "7", scale: 0, want: "7"},
+		{in: "0.5", scale: 0, want: "1"},
+		// Больше MaxScale не бывает
+		{in: "1.5", scale: 30, want: "1.500000000000000000"},
+		// Не помещается в int64 - знаков столько, сколько влезает
+		{in: "922337203.5", scale: 18, want: "922337203.5000000000"},
+	}
+
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Rescale(tt.scale).String(); got != tt.want {
+			t.Errorf("%s.Rescale(%d) = %s, want %s", tt.in, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if got := New(1500, 20).String(); got != "0.000000000000000015" {
+		t.Errorf("New(1500, 20) = %s", got)
+	}
+	if got := New(4, 20).String(); got != "0" {
+		t.Errorf("New(4, 20) = %s", got)
+	}
+	if got := New(123, 2).String(); got != "1.23" {
+		t.Errorf("New(123, 2) = %s", got)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"add", MustParse("1.1").Add(MustParse("2.25")), "3.35"},
+		{"add negative", MustParse("1.1").Add(MustParse("-2.25")), "-1.15"},
+		{"sub", MustParse("5").Sub(MustParse("0.00000001")), "4.99999999"},
+		// Сумма не помещается в int64 на общем scale - через big.Int, лишний знак округляется
+		{"add big", MustParse("9000000000000000000").Add(MustParse("0.5")), "9000000000000000001"},
+		{"add overflow", MustParse("9223372036854775807").Add(MustParse("1")), "9223372036854775807"},
+
+		{"mul", MustParse("16541.34").Mul(MustParse("0.00605")), "100.0751070"},
+		{"mul negative", MustParse("-1.5").Mul(MustParse("2")), "-3.0"},
+		// Произведение вне int64 - знаки после точки округляются
+		{"mul big", MustParse("65000.12345678").Mul(MustParse("12.34567891")), "802470.6533077651425"},
+		// scale произведения больше MaxScale
+		{"mul scale", MustParse("0.0000000001").Mul(MustParse("0.0000000001")), "0"},
+
+		{"div", MustParse("1").Div(MustParse("3"), 4), "0.3333"},
+		{"div round", MustParse("2").Div(MustParse("3"), 4), "0.6667"},
+		{"div negative", MustParse("-2").Div(MustParse("3"), 2), "-0.67"},
+		{"div zero", MustParse("1").Div(Zero, 8), "0"},
+		{"div scale", MustParse("1").Div(MustParse("7"), 40), "0.142857142857142857"},
+		// Целая часть вне int64 - предел int64
+		{"div big", MustParse("1600000000000").Div(MustParse("0.00000001"), 8), "9223372036854775807"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.got.String(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a, b := MustParse("1.50"), MustParse("1.5")
+	if !a.Equal(b) || a.Cmp(b) != 0 {
+		t.Errorf("1.50 != 1.5")
+	}
+	if !MustParse("0.1").LessThan(MustParse("0.11")) {
+		t.Errorf("0.1 >= 0.11")
+	}
+	if !MustParse("-1").LessThan(Zero) || Max(a, Zero) != a || Min(a, Zero) != Zero {
+		t.Errorf("sign compare")
+	}
+}
@@ -0,0 +1,197 @@
+// Package metadata - метаданные символов биржи из exchangeInfo: base/quote,
+// шаг цены и объема, статус торгов. Кэш обновляется в фоне и отдает
+// процессору точность символа и нормализованную пару
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+const (
+	defaultRefreshInterval = time.Hour
+	defaultLoadTimeout     = 30 * time.Second
+)
+
+// Source - откуда берется exchangeInfo: *rest.Client или FileSource
+type Source interface {
+	ExchangeInfo(ctx context.Context) (models.ExchangeInfo, error)
+}
+
+// FileSource читает exchangeInfo из JSON файла (сохраненный ответ
+// /api/v3/exchangeInfo) - для запуска без сети и для replay
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (f *FileSource) ExchangeInfo(_ context.Context) (models.ExchangeInfo, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return models.ExchangeInfo{}, fmt.Errorf("could not read exchange info: %w", err)
+	}
+
+	var info models.ExchangeInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return models.ExchangeInfo{}, fmt.Errorf("could not parse exchange info %s: %w", f.path, err)
+	}
+	return info, nil
+}
+
+type Config struct {
+	RefreshInterval time.Duration // как часто перечитывать exchangeInfo
+	LoadTimeout     time.Duration // сколько ждать один запрос
+}
+
+// Cache - метаданные символов одной биржи. Пока загрузка не удалась,
+// кэш пуст и ничего не знает о символах
+type Cache struct {
+	cfg      Config
+	exchange string
+	source   Source
+
+	mu      sync.RWMutex
+	symbols map[string]models.SymbolMeta
+}
+
+func NewCache(cfg Config, exchange string, source Source) *Cache {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.LoadTimeout <= 0 {
+		cfg.LoadTimeout = defaultLoadTimeout
+	}
+
+	return &Cache{
+		cfg:      cfg,
+		exchange: exchange,
+		source:   source,
+		symbols:  make(map[string]models.SymbolMeta),
+	}
+}
+
+// Load загружает exchangeInfo и целиком заменяет кэш
+func (c *Cache) Load(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.LoadTimeout)
+	defer cancel()
+
+	info, err := c.source.ExchangeInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	symbols := make(map[string]models.SymbolMeta, len(info.Symbols))
+	halted := 0
+	for _, s := range info.Symbols {
+		meta, err := c.symbolMeta(s)
+		if err != nil {
+			slog.Warn("Invalid symbol in exchange info", "symbol", s.Symbol, "error", err)
+			continue
+		}
+		if !meta.Tradable() {
+			halted++
+		}
+		symbols[meta.Symbol] = meta
+	}
+
+	c.mu.Lock()
+	c.symbols = symbols
+	c.mu.Unlock()
+
+	slog.Info("🗂️ Exchange metadata loaded",
+		"exchange", c.exchange,
+		"symbols", len(symbols),
+		"not_trading", halted)
+	return nil
+}
+
+// Start перечитывает exchangeInfo раз в RefreshInterval. При ошибке
+// остаются прежние метаданные
+func (c *Cache) Start(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Load(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("⚠️ Could not refresh exchange metadata", "exchange", c.exchange, "error", err)
+			}
+		}
+	}
+}
+
+// Symbol возвращает метаданные символа
+func (c *Cache) Symbol(exchange, symbol string) (models.SymbolMeta, bool) {
+	if exchange != c.exchange {
+		return models.SymbolMeta{}, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	meta, ok := c.symbols[strings.ToUpper(symbol)]
+	return meta, ok
+}
+
+// SymbolScale - знаков после точки в цене и объеме по tickSize/stepSize
+// (реализует processor.ScaleSource)
+func (c *Cache) SymbolScale(exchange, symbol string) (price, quantity uint8, ok bool) {
+	meta, ok := c.Symbol(exchange, symbol)
+	if !ok || meta.TickSize.IsZero() || meta.StepSize.IsZero() {
+		return 0, 0, false
+	}
+	return stepScale(meta.TickSize), stepScale(meta.StepSize), true
+}
+
+func (c *Cache) symbolMeta(s models.SymbolInfo) (models.SymbolMeta, error) {
+	meta := models.SymbolMeta{
+		Exchange: c.exchange,
+		Symbol:   strings.ToUpper(s.Symbol),
+		Base:     strings.ToUpper(s.BaseAsset),
+		Quote:    strings.ToUpper(s.QuoteAsset),
+		Status:   s.Status,
+	}
+	if meta.Symbol == "" || meta.Base == "" || meta.Quote == "" {
+		return models.SymbolMeta{}, fmt.Errorf("no symbol, base or quote asset")
+	}
+
+	for _, f := range s.Filters {
+		var err error
+		switch f.FilterType {
+		case "PRICE_FILTER":
+			meta.TickSize, err = decimal.Parse(f.TickSize)
+		case "LOT_SIZE":
+			meta.StepSize, err = decimal.Parse(f.StepSize)
+		}
+		if err != nil {
+			return models.SymbolMeta{}, fmt.Errorf("%s: %w", f.FilterType, err)
+		}
+	}
+	return meta, nil
+}
+
+// stepScale - значащих знаков после точки в шаге: "0.01000000" -> 2, "1.00000000" -> 0
+func stepScale(step decimal.Decimal) uint8 {
+	scale := step.Scale()
+	coef := step.Coef()
+	for scale > 0 && coef%10 == 0 {
+		coef /= 10
+		scale--
+	}
+	return scale
+}
@@ -0,0 +1,144 @@
+package mockexchange
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const (
+	depthTick       = 0.01 // шаг цены уровней
+	depthSeedLevels = 20   // уровней на сторону в начальном стакане
+	depthMaxOffset  = 50   // насколько далеко от цены (в шагах) меняются уровни
+)
+
+// mockBook - стакан символа: цена уровня (строкой с шагом depthTick) -> объем
+type mockBook struct {
+	bids, asks map[string]float64
+	lastID     int64
+}
+
+// book возвращает стакан символа, при первом обращении заполняя его вокруг цены
+func (m *market) book(st *symbolState) *mockBook {
+	if st.book != nil {
+		return st.book
+	}
+
+	st.book = &mockBook{
+		bids:   make(map[string]float64),
+		asks:   make(map[string]float64),
+		lastID: 1000,
+	}
+	for i := 1; i <= depthSeedLevels; i++ {
+		st.book.bids[formatLevel(st.price-float64(i)*depthTick)] = m.rnd.Float64() * 10
+		st.book.asks[formatLevel(st.price+float64(i)*depthTick)] = m.rnd.Float64() * 10
+	}
+	return st.book
+}
+
+// depth двигает цену и меняет несколько уровней вокруг нее.
+// Каждое изменение - отдельный ID обновления, событие несет U..u
+func (m *market) depth(symbol string, now time.Time) models.DepthUpdate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	m.trade(st)
+	b := m.book(st)
+
+	ev := models.DepthUpdate{
+		EventType:     websocket.DepthUpdate,
+		EventTime:     now.UnixMilli(),
+		Symbol:        st.symbol,
+		FirstUpdateID: b.lastID + 1,
+		Bids:          [][]string{},
+		Asks:          [][]string{},
+	}
+
+	// Уровни, которые пересекла цена, удаляются: стакан не перекрещивается
+	for p := range b.bids {
+		if price, _ := strconv.ParseFloat(p, 64); price >= st.price {
+			delete(b.bids, p)
+			ev.Bids = append(ev.Bids, []string{p, formatNumber(0)})
+			b.lastID++
+		}
+	}
+	for p := range b.asks {
+		if price, _ := strconv.ParseFloat(p, 64); price <= st.price {
+			delete(b.asks, p)
+			ev.Asks = append(ev.Asks, []string{p, formatNumber(0)})
+			b.lastID++
+		}
+	}
+
+	for range 1 + m.rnd.Intn(5) {
+		offset := float64(1+m.rnd.Intn(depthMaxOffset)) * depthTick
+		qty := m.rnd.Float64() * 10
+		if m.rnd.Intn(5) == 0 {
+			qty = 0
+		}
+
+		if m.rnd.Intn(2) == 0 {
+			p := formatLevel(st.price - offset)
+			setMockLevel(b.bids, p, qty)
+			ev.Bids = append(ev.Bids, []string{p, formatNumber(qty)})
+		} else {
+			p := formatLevel(st.price + offset)
+			setMockLevel(b.asks, p, qty)
+			ev.Asks = append(ev.Asks, []string{p, formatNumber(qty)})
+		}
+		b.lastID++
+	}
+	ev.FinalUpdateID = b.lastID
+
+	return ev
+}
+
+// depthSnapshot - снимок в формате GET /api/v3/depth
+func (m *market) depthSnapshot(symbol string, limit int) models.DepthSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	b := m.book(st)
+
+	return models.DepthSnapshot{
+		LastUpdateID: b.lastID,
+		Bids:         sortedLevels(b.bids, limit, true),
+		Asks:         sortedLevels(b.asks, limit, false),
+	}
+}
+
+func setMockLevel(levels map[string]float64, price string, qty float64) {
+	if qty == 0 {
+		delete(levels, price)
+		return
+	}
+	levels[price] = qty
+}
+
+func sortedLevels(levels map[string]float64, limit int, desc bool) [][]string {
+	prices := make([]float64, 0, len(levels))
+	for p := range levels {
+		price, _ := strconv.ParseFloat(p, 64)
+		prices = append(prices, price)
+	}
+	sort.Float64s(prices)
+	if desc {
+		sort.Sort(sort.Reverse(sort.Float64Slice(prices)))
+	}
+
+	out := make([][]string, 0, min(limit, len(prices)))
+	for _, price := range prices[:min(limit, len(prices))] {
+		p := formatLevel(price)
+		out = append(out, []string{p, formatNumber(levels[p])})
+	}
+	return out
+}
+
+func formatLevel(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
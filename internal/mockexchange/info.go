@@ -0,0 +1,60 @@
+package mockexchange
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// quoteAssets - по ним символ делится на base и quote, длинные раньше коротких
+var quoteAssets = []string{"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "BTC", "ETH", "BNB", "EUR", "TRY"}
+
+// exchangeInfo - ответ /api/v3/exchangeInfo: символы из конфига и все,
+// по которым уже шли события. Символы из halted - со статусом HALT
+func (m *market) exchangeInfo(configured, halted []string, now time.Time) models.ExchangeInfo {
+	m.mu.Lock()
+	symbols := slices.Clone(configured)
+	for symbol := range m.symbols {
+		symbols = append(symbols, symbol)
+	}
+	m.mu.Unlock()
+
+	for i := range symbols {
+		symbols[i] = strings.ToUpper(symbols[i])
+	}
+	slices.Sort(symbols)
+	symbols = slices.Compact(symbols)
+
+	info := models.ExchangeInfo{ServerTime: now.UnixMilli()}
+	for _, symbol := range symbols {
+		base, quote := splitSymbol(symbol)
+		status := models.SymbolStatusTrading
+		if slices.ContainsFunc(halted, func(h string) bool { return strings.EqualFold(h, symbol) }) {
+			status = "HALT"
+		}
+
+		info.Symbols = append(info.Symbols, models.SymbolInfo{
+			Symbol:     symbol,
+			Status:     status,
+			BaseAsset:  base,
+			QuoteAsset: quote,
+			Filters: []models.SymbolFilter{
+				// Цены и объемы мока - с 8 знаками, как formatNumber
+				{FilterType: "PRICE_FILTER", TickSize: "0.00000001"},
+				{FilterType: "LOT_SIZE", StepSize: "0.00000001"},
+			},
+		})
+	}
+	return info
+}
+
+func splitSymbol(symbol string) (base, quote string) {
+	for _, q := range quoteAssets {
+		if b, ok := strings.CutSuffix(symbol, q); ok && b != "" {
+			return b, q
+		}
+	}
+	return symbol, "USDT"
+}
@@ -0,0 +1,299 @@
+package mockexchange
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// aggHistorySize - сколько aggTrade символа помнит /api/v3/aggTrades
+const aggHistorySize = 10000
+
+// market - случайное блуждание цен по символам.
+// Все соединения видят одни и те же события
+type market struct {
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	symbols map[string]*symbolState
+}
+
+type symbolState struct {
+	symbol string
+	price  float64
+
+	// 24ч статистика (для miniTicker)
+	open, high, low    float64
+	volume, quoteValue float64
+
+	nextAggID    int64
+	nextTradeID  int64
+	nextUpdateID int64
+
+	klines map[string]*models.KlineData // интервал -> текущая свеча
+	book   *mockBook                    // стакан для depth и /api/v3/depth
+
+	aggHistory []models.AggTrade // последние aggTrade для /api/v3/aggTrades
+}
+
+func newMarket(seed int64) *market {
+	return &market{
+		rnd:     rand.New(rand.NewSource(seed)),
+		symbols: make(map[string]*symbolState),
+	}
+}
+
+func (m *market) state(symbol string) *symbolState {
+	symbol = strings.ToUpper(symbol)
+
+	st, ok := m.symbols[symbol]
+	if !ok {
+		price := 1 + m.rnd.Float64()*1000
+		st = &symbolState{
+			symbol:       symbol,
+			price:        price,
+			open:         price,
+			high:         price,
+			low:          price,
+			nextAggID:    1,
+			nextTradeID:  1,
+			nextUpdateID: 1,
+			klines:       make(map[string]*models.KlineData),
+		}
+		m.symbols[symbol] = st
+	}
+	return st
+}
+
+// trade двигает цену и возвращает цену и объем новой сделки
+func (m *market) trade(st *symbolState) (float64, float64) {
+	st.price *= 1 + (m.rnd.Float64()-0.5)*0.002
+	qty := m.rnd.Float64() * 2
+
+	st.high = max(st.high, st.price)
+	st.low = min(st.low, st.price)
+	st.volume += qty
+	st.quoteValue += qty * st.price
+
+	return st.price, qty
+}
+
+func (m *market) aggTrade(symbol string, now time.Time) models.AggTrade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	price, qty := m.trade(st)
+	trades := int64(1 + m.rnd.Intn(3))
+
+	ev := models.AggTrade{
+		EventType:        websocket.AggTrade,
+		EventTime:        now.UnixMilli(),
+		Symbol:           st.symbol,
+		AggregateTradeID: st.nextAggID,
+		Price:            formatNumber(price),
+		Quantity:         formatNumber(qty),
+		FirstTradeID:     st.nextTradeID,
+		LastTradeID:      st.nextTradeID + trades - 1,
+		TradeTime:        now.UnixMilli(),
+		IsBuyer:          m.rnd.Intn(2) == 0,
+		Ignore:           true,
+	}
+	st.nextAggID++
+	st.nextTradeID += trades
+
+	st.aggHistory = append(st.aggHistory, ev)
+	if len(st.aggHistory) > aggHistorySize {
+		st.aggHistory = st.aggHistory[len(st.aggHistory)-aggHistorySize:]
+	}
+
+	return ev
+}
+
+// aggTrades - история в формате GET /api/v3/aggTrades: начиная с fromID, без e/E/s
+func (m *market) aggTrades(symbol string, fromID int64, limit int) []models.AggTrade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	out := make([]models.AggTrade, 0, limit)
+	for _, t := range st.aggHistory {
+		if t.AggregateTradeID < fromID {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		t.EventType, t.EventTime, t.Symbol = "", 0, ""
+		out = append(out, t)
+	}
+	return out
+}
+
+func (m *market) rawTrade(symbol string, now time.Time) models.Trade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	price, qty := m.trade(st)
+
+	ev := models.Trade{
+		EventType: websocket.Trade,
+		EventTime: now.UnixMilli(),
+		Symbol:    st.symbol,
+		TradeID:   st.nextTradeID,
+		Price:     formatNumber(price),
+		Quantity:  formatNumber(qty),
+		TradeTime: now.UnixMilli(),
+		IsBuyer:   m.rnd.Intn(2) == 0,
+		Ignore:    true,
+	}
+	st.nextTradeID++
+
+	return ev
+}
+
+func (m *market) miniTicker(symbol string, now time.Time) models.MiniTicker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	m.trade(st)
+
+	return models.MiniTicker{
+		EventType:     websocket.MiniTicker,
+		EventTime:     now.UnixMilli(),
+		Symbol:        st.symbol,
+		ClosePrice:    formatNumber(st.price),
+		OpenPrice:     formatNumber(st.open),
+		HighPrice:     formatNumber(st.high),
+		LowPrice:      formatNumber(st.low),
+		TotalBaseVol:  formatNumber(st.volume),
+		TotalQuoteVol: formatNumber(st.quoteValue),
+	}
+}
+
+// bookTicker - лучшие цены вокруг текущей: спред 1-10 bps от цены
+func (m *market) bookTicker(symbol string) models.BookTicker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	m.trade(st)
+	half := st.price * (1 + m.rnd.Float64()*9) / 20000
+
+	ev := models.BookTicker{
+		UpdateID: st.nextUpdateID,
+		Symbol:   st.symbol,
+		BidPrice: formatNumber(st.price - half),
+		BidQty:   formatNumber(m.rnd.Float64() * 5),
+		AskPrice: formatNumber(st.price + half),
+		AskQty:   formatNumber(m.rnd.Float64() * 5),
+	}
+	st.nextUpdateID++
+
+	return ev
+}
+
+// kline возвращает текущую свечу. Если интервал сменился, сначала
+// отдается закрытая свеча (x=true), затем новая
+func (m *market) kline(symbol, interval string, now time.Time) []models.Kline {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	price, qty := m.trade(st)
+
+	dur := intervalDuration(interval)
+	start := now.Truncate(dur)
+
+	var events []models.Kline
+
+	k, ok := st.klines[interval]
+	if ok && k.StartTime != start.UnixMilli() {
+		closed := *k
+		closed.IsClosed = true
+		events = append(events, m.klineEvent(st, closed, now))
+		ok = false
+	}
+
+	if !ok {
+		p := formatNumber(price)
+		k = &models.KlineData{
+			StartTime:        start.UnixMilli(),
+			CloseTime:        start.Add(dur).UnixMilli() - 1,
+			Symbol:           st.symbol,
+			Interval:         interval,
+			FirstTradeID:     st.nextTradeID,
+			OpenPrice:        p,
+			HighPrice:        p,
+			LowPrice:         p,
+			BaseVolume:       "0",
+			QuoteVolume:      "0",
+			TakerBuyBaseVol:  "0",
+			TakerBuyQuoteVol: "0",
+			Ignore:           "0",
+		}
+		st.klines[interval] = k
+	}
+
+	k.ClosePrice = formatNumber(price)
+	if high, _ := strconv.ParseFloat(k.HighPrice, 64); price > high {
+		k.HighPrice = k.ClosePrice
+	}
+	if low, _ := strconv.ParseFloat(k.LowPrice, 64); price < low {
+		k.LowPrice = k.ClosePrice
+	}
+	vol, _ := strconv.ParseFloat(k.BaseVolume, 64)
+	quote, _ := strconv.ParseFloat(k.QuoteVolume, 64)
+	k.BaseVolume = formatNumber(vol + qty)
+	k.QuoteVolume = formatNumber(quote + qty*price)
+	k.LastTradeID = st.nextTradeID
+	k.Trades++
+	st.nextTradeID++
+
+	return append(events, m.klineEvent(st, *k, now))
+}
+
+func (m *market) klineEvent(st *symbolState, k models.KlineData, now time.Time) models.Kline {
+	return models.Kline{
+		EventType: websocket.Kline,
+		EventTime: now.UnixMilli(),
+		Symbol:    st.symbol,
+		Kline:     k,
+	}
+}
+
+// intervalDuration - длительность интервала свечи (1M считаем за 30 дней)
+func intervalDuration(interval string) time.Duration {
+	if len(interval) < 2 {
+		return time.Minute
+	}
+
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || n <= 0 {
+		return time.Minute
+	}
+
+	unit := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'M': 30 * 24 * time.Hour,
+	}[interval[len(interval)-1]]
+	if unit == 0 {
+		return time.Minute
+	}
+	return time.Duration(n) * unit
+}
+
+// formatNumber - как Binance: строка с 8 знаками после запятой
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', 8, 64)
+}
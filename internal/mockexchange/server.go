@@ -0,0 +1,647 @@
+// Package mockexchange - локальный фейковый Binance WebSocket для тестов без сети.
+// Понимает /ws и /stream, SUBSCRIBE/UNSUBSCRIBE/LIST_SUBSCRIPTIONS, генерирует
+// aggTrade, trade, miniTicker, !miniTicker@arr, bookTicker, kline и depth в формате models.* и умеет
+// ломаться по команде: ping, разрыв, битые фреймы, медленная доставка.
+package mockexchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/websocket"
+	gorilla "github.com/gorilla/websocket"
+)
+
+const (
+	defaultTickInterval = 100 * time.Millisecond
+	sendQueueSize       = 1024
+	writeTimeout        = 5 * time.Second
+)
+
+type Config struct {
+	Symbols      []string      // символы для !miniTicker@arr
+	TickInterval time.Duration // как часто генерировать события
+	Seed         int64         // зерно генератора (0 - от времени)
+	Scripted     bool          // не генерировать события, только Broadcast/Play/Inject
+
+	// Неисправности
+	Delay           time.Duration // задержка перед каждым фреймом
+	PingInterval    time.Duration // как часто слать ping (0 - никогда)
+	DisconnectAfter time.Duration // через сколько рвать каждое соединение (0 - никогда)
+	MalformedRate   float64       // доля испорченных фреймов, 0..1
+	Halted          []string      // символы со статусом HALT в /api/v3/exchangeInfo
+	// RequestLimit - входящих сообщений в секунду на соединение; больше -
+	// разрыв, как у Binance (лимит 5). 0 - без ограничения
+	RequestLimit int
+}
+
+// ScriptStep - заранее заданный фрейм для Play
+type ScriptStep struct {
+	After  time.Duration   // пауза перед отправкой
+	Stream string          // кому отправлять (подписчикам стрима)
+	Data   json.RawMessage // данные события
+}
+
+type Server struct {
+	cfg      Config
+	market   *market
+	upgrader gorilla.Upgrader
+
+	mu    sync.Mutex
+	conns map[*conn]struct{}
+
+	delay    atomic.Int64 // текущая задержка доставки, можно менять на лету
+	requests atomic.Int64 // запросов SUBSCRIBE/UNSUBSCRIBE
+
+	rejectMu sync.Mutex
+	rejected map[string]map[string]struct{} // метод -> стримы, на которые отвечаем ошибкой
+
+	rndMu sync.Mutex
+	rnd   *rand.Rand
+
+	httpServer *http.Server
+}
+
+type conn struct {
+	ws       *gorilla.Conn
+	combined bool
+	send     chan []byte
+	closed   chan struct{}
+	once     sync.Once
+
+	mu   sync.Mutex
+	subs map[string]struct{}
+
+	recent []time.Time // время входящих сообщений за последнюю секунду (RequestLimit)
+}
+
+func New(cfg Config) *Server {
+	if cfg.TickInterval <= 0 {
+		cfg.TickInterval = defaultTickInterval
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if len(cfg.Symbols) == 0 {
+		cfg.Symbols = []string{"BTCUSDT", "ETHUSDT", "BNBUSDT"}
+	}
+
+	s := &Server{
+		cfg:      cfg,
+		market:   newMarket(cfg.Seed),
+		conns:    make(map[*conn]struct{}),
+		rnd:      rand.New(rand.NewSource(cfg.Seed + 1)),
+		rejected: make(map[string]map[string]struct{}),
+	}
+	s.delay.Store(int64(cfg.Delay))
+
+	return s
+}
+
+// Listen поднимает сервер на addr ("127.0.0.1:0" - любой свободный порт),
+// запускает генерацию и возвращает базовый адрес вида ws://127.0.0.1:12345
+func (s *Server) Listen(ctx context.Context, addr string) (string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	s.httpServer = &http.Server{Handler: s}
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Mock exchange server failed", "error", err)
+		}
+	}()
+	go s.Start(ctx)
+
+	return "ws://" + ln.Addr().String(), nil
+}
+
+// Start генерирует события до отмены контекста, потом закрывает соединения
+func (s *Server) Start(ctx context.Context) {
+	tick := time.NewTicker(s.cfg.TickInterval)
+	defer tick.Stop()
+
+	var ping <-chan time.Time
+	if s.cfg.PingInterval > 0 {
+		t := time.NewTicker(s.cfg.PingInterval)
+		defer t.Stop()
+		ping = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return
+		case now := <-tick.C:
+			if !s.cfg.Scripted {
+				s.generate(now)
+			}
+		case <-ping:
+			s.Ping()
+		}
+	}
+}
+
+// Close закрывает все соединения и HTTP сервер (если он был поднят через Listen)
+func (s *Server) Close() {
+	s.DisconnectAll()
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
+}
+
+// ServeHTTP принимает /ws, /ws/<stream>[/<stream>...], /stream и /stream?streams=a/b,
+// а также REST GET /api/v3/depth, /api/v3/aggTrades и /api/v3/exchangeInfo
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v3/depth":
+		s.serveDepth(w, r)
+		return
+	case "/api/v3/aggTrades":
+		s.serveAggTrades(w, r)
+		return
+	case "/api/v3/exchangeInfo":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.market.exchangeInfo(s.cfg.Symbols, s.cfg.Halted, time.Now()))
+		return
+	}
+
+	var (
+		combined bool
+		names    []string
+	)
+
+	switch {
+	case r.URL.Path == "/stream":
+		combined = true
+		if q := r.URL.Query().Get("streams"); q != "" {
+			names = strings.Split(q, "/")
+		}
+	case r.URL.Path == "/ws":
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		names = strings.Split(strings.TrimPrefix(r.URL.Path, "/ws/"), "/")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	for _, name := range names {
+		if _, err := websocket.ParseStream(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &conn{
+		ws:       ws,
+		combined: combined,
+		send:     make(chan []byte, sendQueueSize),
+		closed:   make(chan struct{}),
+		subs:     make(map[string]struct{}),
+	}
+	for _, name := range names {
+		c.subs[name] = struct{}{}
+	}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	go s.writeLoop(c)
+	go s.readLoop(c)
+
+	if s.cfg.DisconnectAfter > 0 {
+		time.AfterFunc(s.cfg.DisconnectAfter, func() { s.drop(c) })
+	}
+}
+
+// serveDepth отдает снимок стакана, согласованный с событиями depth
+func (s *Server) serveDepth(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		writeMissingSymbol(w)
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 5000)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.market.depthSnapshot(symbol, limit))
+}
+
+// serveAggTrades отдает историю aggTrade начиная с fromId
+func (s *Server) serveAggTrades(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		writeMissingSymbol(w)
+		return
+	}
+
+	fromID, _ := strconv.ParseInt(r.URL.Query().Get("fromId"), 10, 64)
+	limit := 500
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.market.aggTrades(symbol, fromID, limit))
+}
+
+func writeMissingSymbol(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(`{"code":-1102,"msg":"Mandatory parameter 'symbol' was not sent."}`))
+}
+
+// Broadcast отправляет событие всем подписчикам стрима
+func (s *Server) Broadcast(stream string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range s.subscribers(stream) {
+		s.deliver(c, stream, payload)
+	}
+	return nil
+}
+
+// Play отправляет заранее заданные фреймы по очереди
+func (s *Server) Play(ctx context.Context, steps []ScriptStep) error {
+	for _, step := range steps {
+		select {
+		case <-time.After(step.After):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := s.Broadcast(step.Stream, step.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inject отправляет всем соединениям фрейм как есть
+func (s *Server) Inject(raw []byte) {
+	for _, c := range s.allConns() {
+		s.enqueue(c, raw)
+	}
+}
+
+// SendMalformed отправляет всем соединениям битый JSON
+func (s *Server) SendMalformed() {
+	s.Inject([]byte(`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","p":`))
+}
+
+// Ping отправляет ping всем соединениям
+func (s *Server) Ping() {
+	for _, c := range s.allConns() {
+		err := c.ws.WriteControl(gorilla.PingMessage, []byte("mock"), time.Now().Add(writeTimeout))
+		if err != nil {
+			s.drop(c)
+		}
+	}
+}
+
+// DisconnectAll обрывает все соединения
+func (s *Server) DisconnectAll() {
+	for _, c := range s.allConns() {
+		s.drop(c)
+	}
+}
+
+// SetDelay меняет задержку доставки фреймов
+func (s *Server) SetDelay(d time.Duration) {
+	s.delay.Store(int64(d))
+}
+
+// Requests - сколько запросов SUBSCRIBE/UNSUBSCRIBE получено всеми соединениями
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// Reject - запросы method ("SUBSCRIBE", "UNSUBSCRIBE") с любым из streams
+// получают ошибку и ничего не меняют
+func (s *Server) Reject(method string, streams ...string) {
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+
+	if s.rejected[method] == nil {
+		s.rejected[method] = make(map[string]struct{})
+	}
+	for _, name := range streams {
+		s.rejected[method][name] = struct{}{}
+	}
+}
+
+// Subscribers - сколько соединений подписано на стрим
+func (s *Server) Subscribers(stream string) int {
+	return len(s.subscribers(stream))
+}
+
+// Connections - количество открытых соединений
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// generate создает по событию на каждый стрим, на который кто-то подписан
+func (s *Server) generate(now time.Time) {
+	for _, name := range s.activeStreams() {
+		st, err := websocket.ParseStream(name)
+		if err != nil {
+			continue
+		}
+
+		var events []any
+		switch {
+		case st.Kind == websocket.KindAggTrade:
+			events = append(events, s.market.aggTrade(st.Symbol, now))
+		case st.Kind == websocket.KindTrade:
+			events = append(events, s.market.rawTrade(st.Symbol, now))
+		case st.Kind == websocket.KindMiniTicker:
+			events = append(events, s.market.miniTicker(st.Symbol, now))
+		case st.Kind == websocket.KindBookTicker:
+			events = append(events, s.market.bookTicker(st.Symbol))
+		case st.Kind == websocket.KindDepth, st.Kind == websocket.KindDepth100ms:
+			events = append(events, s.market.depth(st.Symbol, now))
+		case st.Kind.Base() == websocket.KindAllMiniTickers:
+			tickers := make([]any, 0, len(s.cfg.Symbols))
+			for _, symbol := range s.cfg.Symbols {
+				tickers = append(tickers, s.market.miniTicker(symbol, now))
+			}
+			events = append(events, tickers)
+		case strings.HasPrefix(string(st.Kind), "kline_"):
+			interval := strings.TrimPrefix(string(st.Kind), "kline_")
+			for _, k := range s.market.kline(st.Symbol, interval, now) {
+				events = append(events, k)
+			}
+		default:
+			continue
+		}
+
+		for _, ev := range events {
+			if err := s.Broadcast(name, ev); err != nil {
+				slog.Error("Mock exchange could not encode event", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Server) deliver(c *conn, stream string, payload []byte) {
+	msg := payload
+	if c.combined {
+		msg, _ = json.Marshal(struct {
+			Stream string          `json:"stream"`
+			Data   json.RawMessage `json:"data"`
+		}{stream, payload})
+	}
+
+	if s.malformed() {
+		msg = msg[:len(msg)/2]
+	}
+	s.enqueue(c, msg)
+}
+
+func (s *Server) malformed() bool {
+	if s.cfg.MalformedRate <= 0 {
+		return false
+	}
+
+	s.rndMu.Lock()
+	defer s.rndMu.Unlock()
+	return s.rnd.Float64() < s.cfg.MalformedRate
+}
+
+// enqueue ставит фрейм в очередь соединения. Как и Binance, медленного
+// клиента, который не успевает читать, отключаем
+func (s *Server) enqueue(c *conn, msg []byte) {
+	select {
+	case c.send <- msg:
+	case <-c.closed:
+	default:
+		slog.Warn("Mock exchange: client is too slow, disconnecting")
+		s.drop(c)
+	}
+}
+
+func (s *Server) writeLoop(c *conn) {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case msg := <-c.send:
+			if d := time.Duration(s.delay.Load()); d > 0 {
+				select {
+				case <-time.After(d):
+				case <-c.closed:
+					return
+				}
+			}
+
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(gorilla.TextMessage, msg); err != nil {
+				s.drop(c)
+				return
+			}
+		}
+	}
+}
+
+type rpcRequest struct {
+	Method string          `json:"method"`
+	Params []string        `json:"params"`
+	ID     json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (s *Server) readLoop(c *conn) {
+	defer s.drop(c)
+
+	for {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if s.overLimit(c) {
+			slog.Warn("Mock exchange: too many requests, disconnecting", "limit", s.cfg.RequestLimit)
+			return
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(msg, &req); err != nil || len(req.ID) == 0 {
+			s.reply(c, json.RawMessage("null"), nil, &rpcError{Code: 3, Msg: "Invalid JSON"})
+			continue
+		}
+
+		switch req.Method {
+		case "SUBSCRIBE", "UNSUBSCRIBE":
+			s.requests.Add(1)
+			if err := validateStreams(req.Params); err != nil {
+				s.reply(c, req.ID, nil, &rpcError{Code: 2, Msg: "Invalid request: " + err.Error()})
+				continue
+			}
+			if s.isRejected(req.Method, req.Params) {
+				s.reply(c, req.ID, nil, &rpcError{Code: 2, Msg: "Invalid request: rejected by mock"})
+				continue
+			}
+
+			c.mu.Lock()
+			for _, name := range req.Params {
+				if req.Method == "SUBSCRIBE" {
+					c.subs[name] = struct{}{}
+				} else {
+					delete(c.subs, name)
+				}
+			}
+			c.mu.Unlock()
+			s.reply(c, req.ID, nil, nil)
+
+		case "LIST_SUBSCRIPTIONS":
+			s.reply(c, req.ID, c.streams(), nil)
+
+		default:
+			s.reply(c, req.ID, nil, &rpcError{Code: 2, Msg: "Invalid request: unknown method"})
+		}
+	}
+}
+
+func (s *Server) isRejected(method string, streams []string) bool {
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+
+	for _, name := range streams {
+		if _, ok := s.rejected[method][name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// overLimit учитывает входящее сообщение и проверяет RequestLimit
+func (s *Server) overLimit(c *conn) bool {
+	if s.cfg.RequestLimit <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	recent := c.recent[:0]
+	for _, t := range c.recent {
+		if now.Sub(t) < time.Second {
+			recent = append(recent, t)
+		}
+	}
+	c.recent = append(recent, now)
+	return len(c.recent) > s.cfg.RequestLimit
+}
+
+func (s *Server) reply(c *conn, id json.RawMessage, result any, rpcErr *rpcError) {
+	resp := map[string]any{"id": id}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+
+	msg, _ := json.Marshal(resp)
+	s.enqueue(c, msg)
+}
+
+func (s *Server) drop(c *conn) {
+	c.once.Do(func() {
+		close(c.closed)
+		c.ws.Close()
+
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	})
+}
+
+func (s *Server) allConns() []*conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (s *Server) subscribers(stream string) []*conn {
+	var subs []*conn
+	for _, c := range s.allConns() {
+		c.mu.Lock()
+		_, ok := c.subs[stream]
+		c.mu.Unlock()
+		if ok {
+			subs = append(subs, c)
+		}
+	}
+	return subs
+}
+
+func (s *Server) activeStreams() []string {
+	seen := make(map[string]struct{})
+	var streams []string
+	for _, c := range s.allConns() {
+		for _, name := range c.streams() {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				streams = append(streams, name)
+			}
+		}
+	}
+	return streams
+}
+
+func (c *conn) streams() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	streams := make([]string, 0, len(c.subs))
+	for name := range c.subs {
+		streams = append(streams, name)
+	}
+	return streams
+}
+
+func validateStreams(names []string) error {
+	if len(names) == 0 {
+		return errors.New("no streams")
+	}
+	for _, name := range names {
+		if _, err := websocket.ParseStream(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
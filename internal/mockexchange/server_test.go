@@ -0,0 +1,119 @@
+package mockexchange_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/mockexchange"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/processor"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const stream = "btcusdt@aggTrade"
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func aggTrade(id int64, at time.Duration, price, qty string) models.AggTrade {
+	ms := t0.Add(at).UnixMilli()
+	return models.AggTrade{
+		EventType:        "aggTrade",
+		EventTime:        ms,
+		Symbol:           "BTCUSDT",
+		AggregateTradeID: id,
+		Price:            price,
+		Quantity:         qty,
+		FirstTradeID:     id,
+		LastTradeID:      id,
+		TradeTime:        ms,
+		Ignore:           true,
+	}
+}
+
+// waitFor ждет, пока cond не станет true
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Сделки с фейковой биржи проходят WSclient, processor и агрегатор свечей;
+// битый фрейм пропускается, после обрыва клиент переподписывается сам
+func TestPipelineAgainstMockExchange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := mockexchange.New(mockexchange.Config{Scripted: true})
+	url, err := srv.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := make(chan []byte, 100)
+	trades := make(chan models.UniversalTrade, 100)
+	windows := make(chan *models.Window, 100)
+
+	client := websocket.New(url+"/stream", raw, 10*time.Millisecond)
+	go client.Start(ctx)
+	processor.New(raw, trades, exchange.NewBinance(url), processor.WithWorkers(1)).Start(ctx)
+
+	intervals, err := aggregator.ParseIntervals([]string{"1m"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go aggregator.NewWindowAggregator(aggregator.WindowConfig{
+		Intervals: intervals,
+		MaxDelay:  time.Second,
+	}, trades, windows).Start(ctx)
+
+	waitFor(t, "connection", func() bool { return srv.Connections() == 1 })
+	if err := client.Subscriptions().Subscribe(ctx, stream); err != nil {
+		t.Fatal(err)
+	}
+
+	before := client.Stats().Messages
+	srv.Broadcast(stream, aggTrade(1, 1*time.Second, "100.5", "1"))
+	srv.SendMalformed()
+	srv.Broadcast(stream, aggTrade(2, 20*time.Second, "103", "0.5"))
+
+	// Обрываем, когда клиент прочитал все три фрейма: иначе они пропадут вместе с соединением
+	waitFor(t, "frames", func() bool { return client.Stats().Messages >= before+3 })
+	srv.DisconnectAll()
+	waitFor(t, "resubscription", func() bool {
+		// LIST_SUBSCRIPTIONS отвечает сервер: стрим снова на новом соединении
+		list, err := client.Subscriptions().List(ctx)
+		return err == nil && slices.Contains(list, stream)
+	})
+	srv.Broadcast(stream, aggTrade(3, 40*time.Second, "99", "2"))
+	srv.Broadcast(stream, aggTrade(4, 70*time.Second, "101", "1"))
+
+	var w *models.Window
+	select {
+	case w = <-windows:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no candle")
+	}
+
+	if w.Symbol != "BTCUSDT" || !w.StartTime.Equal(t0) || !w.EndTime.Equal(t0.Add(time.Minute)) {
+		t.Errorf("candle %s %s-%s, want BTCUSDT first minute", w.Symbol, w.StartTime, w.EndTime)
+	}
+	got := []string{w.Open.String(), w.High.String(), w.Low.String(), w.Close.String(), w.Quantity.String()}
+	if want := []string{"100.5", "103", "99", "99", "3.5"}; !slices.Equal(got, want) {
+		t.Errorf("OHLCV = %v, want %v", got, want)
+	}
+	if w.Trades != 3 || w.FirstTradeID != 1 || w.LastTradeID != 3 {
+		t.Errorf("trades %d, ids %d-%d, want 3 trades, ids 1-3", w.Trades, w.FirstTradeID, w.LastTradeID)
+	}
+	if s := client.Stats(); s.Reconnects != 1 {
+		t.Errorf("reconnects = %d, want 1", s.Reconnects)
+	}
+}
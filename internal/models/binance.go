@@ -15,6 +15,21 @@ type AggTrade struct {
 	Ignore           bool   `json:"M"` // Игнорировать (всегда true)
 }
 
+// Trade - отдельная сделка (@trade), без агрегации по заявке тейкера
+type Trade struct {
+	EventType     string `json:"e"` // "trade"
+	EventTime     int64  `json:"E"` // Время когда сервер отправил
+	Symbol        string `json:"s"` // Торговая пара
+	TradeID       int64  `json:"t"` // ID сделки
+	Price         string `json:"p"` // Цена сделки
+	Quantity      string `json:"q"` // Объем сделки
+	BuyerOrderID  int64  `json:"b"` // ID заявки покупателя (Binance перестал присылать, может быть 0)
+	SellerOrderID int64  `json:"a"` // ID заявки продавца (Binance перестал присылать, может быть 0)
+	TradeTime     int64  `json:"T"` // Время самой сделки
+	IsBuyer       bool   `json:"m"` // Покупатель - мейкер
+	Ignore        bool   `json:"M"` // Игнорировать (всегда true)
+}
+
 type MiniTicker struct {
 	EventType     string `json:"e"` // "24hrMiniTicker"
 	EventTime     int64  `json:"E"` // Время отправки
@@ -26,3 +41,85 @@ type MiniTicker struct {
 	TotalBaseVol  string `json:"v"` // Объем (base asset)
 	TotalQuoteVol string `json:"q"` // Объем (quote asset)
 }
+
+type Kline struct {
+	EventType string    `json:"e"` // "kline"
+	EventTime int64     `json:"E"` // Время отправки
+	Symbol    string    `json:"s"` // Торговая пара
+	Kline     KlineData `json:"k"` // Сама свеча
+}
+
+type KlineData struct {
+	StartTime        int64  `json:"t"` // Время открытия свечи
+	CloseTime        int64  `json:"T"` // Время закрытия свечи
+	Symbol           string `json:"s"` // Торговая пара
+	Interval         string `json:"i"` // Интервал: 1m, 1h, ...
+	FirstTradeID     int64  `json:"f"` // ID первой сделки
+	LastTradeID      int64  `json:"L"` // ID последней сделки
+	OpenPrice        string `json:"o"` // Открытие
+	ClosePrice       string `json:"c"` // Закрытие (текущая цена, пока свеча не закрыта)
+	HighPrice        string `json:"h"` // Максимум
+	LowPrice         string `json:"l"` // Минимум
+	BaseVolume       string `json:"v"` // Объем (base asset)
+	Trades           int64  `json:"n"` // Количество сделок
+	IsClosed         bool   `json:"x"` // Свеча закрыта
+	QuoteVolume      string `json:"q"` // Объем (quote asset)
+	TakerBuyBaseVol  string `json:"V"` // Объем покупок тейкером (base asset)
+	TakerBuyQuoteVol string `json:"Q"` // Объем покупок тейкером (quote asset)
+	Ignore           string `json:"B"` // Игнорировать
+}
+
+// BookTicker - лучшие bid/ask (@bookTicker). Поля "e" у spot нет,
+// тип определяется по имени стрима или по набору полей
+type BookTicker struct {
+	UpdateID  int64  `json:"u"`           // ID обновления стакана
+	EventTime int64  `json:"E,omitempty"` // Время отправки (только у futures, у spot нет)
+	Symbol    string `json:"s"`           // Торговая пара
+	BidPrice  string `json:"b"`           // Лучшая цена покупки
+	BidQty    string `json:"B"`           // Объем на лучшей цене покупки
+	AskPrice  string `json:"a"`           // Лучшая цена продажи
+	AskQty    string `json:"A"`           // Объем на лучшей цене продажи
+}
+
+// DepthUpdate - изменения стакана (@depth, @depth@100ms). Уровни [цена, объем],
+// объем 0 - уровень удален. Применяются по порядку U/u поверх снимка DepthSnapshot
+type DepthUpdate struct {
+	EventType     string     `json:"e"` // "depthUpdate"
+	EventTime     int64      `json:"E"` // Время отправки
+	Symbol        string     `json:"s"` // Торговая пара
+	FirstUpdateID int64      `json:"U"` // Первый ID обновления в событии
+	FinalUpdateID int64      `json:"u"` // Последний ID обновления в событии
+	Bids          [][]string `json:"b"` // Изменения покупок
+	Asks          [][]string `json:"a"` // Изменения продаж
+}
+
+// DepthSnapshot - снимок стакана из REST GET /api/v3/depth
+type DepthSnapshot struct {
+	LastUpdateID int64      `json:"lastUpdateId"` // ID последнего вошедшего обновления
+	Bids         [][]string `json:"bids"`         // Покупки, по убыванию цены
+	Asks         [][]string `json:"asks"`         // Продажи, по возрастанию цены
+}
+
+// ExchangeInfo - правила торговли из REST GET /api/v3/exchangeInfo.
+// Из всего ответа нужны только символы
+type ExchangeInfo struct {
+	ServerTime int64        `json:"serverTime"` // Время сервера, мс
+	Symbols    []SymbolInfo `json:"symbols"`
+}
+
+// SymbolInfo - символ в exchangeInfo. Шаг цены и объема - в фильтрах
+// PRICE_FILTER (tickSize) и LOT_SIZE (stepSize)
+type SymbolInfo struct {
+	Symbol     string         `json:"symbol"`     // "BTCUSDT"
+	Status     string         `json:"status"`     // "TRADING", "HALT", "BREAK", ...
+	BaseAsset  string         `json:"baseAsset"`  // "BTC"
+	QuoteAsset string         `json:"quoteAsset"` // "USDT"
+	Filters    []SymbolFilter `json:"filters"`
+}
+
+// SymbolFilter - фильтр символа; поля зависят от filterType
+type SymbolFilter struct {
+	FilterType string `json:"filterType"`         // "PRICE_FILTER", "LOT_SIZE", ...
+	TickSize   string `json:"tickSize,omitempty"` // PRICE_FILTER: шаг цены
+	StepSize   string `json:"stepSize,omitempty"` // LOT_SIZE: шаг объема
+}
@@ -0,0 +1,32 @@
+package models
+
+type BybitTrade struct {
+	TradeTime  int64  `json:"T"`  // Время сделки
+	Symbol     string `json:"s"`  // Торговая пара
+	Side       string `json:"S"`  // Сторона тейкера: "Buy" | "Sell"
+	Quantity   string `json:"v"`  // Объем сделки
+	Price      string `json:"p"`  // Цена сделки
+	TickDir    string `json:"L"`  // Направление изменения цены
+	TradeID    string `json:"i"`  // ID сделки
+	BlockTrade bool   `json:"BT"` // Блочная сделка
+}
+
+type BybitTicker struct {
+	Symbol       string `json:"symbol"`       // Торговая пара
+	LastPrice    string `json:"lastPrice"`    // Текущая цена
+	PrevPrice24h string `json:"prevPrice24h"` // Цена 24ч назад
+	HighPrice24h string `json:"highPrice24h"` // Максимум за 24ч
+	LowPrice24h  string `json:"lowPrice24h"`  // Минимум за 24ч
+	Volume24h    string `json:"volume24h"`    // Объем (base asset)
+	Turnover24h  string `json:"turnover24h"`  // Объем (quote asset)
+}
+
+// BybitOrderbook - стакан orderbook.<depth>.<symbol>; уровни [цена, объем].
+// Для глубины 1 каждое сообщение - snapshot лучших цен
+type BybitOrderbook struct {
+	Symbol   string     `json:"s"`   // Торговая пара
+	Bids     [][]string `json:"b"`   // Покупки, по убыванию цены
+	Asks     [][]string `json:"a"`   // Продажи, по возрастанию цены
+	UpdateID int64      `json:"u"`   // ID обновления
+	Seq      int64      `json:"seq"` // Кросс-последовательность
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// CoinbaseMessage - сообщение Coinbase Advanced Trade market data:
+// {"channel":"market_trades","timestamp":"...","sequence_num":0,"events":[...]}
+type CoinbaseMessage[T any] struct {
+	Channel     string    `json:"channel"` // "market_trades", "ticker", "heartbeats", "subscriptions"
+	Timestamp   time.Time `json:"timestamp"`
+	SequenceNum int64     `json:"sequence_num"`
+	Events      []T       `json:"events"`
+}
+
+type CoinbaseTradesEvent struct {
+	Type   string          `json:"type"` // "snapshot" | "update"
+	Trades []CoinbaseTrade `json:"trades"`
+}
+
+type CoinbaseTrade struct {
+	TradeID   string    `json:"trade_id"`   // ID сделки
+	ProductID string    `json:"product_id"` // "BTC-USD"
+	Price     string    `json:"price"`      // Цена сделки
+	Size      string    `json:"size"`       // Объем сделки
+	Side      string    `json:"side"`       // Сторона тейкера: "BUY" | "SELL"
+	Time      time.Time `json:"time"`       // Время сделки
+}
+
+type CoinbaseTickerEvent struct {
+	Type    string           `json:"type"` // "snapshot" | "update"
+	Tickers []CoinbaseTicker `json:"tickers"`
+}
+
+type CoinbaseTicker struct {
+	ProductID          string `json:"product_id"`             // "BTC-USD"
+	Price              string `json:"price"`                  // Текущая цена
+	Volume24h          string `json:"volume_24_h"`            // Объем (base asset)
+	Low24h             string `json:"low_24_h"`               // Минимум за 24ч
+	High24h            string `json:"high_24_h"`              // Максимум за 24ч
+	PricePercentChg24h string `json:"price_percent_chg_24_h"` // Изменение за 24ч, %
+}
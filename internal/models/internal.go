@@ -4,75 +4,338 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+)
+
+const (
+	// percentScale - знаков после точки в процентах изменения цены
+	percentScale = 4
+	// bpsScale - знаков после точки в спреде в базисных пунктах
+	bpsScale = 2
 )
 
 type UniversalTrade struct {
 	// ОБЩИЕ ПОЛЯ (есть у всех типов)
+	Exchange  string    `json:"exchange"`   // "binance", "bybit", "okx", "coinbase"
 	Symbol    string    `json:"symbol"`     // "BTCUSDT"
 	Timestamp time.Time `json:"timestamp"`  // Когда произошло
-	EventType string    `json:"event_type"` // "aggTrade", "miniTicker"
+	EventType string    `json:"event_type"` // "aggTrade", "trade", "24hrMiniTicker", "kline", "bookTicker", "depthUpdate"
+
+	// НОРМАЛИЗОВАННЫЙ СИМВОЛ (из метаданных биржи, пусто - метаданных нет)
+	Base  string `json:"base,omitempty"`  // "BTC"
+	Quote string `json:"quote,omitempty"` // "USDT"
+	Pair  string `json:"pair,omitempty"`  // "BTC/USDT"
 
 	// ОСНОВНАЯ ЦЕНА (всегда заполнено)
-	Price float64 `json:"price"` // Текущая/последняя цена
+	Price decimal.Decimal `json:"price"` // Текущая/последняя цена
 
-	// ДЛЯ aggTrade
-	Quantity     float64 `json:"quantity,omitempty"`       // Объем сделки
-	IsBuyerMaker bool    `json:"is_buyer_maker,omitempty"` // Направление
+	// ДЛЯ aggTrade и trade
+	Quantity     decimal.Decimal `json:"quantity,omitzero"`        // Объем сделки
+	IsBuyerMaker bool            `json:"is_buyer_maker,omitempty"` // Направление
+
+	// ТОЛЬКО ДЛЯ aggTrade: по AggTradeID ищутся пропуски
+	AggTradeID   int64 `json:"agg_trade_id,omitempty"`   // ID агрегированной сделки, растет на 1
+	FirstTradeID int64 `json:"first_trade_id,omitempty"` // ID первой вошедшей сделки
+	LastTradeID  int64 `json:"last_trade_id,omitempty"`  // ID последней вошедшей сделки
+	Backfilled   bool  `json:"backfilled,omitempty"`     // Догружена по REST после пропуска
+
+	// ТОЛЬКО ДЛЯ trade (отдельная сделка)
+	TradeID       int64 `json:"trade_id,omitempty"`        // ID сделки
+	BuyerOrderID  int64 `json:"buyer_order_id,omitempty"`  // ID заявки покупателя
+	SellerOrderID int64 `json:"seller_order_id,omitempty"` // ID заявки продавца
 
 	// ДЛЯ miniTicker (24ч статистика)
-	OpenPrice   float64 `json:"open_price,omitempty"`   // Цена открытия 24ч
-	HighPrice   float64 `json:"high_price,omitempty"`   // Максимум 24ч
-	LowPrice    float64 `json:"low_price,omitempty"`    // Минимум 24ч
-	Volume      float64 `json:"volume,omitempty"`       // Объем 24ч
-	QuoteVolume float64 `json:"quote_volume,omitempty"` // Объем в quote asset
+	OpenPrice   decimal.Decimal `json:"open_price,omitzero"`   // Цена открытия 24ч
+	HighPrice   decimal.Decimal `json:"high_price,omitzero"`   // Максимум 24ч
+	LowPrice    decimal.Decimal `json:"low_price,omitzero"`    // Минимум 24ч
+	Volume      decimal.Decimal `json:"volume,omitzero"`       // Объем 24ч
+	QuoteVolume decimal.Decimal `json:"quote_volume,omitzero"` // Объем в quote asset
+
+	// ДЛЯ kline (свеча биржи): OHLC в OpenPrice/HighPrice/LowPrice/Price,
+	// объемы в Volume/QuoteVolume
+	Interval   string    `json:"interval,omitempty"`    // "1m", "1h", ...
+	OpenTime   time.Time `json:"open_time,omitzero"`    // Начало свечи
+	CloseTime  time.Time `json:"close_time,omitzero"`   // Конец свечи
+	Closed     bool      `json:"closed,omitempty"`      // Свеча закрыта (x), дальше не изменится
+	TradeCount int64     `json:"trade_count,omitempty"` // Количество сделок
+
+	// ДЛЯ bookTicker (лучшие цены стакана); Price не заполняется
+	BidPrice decimal.Decimal `json:"bid_price,omitzero"`  // Лучшая цена покупки
+	BidQty   decimal.Decimal `json:"bid_qty,omitzero"`    // Объем на ней
+	AskPrice decimal.Decimal `json:"ask_price,omitzero"`  // Лучшая цена продажи
+	AskQty   decimal.Decimal `json:"ask_qty,omitzero"`    // Объем на ней
+	UpdateID int64           `json:"update_id,omitempty"` // ID обновления стакана, растет монотонно
+
+	// ДЛЯ depthUpdate (изменения стакана); последний ID - в UpdateID
+	FirstUpdateID int64        `json:"first_update_id,omitempty"` // Первый ID обновления в событии
+	Bids          []PriceLevel `json:"bids,omitempty"`            // Изменения покупок, объем 0 - уровень удален
+	Asks          []PriceLevel `json:"asks,omitempty"`            // Изменения продаж
+
+	// Правила проверки данных, которые событие не прошло (validation, действие flag)
+	Flags []string `json:"flags,omitempty"`
+}
+
+// PriceLevel - уровень стакана
+type PriceLevel struct {
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+// ParseLevels разбирает уровни стакана в формате бирж: [["цена","объем",...], ...]
+func ParseLevels(raw [][]string) ([]PriceLevel, error) {
+	levels := make([]PriceLevel, 0, len(raw))
+	for _, l := range raw {
+		if len(l) < 2 {
+			return nil, fmt.Errorf("invalid price level %v", l)
+		}
+		price, err := decimal.Parse(l[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid price %q: %w", l[0], err)
+		}
+		qty, err := decimal.Parse(l[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q: %w", l[1], err)
+		}
+		levels = append(levels, PriceLevel{Price: price, Quantity: qty})
+	}
+	return levels, nil
 }
 
 // Window for aggregator @aggTrade
 type Window struct {
 	Symbol    string
 	Interval  string
-	Open      float64
-	High      float64
-	Low       float64
-	Close     float64
-	Quantity  float64
+	Open      decimal.Decimal
+	High      decimal.Decimal
+	Low       decimal.Decimal
+	Close     decimal.Decimal
+	Quantity  decimal.Decimal
 	Trades    int
 	StartTime time.Time
 	EndTime   time.Time
 	TimeStamp time.Time
-	Mu        sync.Mutex
+
+	FirstTradeTime time.Time // время сделки Open
+	LastTradeTime  time.Time // время сделки Close
+	Revision       int       // 0 - первый выпуск, дальше - исправления опоздавшими сделками
+	Synthetic      bool      // сделок не было: OHLC - close предыдущей свечи, объем 0
+
+	// Поток тейкеров: buy - покупатель тейкер (IsBuyerMaker == false), sell - продавец
+	QuoteVolume     decimal.Decimal // сумма price * quantity
+	TakerBuyVolume  decimal.Decimal
+	TakerBuyQuote   decimal.Decimal
+	TakerSellVolume decimal.Decimal
+	TakerSellQuote  decimal.Decimal
+	MaxTradeSize    decimal.Decimal // самая крупная сделка (в base)
+	FirstTradeID    int64           // наименьший aggTrade ID (для trade - ID сделки), 0 - нет
+	LastTradeID     int64           // наибольший
+
+	Mu sync.Mutex
+}
+
+// Snapshot - копия свечи для отправки дальше: сама свеча еще может меняться
+func (w *Window) Snapshot() *Window {
+	w.Mu.Lock()
+	defer w.Mu.Unlock()
+
+	return &Window{
+		Symbol:    w.Symbol,
+		Interval:  w.Interval,
+		Open:      w.Open,
+		High:      w.High,
+		Low:       w.Low,
+		Close:     w.Close,
+		Quantity:  w.Quantity,
+		Trades:    w.Trades,
+		StartTime: w.StartTime,
+		EndTime:   w.EndTime,
+		TimeStamp: w.TimeStamp,
+
+		FirstTradeTime: w.FirstTradeTime,
+		LastTradeTime:  w.LastTradeTime,
+		Revision:       w.Revision,
+		Synthetic:      w.Synthetic,
+
+		QuoteVolume:     w.QuoteVolume,
+		TakerBuyVolume:  w.TakerBuyVolume,
+		TakerBuyQuote:   w.TakerBuyQuote,
+		TakerSellVolume: w.TakerSellVolume,
+		TakerSellQuote:  w.TakerSellQuote,
+		MaxTradeSize:    w.MaxTradeSize,
+		FirstTradeID:    w.FirstTradeID,
+		LastTradeID:     w.LastTradeID,
+	}
+}
+
+// VWAP возвращает среднюю цену, взвешенную объемом: QuoteVolume / Quantity
+func (w *Window) VWAP() decimal.Decimal {
+	scale := max(w.High.Scale(), w.Low.Scale()) + 2
+	return w.QuoteVolume.Div(w.Quantity, scale)
 }
 
 // DailyStat for aggregator @miniTicker
 type DailyStat struct {
 	Symbol      string
-	OpenPrice   float64
-	HighPrice   float64
-	LowPrice    float64
-	ClosePrice  float64
-	Volume      float64
-	QuoteVolume float64
+	Pair        string // "BTC/USDT", пусто - метаданных нет
+	Base        string
+	Quote       string
+	OpenPrice   decimal.Decimal
+	HighPrice   decimal.Decimal
+	LowPrice    decimal.Decimal
+	ClosePrice  decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
 	Timestamp   time.Time
 }
 
-// ChangePrice возвращает изменение цены за 24ч в процентах
-func (ds *DailyStat) ChangePrice() float64 {
-	return ds.ClosePrice - ds.OpenPrice
+// ChangePrice возвращает изменение цены за 24ч
+func (ds *DailyStat) ChangePrice() decimal.Decimal {
+	return ds.ClosePrice.Sub(ds.OpenPrice)
 }
 
 // ChangePercent возвращает изменение цены за 24ч в процентах
-func (ds *DailyStat) ChangePercent() float64 {
-	if ds.OpenPrice == 0 {
-		return 0
+func (ds *DailyStat) ChangePercent() decimal.Decimal {
+	if ds.OpenPrice.IsZero() {
+		return decimal.Zero
 	}
-	return ((ds.ClosePrice - ds.OpenPrice) / ds.OpenPrice) * 100
+	return ds.ChangePrice().Mul(decimal.FromInt(100)).Div(ds.OpenPrice, percentScale)
 }
 
 // ChangeFormatted возвращает форматированное изменение с эмодзи
 func (ds *DailyStat) ChangeFormatted() string {
-	change := ds.ChangePercent()
-	if change >= 0 {
-		return fmt.Sprintf("📈 +%.2f%%", change)
+	change := ds.ChangePercent().Rescale(2)
+	if change.Sign() >= 0 {
+		return fmt.Sprintf("📈 +%s%%", change)
+	}
+	return fmt.Sprintf("📉 %s%%", change)
+}
+
+// BookStat for aggregator @bookTicker - лучшие bid/ask символа
+type BookStat struct {
+	Exchange  string
+	Symbol    string
+	BidPrice  decimal.Decimal
+	BidQty    decimal.Decimal
+	AskPrice  decimal.Decimal
+	AskQty    decimal.Decimal
+	UpdateID  int64
+	Timestamp time.Time
+}
+
+// Spread возвращает спред ask - bid
+func (bs *BookStat) Spread() decimal.Decimal {
+	return bs.AskPrice.Sub(bs.BidPrice)
+}
+
+// MidPrice возвращает середину спреда
+func (bs *BookStat) MidPrice() decimal.Decimal {
+	return bs.BidPrice.Add(bs.AskPrice).Div(decimal.FromInt(2), bs.priceScale()+1)
+}
+
+// SpreadBps возвращает спред в базисных пунктах от mid price
+func (bs *BookStat) SpreadBps() decimal.Decimal {
+	mid := bs.MidPrice()
+	if mid.IsZero() {
+		return decimal.Zero
+	}
+	return bs.Spread().Mul(decimal.FromInt(10000)).Div(mid, bpsScale)
+}
+
+// MicroPrice возвращает mid, взвешенный объемами противоположных сторон:
+// (bid*askQty + ask*bidQty) / (bidQty + askQty). Ближе к той стороне,
+// где заявок меньше - туда цена скорее и сдвинется
+func (bs *BookStat) MicroPrice() decimal.Decimal {
+	total := bs.BidQty.Add(bs.AskQty)
+	if total.IsZero() {
+		return bs.MidPrice()
+	}
+	weighted := bs.BidPrice.Mul(bs.AskQty).Add(bs.AskPrice.Mul(bs.BidQty))
+	return weighted.Div(total, bs.priceScale()+2)
+}
+
+func (bs *BookStat) priceScale() uint8 {
+	return max(bs.BidPrice.Scale(), bs.AskPrice.Scale())
+}
+
+// OrderBookStat for orderbook @depth - срез локального стакана
+type OrderBookStat struct {
+	Exchange     string          `json:"exchange"`
+	Symbol       string          `json:"symbol"`
+	LastUpdateID int64           `json:"last_update_id"`
+	MidPrice     decimal.Decimal `json:"mid_price"`
+	Bids         []PriceLevel    `json:"bids"`      // лучшие N, по убыванию цены
+	Asks         []PriceLevel    `json:"asks"`      // лучшие N, по возрастанию цены
+	Depth        []DepthBand     `json:"depth"`     // накопленный объем в пределах ±X% от mid
+	Imbalance    decimal.Decimal `json:"imbalance"` // (bid - ask) / (bid + ask) по N уровням, от -1 до 1
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+// DepthBand - объем стакана от mid до mid ± Percent%
+type DepthBand struct {
+	Percent     decimal.Decimal `json:"percent"`
+	BidQty      decimal.Decimal `json:"bid_qty"`
+	AskQty      decimal.Decimal `json:"ask_qty"`
+	BidNotional decimal.Decimal `json:"bid_notional"` // в quote asset
+	AskNotional decimal.Decimal `json:"ask_notional"`
+}
+
+// TradeGap - пропуск в последовательности aggTrade ID символа
+type TradeGap struct {
+	Exchange   string    `json:"exchange"`
+	Symbol     string    `json:"symbol"`
+	FromID     int64     `json:"from_id"`    // первый пропущенный ID
+	ToID       int64     `json:"to_id"`      // последний пропущенный ID
+	Backfilled int64     `json:"backfilled"` // сколько догружено по REST
+	DetectedAt time.Time `json:"detected_at"`
+	Error      string    `json:"error,omitempty"` // почему догрузка не удалась
+}
+
+// Missing - сколько сделок пропущено
+func (g *TradeGap) Missing() int64 {
+	return g.ToID - g.FromID + 1
+}
+
+// SymbolStatusTrading - символ торгуется; остальные статусы (HALT, BREAK, ...)
+// значат, что символ приостановлен или снят с торгов
+const SymbolStatusTrading = "TRADING"
+
+// SymbolMeta - метаданные символа биржи
+type SymbolMeta struct {
+	Exchange string
+	Symbol   string // как в потоке: "BTCUSDT"
+	Base     string
+	Quote    string
+	Status   string
+	TickSize decimal.Decimal // шаг цены
+	StepSize decimal.Decimal // шаг объема
+}
+
+// Pair - нормализованный идентификатор "BASE/QUOTE"
+func (m *SymbolMeta) Pair() string {
+	return m.Base + "/" + m.Quote
+}
+
+// Tradable - символ торгуется
+func (m *SymbolMeta) Tradable() bool {
+	return m.Status == SymbolStatusTrading
+}
+
+// PartialError - сообщение разобрано не целиком: часть элементов (тикеры
+// массива) отброшена. Decode возвращает ее вместе с удачными событиями
+type PartialError struct {
+	Skipped []SkippedItem
+}
+
+// SkippedItem - отброшенный элемент сообщения
+type SkippedItem struct {
+	Raw []byte // элемент в JSON
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	if len(e.Skipped) == 1 {
+		return fmt.Sprintf("1 item skipped: %v", e.Skipped[0].Err)
 	}
-	return fmt.Sprintf("📉 %.2f%%", change)
+	return fmt.Sprintf("%d items skipped, first: %v", len(e.Skipped), e.Skipped[0].Err)
 }
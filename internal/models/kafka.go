@@ -1,21 +1,30 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+)
 
 type KafkaMiniTicker struct {
 	MessageID string `json:"message_id"`
 
 	// 🪙 coin data
-	Symbol             string    `json:"symbol"`
-	OpenPrice          float64   `json:"open_price"`
-	HighPrice          float64   `json:"high_price"`
-	LowPrice           float64   `json:"low_price"`
-	ClosePrice         float64   `json:"close_price"`
-	Volume             float64   `json:"volume"`
-	QuoteVolume        float64   `json:"quote_volume"`
-	ChangePriceMoney   float64   `json:"change_price_money"`
-	ChangePricePercent float64   `json:"change_price_percent"`
-	Timestamp          time.Time `json:"timestamp"`
+	// Цены и объемы сериализуются точными строками без незначащих нулей:
+	// "16541.34" (Parse их отбрасывает)
+	Symbol             string          `json:"symbol"`
+	Pair               string          `json:"pair,omitempty"` // "BTC/USDT"
+	Base               string          `json:"base,omitempty"`
+	Quote              string          `json:"quote,omitempty"`
+	OpenPrice          decimal.Decimal `json:"open_price"`
+	HighPrice          decimal.Decimal `json:"high_price"`
+	LowPrice           decimal.Decimal `json:"low_price"`
+	ClosePrice         decimal.Decimal `json:"close_price"`
+	Volume             decimal.Decimal `json:"volume"`
+	QuoteVolume        decimal.Decimal `json:"quote_volume"`
+	ChangePriceMoney   decimal.Decimal `json:"change_price_money"`
+	ChangePricePercent decimal.Decimal `json:"change_price_percent"`
+	Timestamp          time.Time       `json:"timestamp"`
 }
 
 // type KafkaBatchModel struct {
@@ -30,6 +39,9 @@ func FromDailyStatIntoKafkaMiniTicker(stat *DailyStat, messageID string) *KafkaM
 	return &KafkaMiniTicker{
 		MessageID:          messageID,
 		Symbol:             stat.Symbol,
+		Pair:               stat.Pair,
+		Base:               stat.Base,
+		Quote:              stat.Quote,
 		OpenPrice:          stat.OpenPrice,
 		HighPrice:          stat.HighPrice,
 		LowPrice:           stat.LowPrice,
@@ -41,3 +53,101 @@ func FromDailyStatIntoKafkaMiniTicker(stat *DailyStat, messageID string) *KafkaM
 		Timestamp:          stat.Timestamp,
 	}
 }
+
+// KafkaCandle - свеча из сделок. Revision > 0 - та же свеча, исправленная
+// опоздавшими сделками: потребитель заменяет ей прежнюю
+type KafkaCandle struct {
+	MessageID string `json:"message_id"`
+
+	Symbol         string          `json:"symbol"`
+	Interval       string          `json:"interval"`
+	Open           decimal.Decimal `json:"open"`
+	High           decimal.Decimal `json:"high"`
+	Low            decimal.Decimal `json:"low"`
+	Close          decimal.Decimal `json:"close"`
+	Volume         decimal.Decimal `json:"volume"`
+	QuoteVolume    decimal.Decimal `json:"quote_volume"`
+	VWAP           decimal.Decimal `json:"vwap"`
+	Trades         int             `json:"trades"`
+	OpenTime       time.Time       `json:"open_time"`
+	CloseTime      time.Time       `json:"close_time"`
+	FirstTradeTime time.Time       `json:"first_trade_time,omitzero"`
+	LastTradeTime  time.Time       `json:"last_trade_time,omitzero"`
+	FirstTradeID   int64           `json:"first_trade_id,omitempty"`
+	LastTradeID    int64           `json:"last_trade_id,omitempty"`
+	Revision       int             `json:"revision"`
+	Synthetic      bool            `json:"synthetic,omitempty"` // сделок не было, OHLC - close предыдущей
+
+	// Поток тейкеров: buy - покупатель тейкер, sell - продавец
+	TakerBuyVolume  decimal.Decimal `json:"taker_buy_volume"`
+	TakerBuyQuote   decimal.Decimal `json:"taker_buy_quote"`
+	TakerSellVolume decimal.Decimal `json:"taker_sell_volume"`
+	TakerSellQuote  decimal.Decimal `json:"taker_sell_quote"`
+	MaxTradeSize    decimal.Decimal `json:"max_trade_size"`
+}
+
+func FromWindowIntoKafkaCandle(w *Window, messageID string) *KafkaCandle {
+	return &KafkaCandle{
+		MessageID:      messageID,
+		Symbol:         w.Symbol,
+		Interval:       w.Interval,
+		Open:           w.Open,
+		High:           w.High,
+		Low:            w.Low,
+		Close:          w.Close,
+		Volume:         w.Quantity,
+		QuoteVolume:    w.QuoteVolume,
+		VWAP:           w.VWAP(),
+		Trades:         w.Trades,
+		OpenTime:       w.StartTime,
+		CloseTime:      w.EndTime,
+		FirstTradeTime: w.FirstTradeTime,
+		LastTradeTime:  w.LastTradeTime,
+		FirstTradeID:   w.FirstTradeID,
+		LastTradeID:    w.LastTradeID,
+		Revision:       w.Revision,
+		Synthetic:      w.Synthetic,
+
+		TakerBuyVolume:  w.TakerBuyVolume,
+		TakerBuyQuote:   w.TakerBuyQuote,
+		TakerSellVolume: w.TakerSellVolume,
+		TakerSellQuote:  w.TakerSellQuote,
+		MaxTradeSize:    w.MaxTradeSize,
+	}
+}
+
+// KafkaBookTicker - лучшие цены и метрики спреда для execution
+type KafkaBookTicker struct {
+	MessageID string `json:"message_id"`
+
+	Exchange   string          `json:"exchange"`
+	Symbol     string          `json:"symbol"`
+	BidPrice   decimal.Decimal `json:"bid_price"`
+	BidQty     decimal.Decimal `json:"bid_qty"`
+	AskPrice   decimal.Decimal `json:"ask_price"`
+	AskQty     decimal.Decimal `json:"ask_qty"`
+	Spread     decimal.Decimal `json:"spread"`
+	SpreadBps  decimal.Decimal `json:"spread_bps"`
+	MidPrice   decimal.Decimal `json:"mid_price"`
+	MicroPrice decimal.Decimal `json:"micro_price"`
+	UpdateID   int64           `json:"update_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+func FromBookStatIntoKafkaBookTicker(stat *BookStat, messageID string) *KafkaBookTicker {
+	return &KafkaBookTicker{
+		MessageID:  messageID,
+		Exchange:   stat.Exchange,
+		Symbol:     stat.Symbol,
+		BidPrice:   stat.BidPrice,
+		BidQty:     stat.BidQty,
+		AskPrice:   stat.AskPrice,
+		AskQty:     stat.AskQty,
+		Spread:     stat.Spread(),
+		SpreadBps:  stat.SpreadBps(),
+		MidPrice:   stat.MidPrice(),
+		MicroPrice: stat.MicroPrice(),
+		UpdateID:   stat.UpdateID,
+		Timestamp:  stat.Timestamp,
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+// OKXMessage - сообщение публичного канала OKX v5:
+// {"arg":{"channel":"trades","instId":"BTC-USDT"},"data":[...]}
+type OKXMessage[T any] struct {
+	Arg  OKXArg `json:"arg"`
+	Data []T    `json:"data"`
+}
+
+type OKXArg struct {
+	Channel string `json:"channel"` // "trades", "tickers"
+	InstID  string `json:"instId"`  // "BTC-USDT"
+}
+
+type OKXTrade struct {
+	InstID   string `json:"instId"`  // Инструмент
+	TradeID  string `json:"tradeId"` // ID сделки
+	Price    string `json:"px"`      // Цена сделки
+	Quantity string `json:"sz"`      // Объем сделки
+	Side     string `json:"side"`    // Сторона тейкера: "buy" | "sell"
+	Ts       string `json:"ts"`      // Время сделки (мс, строкой)
+}
+
+type OKXTicker struct {
+	InstID    string `json:"instId"`    // Инструмент
+	Last      string `json:"last"`      // Текущая цена
+	Open24h   string `json:"open24h"`   // Цена 24ч назад
+	High24h   string `json:"high24h"`   // Максимум за 24ч
+	Low24h    string `json:"low24h"`    // Минимум за 24ч
+	Vol24h    string `json:"vol24h"`    // Объем (base asset)
+	VolCcy24h string `json:"volCcy24h"` // Объем (quote asset)
+	Ts        string `json:"ts"`        // Время (мс, строкой)
+}
+
+// OKXBook - стакан (bbo-tbt, books5); уровни [цена, объем, "0", число заявок]
+type OKXBook struct {
+	Asks  [][]string `json:"asks"`  // Продажи, по возрастанию цены
+	Bids  [][]string `json:"bids"`  // Покупки, по убыванию цены
+	Ts    string     `json:"ts"`    // Время (мс, строкой)
+	SeqID int64      `json:"seqId"` // ID обновления
+}
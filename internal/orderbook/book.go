@@ -0,0 +1,155 @@
+// Package orderbook - локальный стакан по снимку REST и изменениям depthUpdate
+package orderbook
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// imbalanceScale - знаков после точки в дисбалансе стакана
+const imbalanceScale = 4
+
+// Book - стакан одного символа. Уровни хранятся отсортированными:
+// лучшая цена первой, поэтому top-N и глубина считаются без сортировки
+type Book struct {
+	Symbol       string
+	LastUpdateID int64
+
+	bids []models.PriceLevel // по убыванию цены
+	asks []models.PriceLevel // по возрастанию цены
+}
+
+// NewBook собирает стакан из снимка REST
+func NewBook(symbol string, snap models.DepthSnapshot) (*Book, error) {
+	bids, err := models.ParseLevels(snap.Bids)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot bids: %w", err)
+	}
+	asks, err := models.ParseLevels(snap.Asks)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot asks: %w", err)
+	}
+
+	b := &Book{Symbol: symbol, LastUpdateID: snap.LastUpdateID}
+	for _, l := range bids {
+		b.bids = setLevel(b.bids, l, bidBefore)
+	}
+	for _, l := range asks {
+		b.asks = setLevel(b.asks, l, askBefore)
+	}
+	return b, nil
+}
+
+// Apply применяет изменения depthUpdate. Порядок U/u проверяет вызывающий
+func (b *Book) Apply(update models.UniversalTrade) {
+	for _, l := range update.Bids {
+		b.bids = setLevel(b.bids, l, bidBefore)
+	}
+	for _, l := range update.Asks {
+		b.asks = setLevel(b.asks, l, askBefore)
+	}
+	b.LastUpdateID = update.UpdateID
+}
+
+// Top возвращает копии лучших n уровней каждой стороны
+func (b *Book) Top(n int) (bids, asks []models.PriceLevel) {
+	return clone(b.bids, n), clone(b.asks, n)
+}
+
+// Mid - середина между лучшими bid и ask; false, если одна из сторон пуста
+func (b *Book) Mid() (decimal.Decimal, bool) {
+	if len(b.bids) == 0 || len(b.asks) == 0 {
+		return decimal.Zero, false
+	}
+	bid, ask := b.bids[0].Price, b.asks[0].Price
+	scale := max(bid.Scale(), ask.Scale()) + 1
+	return bid.Add(ask).Div(decimal.FromInt(2), scale), true
+}
+
+// DepthAt - накопленный объем от mid до mid*(1 ± percent/100)
+func (b *Book) DepthAt(percent decimal.Decimal) models.DepthBand {
+	band := models.DepthBand{Percent: percent}
+
+	mid, ok := b.Mid()
+	if !ok {
+		return band
+	}
+
+	offset := mid.Mul(percent).Div(decimal.FromInt(100), mid.Scale()+percent.Scale())
+	lower, upper := mid.Sub(offset), mid.Add(offset)
+
+	for _, l := range b.bids {
+		if l.Price.LessThan(lower) {
+			break
+		}
+		band.BidQty = band.BidQty.Add(l.Quantity)
+		band.BidNotional = band.BidNotional.Add(l.Price.Mul(l.Quantity))
+	}
+	for _, l := range b.asks {
+		if l.Price.GreaterThan(upper) {
+			break
+		}
+		band.AskQty = band.AskQty.Add(l.Quantity)
+		band.AskNotional = band.AskNotional.Add(l.Price.Mul(l.Quantity))
+	}
+	return band
+}
+
+// Imbalance - (bidQty - askQty) / (bidQty + askQty) по n лучшим уровням:
+// 1 - только покупатели, -1 - только продавцы
+func (b *Book) Imbalance(n int) decimal.Decimal {
+	var bidQty, askQty decimal.Decimal
+	for _, l := range b.bids[:min(n, len(b.bids))] {
+		bidQty = bidQty.Add(l.Quantity)
+	}
+	for _, l := range b.asks[:min(n, len(b.asks))] {
+		askQty = askQty.Add(l.Quantity)
+	}
+
+	total := bidQty.Add(askQty)
+	if total.IsZero() {
+		return decimal.Zero
+	}
+	return bidQty.Sub(askQty).Div(total, imbalanceScale)
+}
+
+// Depth - количество уровней по сторонам
+func (b *Book) Depth() (bids, asks int) {
+	return len(b.bids), len(b.asks)
+}
+
+func bidBefore(a, b decimal.Decimal) bool { return a.GreaterThan(b) }
+func askBefore(a, b decimal.Decimal) bool { return a.LessThan(b) }
+
+// setLevel ставит объем на уровень, нулевой объем удаляет уровень
+func setLevel(levels []models.PriceLevel, l models.PriceLevel, before func(a, b decimal.Decimal) bool) []models.PriceLevel {
+	i := sort.Search(len(levels), func(i int) bool {
+		return !before(levels[i].Price, l.Price)
+	})
+	found := i < len(levels) && levels[i].Price.Equal(l.Price)
+
+	switch {
+	case l.Quantity.IsZero() && found:
+		return append(levels[:i], levels[i+1:]...)
+	case l.Quantity.IsZero():
+		return levels
+	case found:
+		levels[i].Quantity = l.Quantity
+		return levels
+	}
+
+	levels = append(levels, models.PriceLevel{})
+	copy(levels[i+1:], levels[i:])
+	levels[i] = l
+	return levels
+}
+
+func clone(levels []models.PriceLevel, n int) []models.PriceLevel {
+	n = min(n, len(levels))
+	out := make([]models.PriceLevel, n)
+	copy(out, levels[:n])
+	return out
+}
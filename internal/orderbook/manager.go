@@ -0,0 +1,359 @@
+package orderbook
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const (
+	defaultSnapshotLimit = 1000
+	defaultTopLevels     = 10
+	defaultEmitInterval  = time.Second
+	defaultResyncDelay   = time.Second
+	defaultMaxBuffered   = 10000
+)
+
+// SnapshotSource - откуда берется снимок стакана; обычно *rest.Client
+type SnapshotSource interface {
+	DepthSnapshot(ctx context.Context, symbol string, limit int) (models.DepthSnapshot, error)
+}
+
+type Config struct {
+	SnapshotLimit int               // уровней в снимке REST (до 5000)
+	TopLevels     int               // уровней в выводе и в расчете дисбаланса
+	DepthPercents []decimal.Decimal // для глубины ±X% от mid, например 0.5, 1, 2
+	EmitInterval  time.Duration     // как часто выпускать OrderBookStat по изменившимся стаканам
+	ResyncDelay   time.Duration     // минимальная пауза между снимками одного символа
+	MaxBuffered   int               // сколько изменений копить, пока нет снимка
+}
+
+// Stats - счетчики синхронизации
+type Stats struct {
+	Applied int64 // применено изменений
+	Synced  int64 // успешных синхронизаций со снимком
+	Gaps    int64 // разрывов последовательности U/u
+}
+
+// symbolState - стакан символа и его синхронизация.
+// book == nil - стакан не синхронизирован: изменения копятся в buffer
+type symbolState struct {
+	exchange  string
+	symbol    string
+	book      *Book
+	buffer    []models.UniversalTrade
+	fetching  bool
+	retrying  bool // запланирован повторный запрос снимка
+	lastFetch time.Time
+	changed   bool
+}
+
+type snapshotResult struct {
+	symbol string
+	snap   models.DepthSnapshot
+	err    error
+}
+
+// Manager ведет локальные стаканы по изменениям depthUpdate.
+// Синхронизация по правилам Binance: копим изменения, берем снимок REST,
+// отбрасываем изменения с u <= lastUpdateId, дальше каждое следующее
+// должно начинаться с U = предыдущий u + 1. Разрыв - стакан выбрасывается
+// и собирается заново
+type Manager struct {
+	cfg    Config
+	source SnapshotSource
+
+	inputChan  <-chan models.UniversalTrade
+	outputChan chan<- *models.OrderBookStat
+	snapshots  chan snapshotResult
+	retries    chan string
+
+	mu      sync.Mutex
+	symbols map[string]*symbolState
+	stats   Stats
+}
+
+func NewManager(
+	cfg Config,
+	source SnapshotSource,
+	inChan <-chan models.UniversalTrade,
+	outChan chan<- *models.OrderBookStat,
+) *Manager {
+	if cfg.SnapshotLimit <= 0 {
+		cfg.SnapshotLimit = defaultSnapshotLimit
+	}
+	if cfg.TopLevels <= 0 {
+		cfg.TopLevels = defaultTopLevels
+	}
+	if cfg.EmitInterval <= 0 {
+		cfg.EmitInterval = defaultEmitInterval
+	}
+	if cfg.ResyncDelay <= 0 {
+		cfg.ResyncDelay = defaultResyncDelay
+	}
+	if cfg.MaxBuffered <= 0 {
+		cfg.MaxBuffered = defaultMaxBuffered
+	}
+
+	return &Manager{
+		cfg:        cfg,
+		source:     source,
+		inputChan:  inChan,
+		outputChan: outChan,
+		snapshots:  make(chan snapshotResult, 16),
+		retries:    make(chan string, 16),
+		symbols:    make(map[string]*symbolState),
+	}
+}
+
+func (m *Manager) Start(ctx context.Context) {
+	emit := time.NewTicker(m.cfg.EmitInterval)
+	defer emit.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case update, ok := <-m.inputChan:
+			if !ok {
+				return
+			}
+			if update.EventType == websocket.DepthUpdate {
+				m.handleUpdate(ctx, update)
+			}
+
+		case res := <-m.snapshots:
+			m.handleSnapshot(ctx, res)
+
+		case symbol := <-m.retries:
+			m.retry(ctx, symbol)
+
+		case now := <-emit.C:
+			m.emit(ctx, now)
+		}
+	}
+}
+
+// Stat возвращает текущий срез стакана символа; false, пока стакан не синхронизирован
+func (m *Manager) Stat(symbol string) (models.OrderBookStat, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.symbols[symbol]
+	if !ok || st.book == nil {
+		return models.OrderBookStat{}, false
+	}
+	return *m.buildStat(st, time.Now()), true
+}
+
+// Stats возвращает счетчики синхронизации
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+func (m *Manager) handleUpdate(ctx context.Context, update models.UniversalTrade) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.symbols[update.Symbol]
+	if !ok {
+		st = &symbolState{exchange: update.Exchange, symbol: update.Symbol}
+		m.symbols[update.Symbol] = st
+	}
+
+	if st.book != nil {
+		m.apply(ctx, st, update)
+		return
+	}
+
+	st.buffer = append(st.buffer, update)
+	if len(st.buffer) > m.cfg.MaxBuffered {
+		// Снимок, который старше оставшегося буфера, все равно не подойдет
+		st.buffer = st.buffer[len(st.buffer)-m.cfg.MaxBuffered:]
+	}
+	m.fetchSnapshot(ctx, st)
+}
+
+// apply применяет изменение к синхронизированному стакану
+func (m *Manager) apply(ctx context.Context, st *symbolState, update models.UniversalTrade) {
+	last := st.book.LastUpdateID
+
+	switch {
+	case update.UpdateID <= last:
+		// Уже вошло в снимок или пришло повторно
+		return
+
+	case update.FirstUpdateID > last+1:
+		m.stats.Gaps++
+		slog.Warn("⚠️ Order book sequence gap, resyncing",
+			"symbol", st.symbol,
+			"last_update_id", last,
+			"first_update_id", update.FirstUpdateID)
+
+		st.book = nil
+		st.buffer = append(st.buffer[:0], update)
+		m.fetchSnapshot(ctx, st)
+		return
+	}
+
+	st.book.Apply(update)
+	st.changed = true
+	m.stats.Applied++
+}
+
+// fetchSnapshot запрашивает снимок в фоне, не чаще раза в ResyncDelay.
+// Запрос, который пока нельзя отправить, откладывается: без этого символ
+// ждал бы следующего изменения, а для тихого символа оно может не прийти долго
+func (m *Manager) fetchSnapshot(ctx context.Context, st *symbolState) {
+	if st.fetching {
+		return
+	}
+	if wait := m.cfg.ResyncDelay - time.Since(st.lastFetch); wait > 0 {
+		m.scheduleRetry(ctx, st, wait)
+		return
+	}
+	st.fetching = true
+	st.lastFetch = time.Now()
+
+	symbol := st.symbol
+	go func() {
+		snap, err := m.source.DepthSnapshot(ctx, symbol, m.cfg.SnapshotLimit)
+		select {
+		case m.snapshots <- snapshotResult{symbol: symbol, snap: snap, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// scheduleRetry повторяет fetchSnapshot через wait; один таймер на символ
+func (m *Manager) scheduleRetry(ctx context.Context, st *symbolState, wait time.Duration) {
+	if st.retrying {
+		return
+	}
+	st.retrying = true
+
+	symbol := st.symbol
+	time.AfterFunc(wait, func() {
+		select {
+		case m.retries <- symbol:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (m *Manager) retry(ctx context.Context, symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.symbols[symbol]
+	st.retrying = false
+	if st.book == nil {
+		m.fetchSnapshot(ctx, st)
+	}
+}
+
+func (m *Manager) handleSnapshot(ctx context.Context, res snapshotResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.symbols[res.symbol]
+	st.fetching = false
+
+	if res.err != nil {
+		slog.Warn("⚠️ Could not fetch order book snapshot", "symbol", res.symbol, "error", res.err)
+		m.fetchSnapshot(ctx, st)
+		return
+	}
+
+	// Снимок должен перекрываться с буфером или стыковаться с ним
+	// (первое изменение - lastUpdateId + 1), иначе между ними потерянные изменения
+	if len(st.buffer) > 0 && res.snap.LastUpdateID+1 < st.buffer[0].FirstUpdateID {
+		slog.Debug("Order book snapshot is older than buffered updates, refetching",
+			"symbol", res.symbol,
+			"snapshot_id", res.snap.LastUpdateID,
+			"first_buffered", st.buffer[0].FirstUpdateID)
+		m.fetchSnapshot(ctx, st)
+		return
+	}
+
+	book, err := NewBook(res.symbol, res.snap)
+	if err != nil {
+		slog.Error("Invalid order book snapshot", "symbol", res.symbol, "error", err)
+		m.fetchSnapshot(ctx, st)
+		return
+	}
+
+	st.book = book
+	st.changed = true
+	m.stats.Synced++
+
+	buffered := st.buffer
+	st.buffer = nil
+	for _, update := range buffered {
+		m.apply(ctx, st, update)
+		if st.book == nil {
+			// Разрыв внутри буфера: apply уже начал новую синхронизацию
+			return
+		}
+	}
+
+	bids, asks := st.book.Depth()
+	slog.Info("📗 Order book synced",
+		"symbol", st.symbol,
+		"last_update_id", st.book.LastUpdateID,
+		"bids", bids,
+		"asks", asks,
+		"buffered", len(buffered))
+}
+
+// emit выпускает срезы стаканов, изменившихся с прошлого раза
+func (m *Manager) emit(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	stats := make([]*models.OrderBookStat, 0, len(m.symbols))
+	for _, st := range m.symbols {
+		if st.book == nil || !st.changed {
+			continue
+		}
+		st.changed = false
+		stats = append(stats, m.buildStat(st, now))
+	}
+	m.mu.Unlock()
+
+	for _, stat := range stats {
+		select {
+		case m.outputChan <- stat:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Manager) buildStat(st *symbolState, now time.Time) *models.OrderBookStat {
+	bids, asks := st.book.Top(m.cfg.TopLevels)
+	mid, _ := st.book.Mid()
+
+	depth := make([]models.DepthBand, 0, len(m.cfg.DepthPercents))
+	for _, pct := range m.cfg.DepthPercents {
+		depth = append(depth, st.book.DepthAt(pct))
+	}
+
+	return &models.OrderBookStat{
+		Exchange:     st.exchange,
+		Symbol:       st.symbol,
+		LastUpdateID: st.book.LastUpdateID,
+		MidPrice:     mid,
+		Bids:         bids,
+		Asks:         asks,
+		Depth:        depth,
+		Imbalance:    st.book.Imbalance(m.cfg.TopLevels),
+		Timestamp:    now,
+	}
+}
@@ -0,0 +1,150 @@
+package orderbook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// scriptedSource отдает снимки по порядку, последний - на все остальные запросы
+type scriptedSource struct {
+	mu    sync.Mutex
+	snaps []snapshotResult
+	calls int
+}
+
+func (s *scriptedSource) DepthSnapshot(context.Context, string, int) (models.DepthSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.snaps[min(s.calls, len(s.snaps)-1)]
+	s.calls++
+	return res.snap, res.err
+}
+
+func (s *scriptedSource) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func snapshot(lastUpdateID int64, bid string) snapshotResult {
+	return snapshotResult{snap: models.DepthSnapshot{
+		LastUpdateID: lastUpdateID,
+		Bids:         [][]string{{bid, "1"}},
+		Asks:         [][]string{{"200", "1"}},
+	}}
+}
+
+func depthUpdate(first, last int64, bid string) models.UniversalTrade {
+	return models.UniversalTrade{
+		Exchange:      "binance",
+		Symbol:        "BTCUSDT",
+		EventType:     websocket.DepthUpdate,
+		FirstUpdateID: first,
+		UpdateID:      last,
+		Bids:          []models.PriceLevel{{Price: decimal.MustParse(bid), Quantity: decimal.FromInt(2)}},
+	}
+}
+
+func startManager(t *testing.T, src SnapshotSource) (*Manager, chan<- models.UniversalTrade) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	in := make(chan models.UniversalTrade)
+	m := NewManager(Config{ResyncDelay: 20 * time.Millisecond}, src, in, make(chan *models.OrderBookStat, 100))
+	go m.Start(ctx)
+	return m, in
+}
+
+// synced ждет стакан символа с lastUpdateID
+func synced(t *testing.T, m *Manager, lastUpdateID int64) models.OrderBookStat {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if stat, ok := m.Stat("BTCUSDT"); ok && stat.LastUpdateID == lastUpdateID {
+			return stat
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stat, _ := m.Stat("BTCUSDT")
+	t.Fatalf("book not synced at %d, last_update_id %d, stats %+v", lastUpdateID, stat.LastUpdateID, m.Stats())
+	return stat
+}
+
+// Первое изменение после снимка начинается с lastUpdateId + 1 - это не разрыв
+func TestManagerSnapshotAdjacentToBuffer(t *testing.T) {
+	src := &scriptedSource{snaps: []snapshotResult{snapshot(100, "99")}}
+	m, in := startManager(t, src)
+
+	in <- depthUpdate(101, 105, "101")
+	stat := synced(t, m, 105)
+	if stat.Bids[0].Price.String() != "101" {
+		t.Errorf("best bid = %s, want 101", stat.Bids[0].Price)
+	}
+	if src.Calls() != 1 {
+		t.Errorf("snapshots = %d, want 1", src.Calls())
+	}
+}
+
+// Изменения, которые уже вошли в снимок, пропускаются
+func TestManagerSkipsBufferedBeforeSnapshot(t *testing.T) {
+	src := &scriptedSource{snaps: []snapshotResult{snapshot(100, "99")}}
+	m, in := startManager(t, src)
+
+	in <- depthUpdate(90, 95, "95")
+	in <- depthUpdate(96, 102, "102")
+	stat := synced(t, m, 102)
+	if len(stat.Bids) != 2 {
+		t.Errorf("bids = %v, want snapshot level and 102", stat.Bids)
+	}
+	if s := m.Stats(); s.Applied != 1 || s.Synced != 1 {
+		t.Errorf("stats = %+v, want 1 applied, 1 synced", s)
+	}
+}
+
+// Снимок старше буфера запрашивается заново
+func TestManagerSnapshotOlderThanBuffer(t *testing.T) {
+	src := &scriptedSource{snaps: []snapshotResult{snapshot(90, "90"), snapshot(110, "99")}}
+	m, in := startManager(t, src)
+
+	in <- depthUpdate(101, 105, "105")
+	in <- depthUpdate(106, 112, "112")
+	synced(t, m, 112)
+	if src.Calls() != 2 {
+		t.Errorf("snapshots = %d, want 2", src.Calls())
+	}
+}
+
+// Разрыв U/u - новая синхронизация; неудачный снимок повторяется сам,
+// без новых изменений
+func TestManagerGapAndRetry(t *testing.T) {
+	src := &scriptedSource{snaps: []snapshotResult{
+		snapshot(100, "99"),
+		{err: errors.New("rate limited")},
+		snapshot(205, "150"),
+	}}
+	m, in := startManager(t, src)
+
+	in <- depthUpdate(101, 105, "101")
+	synced(t, m, 105)
+
+	in <- depthUpdate(200, 210, "151")
+	stat := synced(t, m, 210)
+	if stat.Bids[0].Price.String() != "151" {
+		t.Errorf("best bid = %s, want 151", stat.Bids[0].Price)
+	}
+	if s := m.Stats(); s.Gaps != 1 || s.Synced != 2 {
+		t.Errorf("stats = %+v, want 1 gap, 2 synced", s)
+	}
+	if src.Calls() != 3 {
+		t.Errorf("snapshots = %d, want 3", src.Calls())
+	}
+}
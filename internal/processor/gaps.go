@@ -0,0 +1,409 @@
+package processor
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const (
+	defaultGapGrace       = 2 * time.Second
+	defaultMaxBackfill    = 10000
+	backfillPageSize      = 1000
+	errGapTooLarge        = "gap is too large to backfill"
+	backfillResultsBuffer = 16
+	maxLostRanges         = 100
+)
+
+// TradeSource - откуда догружать пропущенные aggTrade (exchange.BinanceBackfill)
+type TradeSource interface {
+	AggTrades(ctx context.Context, symbol string, fromID int64, limit int) ([]models.UniversalTrade, error)
+}
+
+type GapConfig struct {
+	// Grace - сколько ждать пропущенные ID до догрузки. Процессор выдает
+	// сделки символа по порядку, но во время ротации соединения два сокета
+	// идут вперемешку, и "пропуск" через мгновение заполняется сам
+	Grace time.Duration
+	// MaxBackfill - пропуски больше этого только сообщаются, без догрузки
+	MaxBackfill int64
+}
+
+// GapStats - счетчики детектора
+type GapStats struct {
+	Gaps       int64 // найдено пропусков
+	Missing    int64 // пропущено сделок
+	Backfilled int64 // догружено сделок
+	Duplicates int64 // отброшено повторов
+}
+
+// GapOption - дополнительная настройка детектора
+type GapOption func(*GapDetector)
+
+// WithBackfill включает догрузку пропущенных сделок
+func WithBackfill(src TradeSource) GapOption {
+	return func(d *GapDetector) {
+		d.source = src
+	}
+}
+
+type sequenceKey struct {
+	exchange string
+	symbol   string
+}
+
+// idRange - пропущенные ID from..to включительно
+type idRange struct {
+	from, to int64
+	detected time.Time
+}
+
+// sequence - последний (наибольший) ID символа и еще не пришедшие ID до него.
+// ID считается пришедшим, только когда сделка с ним отправлена дальше
+type sequence struct {
+	last     int64
+	missing  []idRange // ждут Grace
+	inflight []idRange // догружаются
+	lost     []idRange // не догрузились: если придут сами, пропускаются
+	pending  bool      // есть missing или inflight
+}
+
+type backfillResult struct {
+	gap    models.TradeGap
+	trades []models.UniversalTrade
+}
+
+// GapDetector следит за aggTrade ID каждого символа и пропускает события дальше.
+// Скачок ID, не заполненный за Grace, - пропуск: о нем сообщается в gaps,
+// а с WithBackfill недостающие сделки догружаются и отправляются дальше
+// с Backfilled = true. Повторы (ID уже был) отбрасываются. Пока пропуск
+// символа не закрыт, Pending(symbol) = true: агрегатор свечей держит watermark
+type GapDetector struct {
+	cfg    GapConfig
+	source TradeSource
+
+	inputChan  <-chan models.UniversalTrade
+	outputChan chan<- models.UniversalTrade
+	gapsChan   chan<- models.TradeGap
+	backfills  chan backfillResult
+
+	sequences map[sequenceKey]*sequence
+
+	mu      sync.Mutex
+	stats   GapStats
+	pending map[string]int // символ -> сколько его последовательностей ждут сделок
+}
+
+func NewGapDetector(
+	cfg GapConfig,
+	inChan <-chan models.UniversalTrade,
+	outChan chan<- models.UniversalTrade,
+	gapsChan chan<- models.TradeGap,
+	opts ...GapOption,
+) *GapDetector {
+	if cfg.Grace <= 0 {
+		cfg.Grace = defaultGapGrace
+	}
+	if cfg.MaxBackfill <= 0 {
+		cfg.MaxBackfill = defaultMaxBackfill
+	}
+
+	d := &GapDetector{
+		cfg:        cfg,
+		inputChan:  inChan,
+		outputChan: outChan,
+		gapsChan:   gapsChan,
+		backfills:  make(chan backfillResult, backfillResultsBuffer),
+		sequences:  make(map[sequenceKey]*sequence),
+		pending:    make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+func (d *GapDetector) Start(ctx context.Context) {
+	sweep := time.NewTicker(d.cfg.Grace / 2)
+	defer sweep.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case trade, ok := <-d.inputChan:
+			if !ok {
+				return
+			}
+			if !d.track(trade, time.Now()) {
+				continue
+			}
+			if !d.forward(ctx, trade) {
+				return
+			}
+
+		case res := <-d.backfills:
+			d.finishBackfill(ctx, res)
+
+		case now := <-sweep.C:
+			d.sweep(ctx, now)
+		}
+	}
+}
+
+// Stats возвращает счетчики детектора
+func (d *GapDetector) Stats() GapStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Pending - у символа есть пропуск, сделки которого еще могут прийти:
+// ждет Grace или догружается. Для aggregator.WithWatermarkHold
+func (d *GapDetector) Pending(symbol string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending[symbol] > 0
+}
+
+// setPending обновляет Pending символа после изменения его пропусков
+func (d *GapDetector) setPending(key sequenceKey, seq *sequence) {
+	pending := len(seq.missing) > 0 || len(seq.inflight) > 0
+	if pending == seq.pending {
+		return
+	}
+	seq.pending = pending
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if pending {
+		d.pending[key.symbol]++
+		return
+	}
+	if d.pending[key.symbol]--; d.pending[key.symbol] <= 0 {
+		delete(d.pending, key.symbol)
+	}
+}
+
+// track обновляет последовательность символа; false - событие повтор
+func (d *GapDetector) track(trade models.UniversalTrade, now time.Time) bool {
+	if trade.EventType != websocket.AggTrade || trade.AggTradeID == 0 || trade.Backfilled {
+		return true
+	}
+
+	key := sequenceKey{exchange: trade.Exchange, symbol: trade.Symbol}
+	seq, ok := d.sequences[key]
+	if !ok {
+		d.sequences[key] = &sequence{last: trade.AggTradeID}
+		return true
+	}
+
+	id := trade.AggTradeID
+	switch {
+	case id == seq.last+1:
+		seq.last = id
+	case id > seq.last+1:
+		seq.missing = append(seq.missing, idRange{from: seq.last + 1, to: id - 1, detected: now})
+		seq.last = id
+		d.setPending(key, seq)
+	case seq.fill(id):
+		d.setPending(key, seq)
+	default:
+		d.mu.Lock()
+		d.stats.Duplicates++
+		d.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// fill отмечает опоздавший ID; false - такого ID не ждали. ID, который
+// пришел сам во время догрузки, из догруженных уже не отправится
+func (s *sequence) fill(id int64) bool {
+	var ok bool
+	if s.missing, ok = takeID(s.missing, id); ok {
+		return true
+	}
+	if s.inflight, ok = takeID(s.inflight, id); ok {
+		return true
+	}
+	s.lost, ok = takeID(s.lost, id)
+	return ok
+}
+
+// takeID убирает id из диапазонов; false - его там нет
+func takeID(ranges []idRange, id int64) ([]idRange, bool) {
+	for i, r := range ranges {
+		if id < r.from || id > r.to {
+			continue
+		}
+
+		switch {
+		case r.from == r.to:
+			ranges = append(ranges[:i], ranges[i+1:]...)
+		case id == r.from:
+			ranges[i].from++
+		case id == r.to:
+			ranges[i].to--
+		default:
+			tail := idRange{from: id + 1, to: r.to, detected: r.detected}
+			ranges[i].to = id - 1
+			ranges = append(ranges, tail)
+		}
+		return ranges, true
+	}
+	return ranges, false
+}
+
+// settle - догрузка from..to закончилась: чего она не принесла, то
+// еще принимается, если придет само, но watermark больше не держит
+func (s *sequence) settle(from, to int64) {
+	kept := s.inflight[:0]
+	for _, r := range s.inflight {
+		if r.from >= from && r.to <= to {
+			s.addLost(r)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.inflight = kept
+}
+
+// addLost запоминает не пришедшие ID; хранятся только последние maxLostRanges
+func (s *sequence) addLost(r idRange) {
+	s.lost = append(s.lost, r)
+	if n := len(s.lost) - maxLostRanges; n > 0 {
+		s.lost = append(s.lost[:0], s.lost[n:]...)
+	}
+}
+
+// sweep сообщает о пропусках, которые не заполнились за Grace
+func (d *GapDetector) sweep(ctx context.Context, now time.Time) {
+	for key, seq := range d.sequences {
+		kept := seq.missing[:0]
+		for _, r := range seq.missing {
+			if now.Sub(r.detected) < d.cfg.Grace {
+				kept = append(kept, r)
+				continue
+			}
+			d.handleGap(ctx, seq, r, models.TradeGap{
+				Exchange:   key.exchange,
+				Symbol:     key.symbol,
+				FromID:     r.from,
+				ToID:       r.to,
+				DetectedAt: r.detected,
+			})
+		}
+		seq.missing = kept
+		d.setPending(key, seq)
+	}
+}
+
+func (d *GapDetector) handleGap(ctx context.Context, seq *sequence, r idRange, gap models.TradeGap) {
+	d.mu.Lock()
+	d.stats.Gaps++
+	d.stats.Missing += gap.Missing()
+	d.mu.Unlock()
+
+	switch {
+	case d.source == nil:
+		seq.addLost(r)
+		d.report(ctx, gap)
+	case gap.Missing() > d.cfg.MaxBackfill:
+		seq.addLost(r)
+		gap.Error = errGapTooLarge
+		d.report(ctx, gap)
+	default:
+		seq.inflight = append(seq.inflight, r)
+		go d.backfill(ctx, gap)
+	}
+}
+
+// backfill догружает from..to страницами в фоне
+func (d *GapDetector) backfill(ctx context.Context, gap models.TradeGap) {
+	var trades []models.UniversalTrade
+
+	for fromID := gap.FromID; fromID <= gap.ToID; {
+		limit := int(min(gap.ToID-fromID+1, backfillPageSize))
+		page, err := d.source.AggTrades(ctx, gap.Symbol, fromID, limit)
+		if err != nil {
+			gap.Error = err.Error()
+			break
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, t := range page {
+			if t.AggTradeID > gap.ToID {
+				break
+			}
+			trades = append(trades, t)
+		}
+		fromID = page[len(page)-1].AggTradeID + 1
+	}
+
+	select {
+	case d.backfills <- backfillResult{gap: gap, trades: trades}:
+	case <-ctx.Done():
+	}
+}
+
+// finishBackfill отправляет догруженные сделки, которые так и не пришли сами,
+// и только потом отпускает watermark символа
+func (d *GapDetector) finishBackfill(ctx context.Context, res backfillResult) {
+	key := sequenceKey{exchange: res.gap.Exchange, symbol: res.gap.Symbol}
+	seq := d.sequences[key]
+
+	for _, trade := range res.trades {
+		var ok bool
+		if seq.inflight, ok = takeID(seq.inflight, trade.AggTradeID); !ok {
+			continue
+		}
+		if !d.forward(ctx, trade) {
+			return
+		}
+		res.gap.Backfilled++
+	}
+	seq.settle(res.gap.FromID, res.gap.ToID)
+	d.setPending(key, seq)
+
+	d.mu.Lock()
+	d.stats.Backfilled += res.gap.Backfilled
+	d.mu.Unlock()
+
+	d.report(ctx, res.gap)
+}
+
+func (d *GapDetector) report(ctx context.Context, gap models.TradeGap) {
+	slog.Warn("🕳️ Trade sequence gap",
+		"exchange", gap.Exchange,
+		"symbol", gap.Symbol,
+		"from_id", gap.FromID,
+		"to_id", gap.ToID,
+		"missing", gap.Missing(),
+		"backfilled", gap.Backfilled,
+		"error", gap.Error)
+
+	if d.gapsChan == nil {
+		return
+	}
+	select {
+	case d.gapsChan <- gap:
+	case <-ctx.Done():
+	}
+}
+
+func (d *GapDetector) forward(ctx context.Context, trade models.UniversalTrade) bool {
+	select {
+	case d.outputChan <- trade:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
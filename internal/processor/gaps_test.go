@@ -0,0 +1,259 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+const testGrace = 20 * time.Millisecond
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// aggTrade - сделка BTCUSDT с ID id через id секунд после testStart
+func aggTrade(id int64) models.UniversalTrade {
+	return models.UniversalTrade{
+		Exchange:   "binance",
+		Symbol:     "BTCUSDT",
+		EventType:  websocket.AggTrade,
+		AggTradeID: id,
+		Timestamp:  testStart.Add(time.Duration(id) * time.Second),
+		Price:      decimal.FromInt(100 + id),
+		Quantity:   decimal.FromInt(1),
+	}
+}
+
+// fakeSource отдает сделки с любыми ID до upTo; с release ждет его закрытия
+type fakeSource struct {
+	upTo    int64
+	err     error
+	release chan struct{}
+}
+
+func (s *fakeSource) AggTrades(ctx context.Context, _ string, fromID int64, limit int) ([]models.UniversalTrade, error) {
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var trades []models.UniversalTrade
+	for id := fromID; id <= s.upTo && len(trades) < limit; id++ {
+		trade := aggTrade(id)
+		trade.Backfilled = true
+		trades = append(trades, trade)
+	}
+	return trades, nil
+}
+
+type testDetector struct {
+	d    *GapDetector
+	in   chan models.UniversalTrade
+	out  chan models.UniversalTrade
+	gaps chan models.TradeGap
+}
+
+func newTestDetector(t *testing.T, opts ...GapOption) *testDetector {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	td := &testDetector{
+		in:   make(chan models.UniversalTrade),
+		out:  make(chan models.UniversalTrade, 100),
+		gaps: make(chan models.TradeGap, 10),
+	}
+	td.d = NewGapDetector(GapConfig{Grace: testGrace}, td.in, td.out, td.gaps, opts...)
+	go td.d.Start(ctx)
+	return td
+}
+
+func (td *testDetector) send(ids ...int64) {
+	for _, id := range ids {
+		td.in <- aggTrade(id)
+	}
+}
+
+// received - ID n следующих событий на выходе
+func (td *testDetector) received(t *testing.T, n int) []int64 {
+	t.Helper()
+	var ids []int64
+	for range n {
+		select {
+		case trade := <-td.out:
+			ids = append(ids, trade.AggTradeID)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d events", ids, n)
+		}
+	}
+	return ids
+}
+
+func (td *testDetector) gap(t *testing.T) models.TradeGap {
+	t.Helper()
+	select {
+	case gap := <-td.gaps:
+		return gap
+	case <-time.After(time.Second):
+		t.Fatal("no gap reported")
+		return models.TradeGap{}
+	}
+}
+
+// Пропуск, заполненный за Grace, - не пропуск; повтор отбрасывается
+func TestGapDetectorReorderWithinGrace(t *testing.T) {
+	td := newTestDetector(t)
+	td.send(1, 2, 4)
+	if got := td.received(t, 3); !slices.Equal(got, []int64{1, 2, 4}) {
+		t.Fatalf("forwarded %v", got)
+	}
+	if !td.d.Pending("BTCUSDT") {
+		t.Error("BTCUSDT is not pending with 3 missing")
+	}
+
+	td.send(3, 3, 5)
+	if got := td.received(t, 2); !slices.Equal(got, []int64{3, 5}) {
+		t.Fatalf("forwarded %v, want duplicate 3 dropped", got)
+	}
+	if td.d.Pending("BTCUSDT") {
+		t.Error("BTCUSDT is pending after 3 arrived")
+	}
+
+	time.Sleep(3 * testGrace)
+	if s := td.d.Stats(); s.Gaps != 0 || s.Duplicates != 1 {
+		t.Errorf("stats = %+v, want no gaps and 1 duplicate", s)
+	}
+}
+
+func TestGapDetectorBackfill(t *testing.T) {
+	src := &fakeSource{upTo: 10, release: make(chan struct{})}
+	td := newTestDetector(t, WithBackfill(src))
+	td.send(1, 5)
+	td.received(t, 2)
+
+	// Grace прошел, догрузка еще идет: пропуск не закрыт
+	time.Sleep(3 * testGrace)
+	if !td.d.Pending("BTCUSDT") {
+		t.Error("BTCUSDT is not pending during backfill")
+	}
+	close(src.release)
+
+	if got := td.received(t, 3); !slices.Equal(got, []int64{2, 3, 4}) {
+		t.Fatalf("backfilled %v", got)
+	}
+	gap := td.gap(t)
+	if gap.FromID != 2 || gap.ToID != 4 || gap.Backfilled != 3 || gap.Error != "" {
+		t.Errorf("gap = %+v", gap)
+	}
+	if td.d.Pending("BTCUSDT") {
+		t.Error("BTCUSDT is pending after backfill")
+	}
+
+	// Догруженные ID уже пришли: живые повторы отбрасываются
+	td.send(3, 6)
+	if got := td.received(t, 1); !slices.Equal(got, []int64{6}) {
+		t.Errorf("forwarded %v, want 6", got)
+	}
+	if s := td.d.Stats(); s.Gaps != 1 || s.Missing != 3 || s.Backfilled != 3 || s.Duplicates != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+// ID, которые не удалось догрузить, не считаются пришедшими
+func TestGapDetectorFailedBackfill(t *testing.T) {
+	td := newTestDetector(t, WithBackfill(&fakeSource{err: errors.New("rate limited")}))
+	td.send(1, 4)
+	td.received(t, 2)
+
+	gap := td.gap(t)
+	if gap.Error == "" || gap.Backfilled != 0 {
+		t.Errorf("gap = %+v, want error", gap)
+	}
+	if td.d.Pending("BTCUSDT") {
+		t.Error("BTCUSDT is pending after failed backfill")
+	}
+
+	td.send(2, 2, 3)
+	if got := td.received(t, 2); !slices.Equal(got, []int64{2, 3}) {
+		t.Errorf("forwarded %v, want late 2, 3", got)
+	}
+	if s := td.d.Stats(); s.Duplicates != 1 {
+		t.Errorf("Duplicates = %d, want 1", s.Duplicates)
+	}
+}
+
+// ID, пришедший сам во время догрузки, из догруженных не отправляется
+func TestGapDetectorLiveDuringBackfill(t *testing.T) {
+	src := &fakeSource{upTo: 10, release: make(chan struct{})}
+	td := newTestDetector(t, WithBackfill(src))
+	td.send(1, 5)
+	td.received(t, 2)
+
+	time.Sleep(3 * testGrace)
+	td.send(3)
+	td.received(t, 1)
+	close(src.release)
+
+	if got := td.received(t, 2); !slices.Equal(got, []int64{2, 4}) {
+		t.Fatalf("backfilled %v, want 2, 4", got)
+	}
+	if gap := td.gap(t); gap.Backfilled != 2 {
+		t.Errorf("Backfilled = %d, want 2", gap.Backfilled)
+	}
+}
+
+// Догрузка приходит позже max_delay, но свечи ее ждут: сделки не опаздывают
+func TestGapDetectorHoldsWindows(t *testing.T) {
+	src := &fakeSource{upTo: 4, release: make(chan struct{})}
+	td := newTestDetector(t, WithBackfill(src))
+
+	intervals, err := aggregator.ParseIntervals([]string{"1s"}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows := make(chan *models.Window, 100)
+	wa := aggregator.NewWindowAggregator(aggregator.WindowConfig{
+		Intervals:  intervals,
+		MaxDelay:   time.Second,
+		LatePolicy: aggregator.LateDrop,
+	}, td.out, windows, aggregator.WithWatermarkHold(td.d))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wa.Start(ctx)
+
+	td.send(1, 5)
+	time.Sleep(3 * testGrace)
+	close(src.release)
+	td.gap(t)
+	// Без пропусков watermark идет дальше: 7 - 1s закрывает свечи до 6s
+	td.send(6, 7)
+
+	var got []int
+	for len(got) < 5 {
+		select {
+		case w := <-windows:
+			got = append(got, int(w.StartTime.Sub(testStart)/time.Second))
+		case <-time.After(time.Second):
+			t.Fatalf("windows %v, want 5", got)
+		}
+	}
+	slices.Sort(got)
+	if want := []int{1, 2, 3, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("windows %v, want %v", got, want)
+	}
+	if s := wa.Stats(); s.Late != 0 {
+		t.Errorf("Late = %d, want 0", s.Late)
+	}
+}
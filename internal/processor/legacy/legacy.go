@@ -0,0 +1,194 @@
+// Package legacy - разбор сообщений Binance до перехода на single-pass
+// декодер: processor.parse и конвертеры исходной версии вместе с
+// UniversalTrade на float64, перенесенные без изменений. По нему бенчмарки
+// (cmd/bench) сравнивают скорость, а тесты processor - значения.
+// Не менять: иначе сравнение потеряет смысл
+package legacy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+type UniversalTrade struct {
+	// ОБЩИЕ ПОЛЯ (есть у всех типов)
+	Symbol    string    `json:"symbol"`     // "BTCUSDT"
+	Timestamp time.Time `json:"timestamp"`  // Когда произошло
+	EventType string    `json:"event_type"` // "aggTrade", "miniTicker"
+
+	// ОСНОВНАЯ ЦЕНА (всегда заполнено)
+	Price float64 `json:"price"` // Текущая/последняя цена
+
+	// ДЛЯ aggTrade
+	Quantity     float64 `json:"quantity,omitempty"`       // Объем сделки
+	IsBuyerMaker bool    `json:"is_buyer_maker,omitempty"` // Направление
+
+	// ДЛЯ miniTicker (24ч статистика)
+	OpenPrice   float64 `json:"open_price,omitempty"`   // Цена открытия 24ч
+	HighPrice   float64 `json:"high_price,omitempty"`   // Максимум 24ч
+	LowPrice    float64 `json:"low_price,omitempty"`    // Минимум 24ч
+	Volume      float64 `json:"volume,omitempty"`       // Объем 24ч
+	QuoteVolume float64 `json:"quote_volume,omitempty"` // Объем в quote asset
+}
+
+// Parse - исходный (*Processor).parse
+func Parse(rawMsg []byte) ([]UniversalTrade, error) {
+	var tickersArray []models.MiniTicker
+	if err := json.Unmarshal(rawMsg, &tickersArray); err == nil {
+		return parseTickerArray(tickersArray, rawMsg)
+	}
+
+	// Если не массив, пробуем формат с "stream" и "data"
+	var rawMap map[string]interface{}
+	if err := json.Unmarshal(rawMsg, &rawMap); err != nil {
+		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	}
+
+	// Проверяем наличие поля data
+	dataVal, hasData := rawMap["data"]
+	if !hasData {
+		return nil, fmt.Errorf("no data field found")
+	}
+
+	dataBytes, err := json.Marshal(dataVal)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal data: %w", err)
+	}
+
+	// Парсим data для определения типа события
+	var dataMap map[string]interface{}
+	if err := json.Unmarshal(dataBytes, &dataMap); err != nil {
+		return nil, fmt.Errorf("could not parse data: %w", err)
+	}
+
+	eVal, hasE := dataMap["e"]
+	if !hasE {
+		return nil, fmt.Errorf("no event type field found")
+	}
+
+	eventType, ok := eVal.(string)
+	if !ok {
+		return nil, fmt.Errorf("event type is not a string: %v", eVal)
+	}
+
+	var unTrade UniversalTrade
+
+	switch eventType {
+	case websocket.AggTrade:
+		var aggTrade models.AggTrade
+		if err := json.Unmarshal(dataBytes, &aggTrade); err != nil {
+			return nil, fmt.Errorf("could not parse AggTrade: %w", err)
+		}
+
+		unTrade, err = convertAggTradeToUniversalTrade(aggTrade)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert AggTrade: %w", err)
+		}
+
+	case websocket.MiniTicker:
+		var miniTicker models.MiniTicker
+		if err := json.Unmarshal(dataBytes, &miniTicker); err != nil {
+			return nil, fmt.Errorf("could not parse MiniTicker: %w", err)
+		}
+
+		unTrade, err = convertMiniTickerToUniversalTrade(miniTicker)
+		if err != nil {
+			return nil, fmt.Errorf("could not convert MiniTicker: %w", err)
+		}
+
+	default:
+		slog.Warn("Unknown even type received", "type", eventType)
+		return nil, nil
+	}
+
+	return []UniversalTrade{unTrade}, nil
+}
+
+func parseTickerArray(
+	tickers []models.MiniTicker,
+	rawMsg []byte,
+) ([]UniversalTrade, error) {
+	trades := make([]UniversalTrade, 0, len(tickers))
+
+	for _, ticker := range tickers {
+		trade, err := convertMiniTickerToUniversalTrade(ticker)
+		if err != nil {
+			// Пропускаем невалидные тикеры
+			continue
+		}
+		trades = append(trades, trade)
+	}
+
+	if len(trades) == 0 {
+		slog.Warn("No valid tickers found in array", "raw_data", string(rawMsg))
+		return nil, nil
+	}
+
+	return trades, nil
+}
+
+func convertAggTradeToUniversalTrade(model models.AggTrade) (UniversalTrade, error) {
+	price, err := strconv.ParseFloat(model.Price, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	quantity, err := strconv.ParseFloat(model.Quantity, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+
+	return UniversalTrade{
+		Symbol:       model.Symbol,
+		Timestamp:    time.UnixMilli(model.EventTime),
+		EventType:    model.EventType,
+		Price:        price,
+		Quantity:     quantity,
+		IsBuyerMaker: model.IsBuyer,
+	}, nil
+}
+
+func convertMiniTickerToUniversalTrade(model models.MiniTicker) (UniversalTrade, error) {
+	cPrice, err := strconv.ParseFloat(model.ClosePrice, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	oPrice, err := strconv.ParseFloat(model.OpenPrice, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	hPrice, err := strconv.ParseFloat(model.HighPrice, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	lPrice, err := strconv.ParseFloat(model.LowPrice, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	volume, err := strconv.ParseFloat(model.TotalBaseVol, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+	quoteVolume, err := strconv.ParseFloat(model.TotalQuoteVol, 64)
+	if err != nil {
+		return UniversalTrade{}, err
+	}
+
+	return UniversalTrade{
+			Symbol:      model.Symbol,
+			Timestamp:   time.UnixMilli(model.EventTime),
+			EventType:   model.EventType,
+			Price:       cPrice,
+			OpenPrice:   oPrice,
+			HighPrice:   hPrice,
+			LowPrice:    lPrice,
+			Volume:      volume,
+			QuoteVolume: quoteVolume,
+		},
+		nil
+}
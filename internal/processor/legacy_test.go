@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/processor/legacy"
+)
+
+// Single-pass декодер дает те же значения, что исходный разбор.
+// Время aggTrade теперь берется из T, а не из E: в кадрах они совпадают
+func TestDecodeMatchesLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"combined aggTrade", `{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":1672515782136,"s":"BTCUSDT","a":2837193845,"p":"16541.34000000","q":"0.00605000","f":3204881232,"l":3204881232,"T":1672515782136,"m":true,"M":true}}`},
+		{"combined aggTrade taker buy", `{"stream":"ethusdt@aggTrade","data":{"e":"aggTrade","E":1672515782200,"s":"ETHUSDT","a":1,"p":"0.1","q":"1234567.89","f":1,"l":2,"T":1672515782200,"m":false,"M":true}}`},
+		{"combined miniTicker", `{"stream":"btcusdt@miniTicker","data":{"e":"24hrMiniTicker","E":1672515782136,"s":"BTCUSDT","c":"16541.34000000","o":"16610.12000000","h":"16650.00000000","l":"16480.55000000","v":"152340.12345000","q":"2523456789.12345678"}}`},
+		{"miniTicker array", `[` +
+			`{"e":"24hrMiniTicker","E":1672515782136,"s":"BTCUSDT","c":"16541.34","o":"16610.12","h":"16650.00","l":"16480.55","v":"152340.12","q":"2523456789.12"},` +
+			`{"e":"24hrMiniTicker","E":1672515782137,"s":"SHIBUSDT","c":"0.00000812","o":"0.00000800","h":"0.00000830","l":"0.00000790","v":"912345678901","q":"7412345.67"}]`},
+	}
+
+	decoder := exchange.NewBinance("")
+	for _, tt := range tests {
+		want, err := legacy.Parse([]byte(tt.msg))
+		if err != nil {
+			t.Fatalf("%s: legacy: %v", tt.name, err)
+		}
+		got, err := decoder.Decode([]byte(tt.msg))
+		if err != nil {
+			t.Fatalf("%s: Decode: %v", tt.name, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d events, legacy %d", tt.name, len(got), len(want))
+		}
+
+		for i := range want {
+			if diff := legacyDiff(got[i], want[i]); diff != "" {
+				t.Errorf("%s #%d: %s", tt.name, i, diff)
+			}
+		}
+	}
+}
+
+// legacyDiff сравнивает поля, которые были у исходного UniversalTrade
+func legacyDiff(got models.UniversalTrade, want legacy.UniversalTrade) string {
+	if got.Symbol != want.Symbol || got.EventType != want.EventType ||
+		!got.Timestamp.Equal(want.Timestamp) || got.IsBuyerMaker != want.IsBuyerMaker {
+		return fmt.Sprintf("%s %s %s maker %v, legacy %s %s %s maker %v",
+			got.Symbol, got.EventType, got.Timestamp, got.IsBuyerMaker,
+			want.Symbol, want.EventType, want.Timestamp, want.IsBuyerMaker)
+	}
+
+	for _, f := range []struct {
+		name string
+		got  decimal.Decimal
+		want float64
+	}{
+		{"Price", got.Price, want.Price},
+		{"Quantity", got.Quantity, want.Quantity},
+		{"OpenPrice", got.OpenPrice, want.OpenPrice},
+		{"HighPrice", got.HighPrice, want.HighPrice},
+		{"LowPrice", got.LowPrice, want.LowPrice},
+		{"Volume", got.Volume, want.Volume},
+		{"QuoteVolume", got.QuoteVolume, want.QuoteVolume},
+	} {
+		// Decimal точный, float64 - ближайшее к тому же числу
+		v, err := strconv.ParseFloat(f.got.String(), 64)
+		if err != nil || v != f.want {
+			return fmt.Sprintf("%s = %s, legacy %v", f.name, f.got, f.want)
+		}
+	}
+	return ""
+}
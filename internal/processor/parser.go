@@ -2,46 +2,194 @@ package processor
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
 	"github.com/WWoi/web-parcer/internal/models"
-	"github.com/WWoi/web-parcer/internal/websocket"
 )
 
+// Decoder разбирает сырое сообщение биржи (см. exchange.Exchange)
+type Decoder interface {
+	Decode(rawMsg []byte) ([]models.UniversalTrade, error)
+}
+
+// ScaleSource - точность цены и количества символа из метаданных биржи
+// (tickSize/stepSize). Без нее числа остаются с той точностью, что прислала биржа
+type ScaleSource interface {
+	SymbolScale(exchange, symbol string) (price, quantity uint8, ok bool)
+}
+
+// SymbolSource - метаданные символов биржи (exchangeInfo): нормализованная
+// пара и статус торгов
+type SymbolSource interface {
+	Symbol(exchange, symbol string) (models.SymbolMeta, bool)
+}
+
+// RoutingKeyer достает из сырого сообщения ключ его стрима без разбора
+// (см. exchange.Exchange). Без него все сообщения разбираются одной очередью
+type RoutingKeyer interface {
+	RoutingKey(rawMsg []byte) []byte
+}
+
+// DeadLetters принимает сообщения, которые не удалось разобрать (deadletter.Queue)
+type DeadLetters interface {
+	Put(l deadletter.Letter)
+}
+
+const (
+	defaultWorkers = 10
+	laneBuffer     = 100
+)
+
+// Processor разбирает сообщения параллельно, но по порядку внутри стрима:
+// сообщения раскладываются по очередям по хешу ключа стрима, у каждой
+// очереди один воркер. Поэтому сделки одного символа выходят в том порядке,
+// в каком пришли, а разные символы разбираются параллельно
 type Processor struct {
 	inputChan  <-chan []byte
 	outputChan chan<- models.UniversalTrade
+	decoder    Decoder
+	keyer      RoutingKeyer
+	scales     ScaleSource
+	symbols    SymbolSource
+	dead       DeadLetters
+	exchange   string
+	workers    int
+
+	mu    sync.Mutex
+	stats Stats
 }
 
-func New(inChan chan []byte, outChan chan models.UniversalTrade) *Processor {
-	return &Processor{
+// Stats - счетчики процессора
+type Stats struct {
+	// OffScale - событий с ценой или объемом точнее шага символа: метаданные
+	// устарели или число неверное. Такие события идут без приведения к шагу
+	OffScale int64
+}
+
+// Option - дополнительная настройка процессора
+type Option func(*Processor)
+
+// WithScales приводит цены и объемы к точности символа на бирже
+func WithScales(src ScaleSource) Option {
+	return func(p *Processor) {
+		p.scales = src
+	}
+}
+
+// WithDeadLetter отправляет неразобранные сообщения в dead-letter очередь
+// вместо лога ошибок
+func WithDeadLetter(dl DeadLetters) Option {
+	return func(p *Processor) {
+		p.dead = dl
+	}
+}
+
+// WithSymbols заполняет Base/Quote/Pair по метаданным и отбрасывает события
+// символов, которые не торгуются. Символы, которых нет в метаданных, идут как есть
+func WithSymbols(src SymbolSource) Option {
+	return func(p *Processor) {
+		p.symbols = src
+	}
+}
+
+// WithWorkers задает число очередей (и воркеров) разбора
+func WithWorkers(n int) Option {
+	return func(p *Processor) {
+		if n > 0 {
+			p.workers = n
+		}
+	}
+}
+
+func New(inChan chan []byte, outChan chan models.UniversalTrade, decoder Decoder, opts ...Option) *Processor {
+	p := &Processor{
 		inputChan:  inChan,
 		outputChan: outChan,
+		decoder:    decoder,
+		workers:    defaultWorkers,
+	}
+	p.keyer, _ = decoder.(RoutingKeyer)
+	if named, ok := decoder.(interface{ Name() string }); ok {
+		p.exchange = named.Name()
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 func (p *Processor) Start(ctx context.Context) {
-	for range 10 {
-		go p.worker(ctx)
+	lanes := make([]chan []byte, p.workers)
+	for i := range lanes {
+		lanes[i] = make(chan []byte, laneBuffer)
+		go p.worker(ctx, lanes[i])
+	}
+	go p.dispatch(ctx, lanes)
+}
+
+// dispatch раскладывает сообщения по очередям. Пока очередь занята, ждут
+// и остальные: обгонять нельзя, иначе порядок внутри стрима не гарантирован
+func (p *Processor) dispatch(ctx context.Context, lanes []chan []byte) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case rawMsg, ok := <-p.inputChan:
+			if !ok {
+				return
+			}
+
+			lane := lanes[p.lane(rawMsg, len(lanes))]
+			select {
+			case lane <- rawMsg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// lane - номер очереди по FNV-1a хешу ключа стрима
+func (p *Processor) lane(rawMsg []byte, n int) int {
+	if n == 1 || p.keyer == nil {
+		return 0
 	}
+
+	h := uint32(2166136261)
+	for _, c := range p.keyer.RoutingKey(rawMsg) {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return int(h % uint32(n))
 }
 
-func (p *Processor) worker(ctx context.Context) {
+func (p *Processor) worker(ctx context.Context, lane <-chan []byte) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 
-		case rawMsg := <-p.inputChan:
-			trades, err := p.parse(rawMsg)
+		case rawMsg := <-lane:
+			trades, err := p.decoder.Decode(rawMsg)
 			if err != nil {
-				slog.Error("Failed to parse message", "error", err, "raw_message", string(rawMsg))
-				continue
+				p.reject(rawMsg, err)
+				if len(trades) == 0 {
+					continue
+				}
 			}
 
 			for _, trade := range trades {
+				if !p.applySymbol(&trade) {
+					continue
+				}
+				p.applyScale(&trade)
+
 				select {
 				case <-ctx.Done():
 					return
@@ -52,97 +200,116 @@ func (p *Processor) worker(ctx context.Context) {
 	}
 }
 
-func (p *Processor) parse(rawMsg []byte) ([]models.UniversalTrade, error) {
-	var tickersArray []models.MiniTicker
-	if err := json.Unmarshal(rawMsg, &tickersArray); err == nil {
-		return p.parseTickerArray(tickersArray, rawMsg)
+// reject отправляет сообщение (или отброшенные элементы частично
+// разобранного сообщения) в dead-letter очередь. Без нее - только ошибка
+// в лог: сырой payload лог ошибок не засоряет
+func (p *Processor) reject(rawMsg []byte, err error) {
+	if p.dead == nil {
+		slog.Error("Failed to parse message",
+			"error", err,
+			"reason", deadletter.Classify(err),
+			"size", len(rawMsg))
+		return
 	}
 
-	// Если не массив, пробуем формат с "stream" и "data"
-	var rawMap map[string]interface{}
-	if err := json.Unmarshal(rawMsg, &rawMap); err != nil {
-		return nil, fmt.Errorf("could not parse JSON: %w", err)
+	now := time.Now()
+	var partial *models.PartialError
+	if !errors.As(err, &partial) {
+		p.dead.Put(deadletter.Letter{
+			ReceivedAt: now,
+			Exchange:   p.exchange,
+			Stage:      deadletter.StageDecode,
+			Reason:     deadletter.Classify(err),
+			Error:      err.Error(),
+			Payload:    string(rawMsg),
+		})
+		return
 	}
 
-	// Проверяем наличие поля data
-	dataVal, hasData := rawMap["data"]
-	if !hasData {
-		return nil, fmt.Errorf("no data field found")
+	for _, item := range partial.Skipped {
+		p.dead.Put(deadletter.Letter{
+			ReceivedAt: now,
+			Exchange:   p.exchange,
+			Stage:      deadletter.StageConvert,
+			Reason:     deadletter.Classify(item.Err),
+			Error:      item.Err.Error(),
+			Payload:    string(item.Raw),
+		})
 	}
+}
 
-	dataBytes, err := json.Marshal(dataVal)
-	if err != nil {
-		return nil, fmt.Errorf("could not marshal data: %w", err)
+// applySymbol нормализует символ; false - символ не торгуется
+func (p *Processor) applySymbol(trade *models.UniversalTrade) bool {
+	if p.symbols == nil {
+		return true
 	}
 
-	// Парсим data для определения типа события
-	var dataMap map[string]interface{}
-	if err := json.Unmarshal(dataBytes, &dataMap); err != nil {
-		return nil, fmt.Errorf("could not parse data: %w", err)
+	meta, ok := p.symbols.Symbol(trade.Exchange, trade.Symbol)
+	if !ok {
+		return true
 	}
+	if !meta.Tradable() {
+		slog.Debug("Event of not trading symbol dropped", "symbol", trade.Symbol, "status", meta.Status)
+		return false
+	}
+
+	trade.Base = meta.Base
+	trade.Quote = meta.Quote
+	trade.Pair = meta.Pair()
+	return true
+}
 
-	eVal, hasE := dataMap["e"]
-	if !hasE {
-		return nil, fmt.Errorf("no event type field found")
+// applyScale приводит числа к точности символа: одинаковый scale у всех
+// событий символа дает одинаковое строковое представление дальше по пайплайну.
+// Число точнее шага не округляется: событие идет как есть и считается в OffScale
+func (p *Processor) applyScale(trade *models.UniversalTrade) {
+	if p.scales == nil {
+		return
 	}
 
-	eventType, ok := eVal.(string)
+	price, qty, ok := p.scales.SymbolScale(trade.Exchange, trade.Symbol)
 	if !ok {
-		return nil, fmt.Errorf("event type is not a string: %v", eVal)
+		return
 	}
 
-	var unTrade models.UniversalTrade
-
-	switch eventType {
-	case websocket.AggTrade:
-		var aggTrade models.AggTrade
-		if err := json.Unmarshal(dataBytes, &aggTrade); err != nil {
-			return nil, fmt.Errorf("could not parse AggTrade: %w", err)
-		}
-
-		unTrade, err = convertAggTradeToUniversalTrade(aggTrade)
-		if err != nil {
-			return nil, fmt.Errorf("could not convert AggTrade: %w", err)
-		}
-
-	case websocket.MiniTicker:
-		var miniTicker models.MiniTicker
-		if err := json.Unmarshal(dataBytes, &miniTicker); err != nil {
-			return nil, fmt.Errorf("could not parse MiniTicker: %w", err)
-		}
+	prices := [...]*decimal.Decimal{&trade.Price, &trade.OpenPrice, &trade.HighPrice, &trade.LowPrice}
+	quantities := [...]*decimal.Decimal{&trade.Quantity, &trade.Volume}
+	if !onScale(prices[:], price) || !onScale(quantities[:], qty) {
+		p.mu.Lock()
+		p.stats.OffScale++
+		p.mu.Unlock()
 
-		unTrade, err = convertMiniTickerToUniversalTrade(miniTicker)
-		if err != nil {
-			return nil, fmt.Errorf("could not convert MiniTicker: %w", err)
-		}
-
-	default:
-		slog.Warn("Unknown even type received", "type", eventType)
-		return nil, nil
+		slog.Debug("Event finer than symbol tick size",
+			"exchange", trade.Exchange,
+			"symbol", trade.Symbol,
+			"price", trade.Price,
+			"quantity", trade.Quantity,
+			"price_scale", price,
+			"quantity_scale", qty)
+		return
 	}
 
-	return []models.UniversalTrade{unTrade}, nil
+	for _, v := range prices {
+		*v = v.Rescale(price)
+	}
+	for _, v := range quantities {
+		*v = v.Rescale(qty)
+	}
 }
 
-func (p *Processor) parseTickerArray(
-	tickers []models.MiniTicker,
-	rawMsg []byte,
-) ([]models.UniversalTrade, error) {
-	trades := make([]models.UniversalTrade, 0, len(tickers))
-
-	for _, ticker := range tickers {
-		trade, err := convertMiniTickerToUniversalTrade(ticker)
-		if err != nil {
-			// Пропускаем невалидные тикеры
-			continue
+// onScale - числа приводятся к scale без потери знаков
+func onScale(values []*decimal.Decimal, scale uint8) bool {
+	for _, v := range values {
+		if !v.Rescale(scale).Equal(*v) {
+			return false
 		}
-		trades = append(trades, trade)
-	}
-
-	if len(trades) == 0 {
-		slog.Warn("No valid tickers found in array", "raw_data", string(rawMsg))
-		return nil, nil
 	}
+	return true
+}
 
-	return trades, nil
+// Stats возвращает счетчики процессора
+func (p *Processor) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
 }
@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/metadata"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// staticInfo - exchangeInfo без сети
+type staticInfo models.ExchangeInfo
+
+func (s staticInfo) ExchangeInfo(context.Context) (models.ExchangeInfo, error) {
+	return models.ExchangeInfo(s), nil
+}
+
+func symbolInfo(symbol, status, tick, step string) models.SymbolInfo {
+	return models.SymbolInfo{
+		Symbol:     symbol,
+		Status:     status,
+		BaseAsset:  symbol[:len(symbol)-4],
+		QuoteAsset: "USDT",
+		Filters: []models.SymbolFilter{
+			{FilterType: "PRICE_FILTER", TickSize: tick},
+			{FilterType: "LOT_SIZE", StepSize: step},
+		},
+	}
+}
+
+func rawAggTrade(symbol string, id int64, price, qty string) []byte {
+	return fmt.Appendf(nil,
+		`{"e":"aggTrade","E":1700000000000,"s":"%s","a":%d,"p":"%s","q":"%s","f":1,"l":1,"T":1700000000000,"m":false,"M":true}`,
+		symbol, id, price, qty)
+}
+
+func TestProcessorMetadata(t *testing.T) {
+	ex := exchange.NewBinance("")
+	cache := metadata.NewCache(metadata.Config{}, ex.Name(), staticInfo{Symbols: []models.SymbolInfo{
+		symbolInfo("BTCUSDT", models.SymbolStatusTrading, "0.01000000", "0.00001000"),
+		symbolInfo("LUNAUSDT", "HALT", "0.00010000", "0.01000000"),
+	}})
+	if err := cache.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan []byte, 10)
+	out := make(chan models.UniversalTrade, 10)
+	proc := New(in, out, ex, WithWorkers(1), WithSymbols(cache), WithScales(cache))
+	proc.Start(ctx)
+
+	in <- rawAggTrade("BTCUSDT", 1, "65000.1", "0.5")
+	in <- rawAggTrade("LUNAUSDT", 2, "0.0001", "1")
+	// Цена точнее шага 0.01 - не округляется
+	in <- rawAggTrade("BTCUSDT", 3, "65000.123", "0.5")
+	in <- rawAggTrade("ETHUSDT", 4, "3000.5", "2")
+
+	var got []models.UniversalTrade
+	for len(got) < 3 {
+		select {
+		case trade := <-out:
+			got = append(got, trade)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events, want 3", len(got))
+		}
+	}
+
+	want := []struct{ symbol, pair, price, qty string }{
+		{"BTCUSDT", "BTC/USDT", "65000.10", "0.50000"},
+		{"BTCUSDT", "BTC/USDT", "65000.123", "0.5"},
+		// Символа нет в метаданных - идет как есть
+		{"ETHUSDT", "", "3000.5", "2"},
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Symbol != w.symbol || g.Pair != w.pair || g.Price.String() != w.price || g.Quantity.String() != w.qty {
+			t.Errorf("%d: %s %q %s %s, want %s %q %s %s",
+				i, g.Symbol, g.Pair, g.Price, g.Quantity, w.symbol, w.pair, w.price, w.qty)
+		}
+	}
+	if s := proc.Stats(); s.OffScale != 1 {
+		t.Errorf("OffScale = %d, want 1", s.OffScale)
+	}
+}
+
+// Сообщения одного символа разбирает один воркер: при нескольких воркерах
+// порядок внутри символа сохраняется, символы между собой перемешиваются
+func TestProcessorKeepsSymbolOrder(t *testing.T) {
+	const workers, perSymbol = 4, 200
+	symbols := []string{"BTCUSDT", "ETHUSDT", "BNBUSDT", "SOLUSDT", "XRPUSDT"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan []byte, len(symbols)*perSymbol)
+	out := make(chan models.UniversalTrade, 16)
+	proc := New(in, out, exchange.NewBinance(""), WithWorkers(workers))
+
+	lanes := make(map[int]bool)
+	for _, symbol := range symbols {
+		lanes[proc.lane(rawAggTrade(symbol, 0, "1", "1"), workers)] = true
+	}
+	if len(lanes) < 2 {
+		t.Fatalf("all symbols hash to one lane, the test checks nothing")
+	}
+
+	proc.Start(ctx)
+	for id := range int64(perSymbol) {
+		for _, symbol := range symbols {
+			in <- rawAggTrade(symbol, id, "1", "1")
+		}
+	}
+
+	last := make(map[string]int64)
+	for range len(symbols) * perSymbol {
+		select {
+		case trade := <-out:
+			id, ok := last[trade.Symbol]
+			if ok && trade.AggTradeID != id+1 || !ok && trade.AggTradeID != 0 {
+				t.Fatalf("%s: trade %d after %d, want input order", trade.Symbol, trade.AggTradeID, id)
+			}
+			last[trade.Symbol] = trade.AggTradeID
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d trades per symbol", last, perSymbol)
+		}
+	}
+}
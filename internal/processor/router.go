@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// routeBuffer - буфер канала одного потребителя
+const routeBuffer = 100
+
+// Router раздает события процессора потребителям по типу события:
+// статистике - тикеры, свечам - сделки, сверке - kline.
+// События без потребителя отбрасываются
+type Router struct {
+	inputChan <-chan models.UniversalTrade
+	routes    map[string][]chan models.UniversalTrade
+	outputs   []chan models.UniversalTrade
+}
+
+func NewRouter(inChan <-chan models.UniversalTrade) *Router {
+	return &Router{
+		inputChan: inChan,
+		routes:    make(map[string][]chan models.UniversalTrade),
+	}
+}
+
+// Route возвращает канал с событиями указанных типов.
+// Вызывается до Start
+func (r *Router) Route(eventTypes ...string) <-chan models.UniversalTrade {
+	ch := make(chan models.UniversalTrade, routeBuffer)
+	r.outputs = append(r.outputs, ch)
+	for _, et := range eventTypes {
+		r.routes[et] = append(r.routes[et], ch)
+	}
+	return ch
+}
+
+// Start раздает события, пока не закроется вход или не отменится контекст.
+// Медленный потребитель тормозит всех: данные не теряются молча
+func (r *Router) Start(ctx context.Context) {
+	defer func() {
+		for _, ch := range r.outputs {
+			close(ch)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case trade, ok := <-r.inputChan:
+			if !ok {
+				return
+			}
+
+			for _, ch := range r.routes[trade.EventType] {
+				select {
+				case ch <- trade:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
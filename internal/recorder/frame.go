@@ -0,0 +1,94 @@
+// Package recorder пишет сырые фреймы WebSocket на диск и читает их обратно
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Формат записи (big-endian), записи идут подряд внутри gzip:
+//
+//	[4] длина данных
+//	[8] время получения, unix nano
+//	[2] ID шарда
+//	[4] ID соединения
+//	[1] флаги
+//	[N] данные фрейма
+const headerSize = 4 + 8 + 2 + 4 + 1
+
+// maxFrameSize - защита от мусора при чтении поврежденного файла
+const maxFrameSize = 64 << 20
+
+const (
+	// FlagForwarded - фрейм ушел в processor (не ответ на запрос и не дубль)
+	FlagForwarded uint8 = 1 << iota
+)
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Frame - один фрейм, как его получил WSclient
+type Frame struct {
+	Received time.Time
+	ShardID  uint16
+	ConnID   uint32
+	Flags    uint8
+	Data     []byte
+}
+
+// Forwarded - фрейм был передан дальше по пайплайну
+func (f Frame) Forwarded() bool {
+	return f.Flags&FlagForwarded != 0
+}
+
+// WriteFrame записывает фрейм с заголовком длины
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Data) > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	var header [headerSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(f.Data)))
+	binary.BigEndian.PutUint64(header[4:12], uint64(f.Received.UnixNano()))
+	binary.BigEndian.PutUint16(header[12:14], f.ShardID)
+	binary.BigEndian.PutUint32(header[14:18], f.ConnID)
+	header[18] = f.Flags
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.Data)
+	return err
+}
+
+// ReadFrame читает следующий фрейм. В конце файла возвращает io.EOF,
+// на оборванной записи - io.ErrUnexpectedEOF
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxFrameSize {
+		return Frame{}, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+
+	f := Frame{
+		Received: time.Unix(0, int64(binary.BigEndian.Uint64(header[4:12]))),
+		ShardID:  binary.BigEndian.Uint16(header[12:14]),
+		ConnID:   binary.BigEndian.Uint32(header[14:18]),
+		Flags:    header[18],
+		Data:     make([]byte, size),
+	}
+
+	if _, err := io.ReadFull(r, f.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	return f, nil
+}
@@ -0,0 +1,63 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Files возвращает файлы записи из каталога в хронологическом порядке
+// (имена содержат час и порядковый номер)
+func Files(dir, prefix string) ([]string, error) {
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"-*"+FileExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Reader читает фреймы из одного файла записи
+type Reader struct {
+	file *os.File
+	gz   *gzip.Reader
+	buf  *bufio.Reader
+}
+
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+
+	return &Reader{
+		file: file,
+		gz:   gz,
+		buf:  bufio.NewReader(gz),
+	}, nil
+}
+
+// Next возвращает следующий фрейм или io.EOF.
+// Файл, который писался в момент падения, может закончиться
+// io.ErrUnexpectedEOF - все фреймы до этого места корректны
+func (r *Reader) Next() (Frame, error) {
+	return ReadFrame(r.buf)
+}
+
+func (r *Reader) Close() error {
+	r.gz.Close()
+	return r.file.Close()
+}
@@ -0,0 +1,228 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPrefix        = "frames"
+	defaultMaxFileSize   = 256 << 20 // 256MB сжатых данных
+	defaultBufferSize    = 10000
+	defaultFlushInterval = time.Second
+
+	// FileExt - расширение файлов записи
+	FileExt = ".bin.gz"
+)
+
+type Config struct {
+	Dir           string        // куда писать
+	Prefix        string        // префикс имени файла, по умолчанию "frames"
+	MaxFileSize   int64         // размер файла на диске, после которого начинается новый
+	RotateHourly  bool          // новый файл каждый час
+	BufferSize    int           // сколько фреймов ждут записи, остальные отбрасываются
+	FlushInterval time.Duration // как часто сбрасывать gzip на диск
+}
+
+// Stats - счетчики записи
+type Stats struct {
+	Recorded int64
+	Dropped  int64
+	Files    int64
+}
+
+// Recorder пишет фреймы в сжатые файлы только дописыванием.
+// Record не блокирует читателя WebSocket: если диск не успевает,
+// фреймы отбрасываются и считаются в Dropped.
+type Recorder struct {
+	cfg    Config
+	frames chan Frame
+
+	file     *os.File
+	counter  *countingWriter
+	gz       *gzip.Writer
+	fileHour time.Time
+
+	recorded atomic.Int64
+	dropped  atomic.Int64
+	files    atomic.Int64
+}
+
+func New(cfg Config) (*Recorder, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("recorder dir is not set")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultPrefix
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultMaxFileSize
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultBufferSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create recorder dir: %w", err)
+	}
+
+	return &Recorder{
+		cfg:    cfg,
+		frames: make(chan Frame, cfg.BufferSize),
+	}, nil
+}
+
+// Record ставит фрейм в очередь на запись
+func (r *Recorder) Record(f Frame) {
+	select {
+	case r.frames <- f:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Recorded: r.recorded.Load(),
+		Dropped:  r.dropped.Load(),
+		Files:    r.files.Load(),
+	}
+}
+
+// Start пишет фреймы до отмены контекста, затем дописывает очередь и закрывает файл
+func (r *Recorder) Start(ctx context.Context) {
+	slog.Info("📼 Frame recorder starting", "dir", r.cfg.Dir)
+
+	flush := time.NewTicker(r.cfg.FlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.drain()
+			r.closeFile()
+			stats := r.Stats()
+			slog.Info("📼 Frame recorder stopped",
+				"recorded", stats.Recorded,
+				"dropped", stats.Dropped,
+				"files", stats.Files)
+			return
+
+		case f := <-r.frames:
+			r.write(f)
+
+		case <-flush.C:
+			if r.gz != nil {
+				if err := r.gz.Flush(); err != nil {
+					slog.Error("Could not flush recorder file", "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) drain() {
+	for {
+		select {
+		case f := <-r.frames:
+			r.write(f)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(f Frame) {
+	if r.needRotate(f.Received) {
+		r.closeFile()
+		if err := r.openFile(f.Received); err != nil {
+			slog.Error("❌ Could not open recorder file", "error", err)
+			r.dropped.Add(1)
+			return
+		}
+	}
+
+	if err := WriteFrame(r.gz, f); err != nil {
+		slog.Error("❌ Could not record frame", "error", err)
+		r.dropped.Add(1)
+		return
+	}
+	r.recorded.Add(1)
+}
+
+func (r *Recorder) needRotate(received time.Time) bool {
+	if r.file == nil {
+		return true
+	}
+	if r.cfg.RotateHourly && !received.Truncate(time.Hour).Equal(r.fileHour) {
+		return true
+	}
+	return r.counter.n >= r.cfg.MaxFileSize
+}
+
+// openFile создает новый файл <prefix>-<YYYYMMDDTHH>-<seq>.bin.gz.
+// Существующие файлы никогда не перезаписываются
+func (r *Recorder) openFile(received time.Time) error {
+	hour := received.Truncate(time.Hour)
+
+	for seq := 0; ; seq++ {
+		name := fmt.Sprintf("%s-%s-%04d%s", r.cfg.Prefix, hour.UTC().Format("20060102T15"), seq, FileExt)
+		path := filepath.Join(r.cfg.Dir, name)
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		r.file = file
+		r.counter = &countingWriter{w: file}
+		r.gz = gzip.NewWriter(r.counter)
+		r.fileHour = hour
+		r.files.Add(1)
+
+		slog.Info("📼 Recording to new file", "file", path)
+		return nil
+	}
+}
+
+func (r *Recorder) closeFile() {
+	if r.file == nil {
+		return
+	}
+
+	if err := r.gz.Close(); err != nil {
+		slog.Error("Could not finish recorder file", "error", err)
+	}
+	if err := r.file.Close(); err != nil {
+		slog.Error("Could not close recorder file", "error", err)
+	}
+
+	r.file, r.counter, r.gz = nil, nil, nil
+}
+
+// countingWriter считает, сколько байт ушло на диск
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
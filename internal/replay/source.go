@@ -0,0 +1,215 @@
+// Package replay воспроизводит записанные фреймы WebSocket в пайплайн
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/recorder"
+)
+
+// Mode - темп воспроизведения
+type Mode string
+
+const (
+	ModeFast     Mode = "fast"     // как можно быстрее
+	ModeRealtime Mode = "realtime" // с исходными интервалами между фреймами
+	ModeSpeed    Mode = "speed"    // в Speed раз быстрее исходного
+)
+
+type Config struct {
+	Dir    string   // каталог с записями (см. recorder.Files)
+	Prefix string   // префикс файлов, по умолчанию как у recorder
+	Files  []string // конкретные файлы, если заданы - Dir не используется
+
+	Mode  Mode
+	Speed float64 // для ModeSpeed
+
+	// From/To ограничивают воспроизведение по времени получения (нулевые - без ограничения)
+	From time.Time
+	To   time.Time
+
+	// IncludeAll отдает и то, что WSclient не передавал дальше
+	// (ответы на запросы, дубли при ротации). По умолчанию воспроизводится
+	// ровно то, что получил processor
+	IncludeAll bool
+}
+
+// Source читает записанные файлы и пишет фреймы в тот же канал,
+// что и WSclient, поэтому processor и все, что за ним, работают без изменений
+type Source struct {
+	cfg    Config
+	output chan<- []byte
+	done   chan struct{}
+
+	sent    atomic.Int64
+	skipped atomic.Int64
+}
+
+func New(cfg Config, output chan<- []byte) (*Source, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeFast
+	case ModeFast, ModeRealtime:
+	case ModeSpeed:
+		if cfg.Speed <= 0 {
+			return nil, fmt.Errorf("replay speed must be positive, got %v", cfg.Speed)
+		}
+	default:
+		return nil, fmt.Errorf("unknown replay mode %q", cfg.Mode)
+	}
+
+	if len(cfg.Files) == 0 {
+		files, err := recorder.Files(cfg.Dir, cfg.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no recordings found in %q", cfg.Dir)
+		}
+		cfg.Files = files
+	}
+
+	return &Source{
+		cfg:    cfg,
+		output: output,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start - то же, что Run, но только пишет результат в лог (как WSclient.Start)
+func (s *Source) Start(ctx context.Context) {
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("❌ Replay failed", "error", err)
+	}
+}
+
+// Done закрывается, когда воспроизведение закончено
+func (s *Source) Done() <-chan struct{} {
+	return s.done
+}
+
+// Sent - сколько фреймов отправлено в канал
+func (s *Source) Sent() int64 {
+	return s.sent.Load()
+}
+
+// Run воспроизводит все файлы по порядку и возвращается по их окончании
+func (s *Source) Run(ctx context.Context) error {
+	defer close(s.done)
+
+	slog.Info("⏯️ Replay starting", "files", len(s.cfg.Files), "mode", s.cfg.Mode)
+
+	p := newPacer(s.cfg.Mode, s.cfg.Speed)
+	for _, path := range s.cfg.Files {
+		if err := s.replayFile(ctx, path, p); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("⏹️ Replay finished", "sent", s.sent.Load(), "skipped", s.skipped.Load())
+	return nil
+}
+
+func (s *Source) replayFile(ctx context.Context, path string, p *pacer) error {
+	r, err := recorder.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		f, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			slog.Warn("Recording is truncated, continuing with next file", "file", path)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", path, err)
+		}
+
+		if !s.wanted(f) {
+			s.skipped.Add(1)
+			continue
+		}
+
+		if err := p.wait(ctx, f.Received); err != nil {
+			return err
+		}
+
+		select {
+		case s.output <- f.Data:
+			s.sent.Add(1)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Source) wanted(f recorder.Frame) bool {
+	if !s.cfg.IncludeAll && !f.Forwarded() {
+		return false
+	}
+	if !s.cfg.From.IsZero() && f.Received.Before(s.cfg.From) {
+		return false
+	}
+	if !s.cfg.To.IsZero() && f.Received.After(s.cfg.To) {
+		return false
+	}
+	return true
+}
+
+// pacer выдерживает интервалы между фреймами по их времени получения
+type pacer struct {
+	speed float64 // 0 - без ожидания
+
+	firstRecv time.Time
+	startWall time.Time
+}
+
+func newPacer(mode Mode, speed float64) *pacer {
+	switch mode {
+	case ModeRealtime:
+		return &pacer{speed: 1}
+	case ModeSpeed:
+		return &pacer{speed: speed}
+	default:
+		return &pacer{}
+	}
+}
+
+func (p *pacer) wait(ctx context.Context, received time.Time) error {
+	if p.speed == 0 {
+		return nil
+	}
+
+	if p.firstRecv.IsZero() {
+		p.firstRecv = received
+		p.startWall = time.Now()
+		return nil
+	}
+
+	offset := time.Duration(float64(received.Sub(p.firstRecv)) / p.speed)
+	delay := time.Until(p.startWall.Add(offset))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
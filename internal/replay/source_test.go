@@ -0,0 +1,158 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/aggregator"
+	"github.com/WWoi/web-parcer/internal/exchange"
+	"github.com/WWoi/web-parcer/internal/models"
+	"github.com/WWoi/web-parcer/internal/processor"
+	"github.com/WWoi/web-parcer/internal/recorder"
+)
+
+var t0 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func rawAggTrade(id int64, at time.Duration, price string) []byte {
+	ms := t0.Add(at).UnixMilli()
+	return fmt.Appendf(nil,
+		`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","E":%d,"s":"BTCUSDT","a":%d,"p":"%s","q":"1","f":%d,"l":%d,"T":%d,"m":false,"M":true}}`,
+		ms, id, price, id, id, ms)
+}
+
+// record пишет фреймы через recorder.Recorder, как это делает WSclient
+func record(t *testing.T, frames []recorder.Frame) string {
+	t.Helper()
+	dir := t.TempDir()
+	rec, err := recorder.New(recorder.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rec.Start(ctx)
+		close(done)
+	}()
+	for _, f := range frames {
+		rec.Record(f)
+	}
+	// Start дописывает очередь и закрывает файл после отмены
+	cancel()
+	<-done
+
+	if s := rec.Stats(); s.Recorded != int64(len(frames)) {
+		t.Fatalf("recorded %d frames, want %d", s.Recorded, len(frames))
+	}
+	return dir
+}
+
+// session - сделки первой минуты с интервалом 50мс по времени получения,
+// ответ на запрос и закрывающая минуту сделка
+func session() []recorder.Frame {
+	received := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var frames []recorder.Frame
+	add := func(data []byte, flags uint8) {
+		frames = append(frames, recorder.Frame{
+			Received: received.Add(time.Duration(len(frames)) * 50 * time.Millisecond),
+			Flags:    flags,
+			Data:     data,
+		})
+	}
+
+	add(rawAggTrade(1, 1*time.Second, "100"), recorder.FlagForwarded)
+	add([]byte(`{"result":null,"id":1}`), 0)
+	add(rawAggTrade(2, 10*time.Second, "105"), recorder.FlagForwarded)
+	add(rawAggTrade(3, 30*time.Second, "98"), recorder.FlagForwarded)
+	add(rawAggTrade(4, 70*time.Second, "101"), recorder.FlagForwarded)
+	return frames
+}
+
+// Записанная сессия проходит processor и агрегатор свечей так же, как живая
+func TestReplayPipeline(t *testing.T) {
+	dir := record(t, session())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	raw := make(chan []byte, 10)
+	trades := make(chan models.UniversalTrade, 10)
+	windows := make(chan *models.Window, 10)
+
+	src, err := New(Config{Dir: dir, Mode: ModeSpeed, Speed: 2}, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor.New(raw, trades, exchange.NewBinance(""), processor.WithWorkers(1)).Start(ctx)
+
+	intervals, _ := aggregator.ParseIntervals([]string{"1m"}, time.UTC)
+	go aggregator.NewWindowAggregator(aggregator.WindowConfig{
+		Intervals: intervals,
+		MaxDelay:  time.Second,
+	}, trades, windows).Start(ctx)
+
+	start := time.Now()
+	if err := src.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 200мс записи в 2 раза быстрее - 100мс, с запасом на точность таймеров
+	if d, want := time.Since(start), 90*time.Millisecond; d < want {
+		t.Errorf("replay took %s, want at least %s", d, want)
+	}
+	if src.Sent() != 4 {
+		t.Errorf("sent = %d, want 4 forwarded frames", src.Sent())
+	}
+
+	var w *models.Window
+	select {
+	case w = <-windows:
+	case <-time.After(time.Second):
+		t.Fatal("no candle")
+	}
+	if !w.StartTime.Equal(t0) || w.Trades != 3 {
+		t.Errorf("candle at %s with %d trades, want first minute with 3", w.StartTime, w.Trades)
+	}
+	if got := fmt.Sprint(w.Open, w.High, w.Low, w.Close); got != "100 105 98 98" {
+		t.Errorf("OHLC = %s, want 100 105 98 98", got)
+	}
+}
+
+func TestReplayFilters(t *testing.T) {
+	frames := session()
+	dir := record(t, frames)
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want int64
+	}{
+		{"forwarded", Config{}, 4},
+		{"include all", Config{IncludeAll: true}, 5},
+		{"from", Config{From: frames[2].Received}, 3},
+		{"to", Config{To: frames[2].Received}, 2},
+	}
+	for _, tt := range tests {
+		tt.cfg.Dir = dir
+		out := make(chan []byte, len(frames))
+		src, err := New(tt.cfg, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if src.Sent() != tt.want {
+			t.Errorf("%s: sent = %d, want %d", tt.name, src.Sent(), tt.want)
+		}
+	}
+
+	if _, err := New(Config{Dir: dir, Mode: ModeSpeed}, nil); err == nil {
+		t.Error("speed mode without Speed accepted")
+	}
+	if _, err := New(Config{Dir: t.TempDir()}, nil); err == nil {
+		t.Error("empty dir accepted")
+	}
+}
@@ -0,0 +1,148 @@
+// Package rest - клиент публичного REST API Binance Spot: снимки стакана
+// и другие данные, которых нет в WebSocket
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// BaseURL - публичный REST API Binance Spot
+const BaseURL = "https://api.binance.com"
+
+const (
+	defaultTimeout = 10 * time.Second
+	// Сколько тела ответа читаем для текста ошибки
+	maxErrorBody = 4 << 10
+)
+
+// Doer выполняет HTTP запросы. *http.Client подходит как есть,
+// в тестах и локально вместо него подставляется заглушка
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// APIError - ответ API с кодом не 2xx. Binance присылает {"code":-1121,"msg":"Invalid symbol."};
+// 429 и 418 означают превышение лимита запросов
+type APIError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+}
+
+func (e *APIError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("rest: http %d", e.StatusCode)
+	}
+	return fmt.Sprintf("rest: http %d: code %d: %s", e.StatusCode, e.Code, e.Msg)
+}
+
+type Client struct {
+	baseURL string
+	doer    Doer
+}
+
+type Option func(*Client)
+
+// WithDoer подменяет HTTP клиент
+func WithDoer(d Doer) Option {
+	return func(c *Client) {
+		c.doer = d
+	}
+}
+
+// New создает клиент; пустой baseURL - боевой API Binance
+func New(baseURL string, opts ...Option) *Client {
+	if baseURL == "" {
+		baseURL = BaseURL
+	}
+
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		doer:    &http.Client{Timeout: defaultTimeout},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// DepthSnapshot - снимок стакана: GET /api/v3/depth, limit до 5000
+func (c *Client) DepthSnapshot(ctx context.Context, symbol string, limit int) (models.DepthSnapshot, error) {
+	query := url.Values{"symbol": {strings.ToUpper(symbol)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var snap models.DepthSnapshot
+	if err := c.get(ctx, "/api/v3/depth", query, &snap); err != nil {
+		return models.DepthSnapshot{}, fmt.Errorf("depth snapshot %s: %w", symbol, err)
+	}
+	return snap, nil
+}
+
+// AggTrades - агрегированные сделки начиная с fromID: GET /api/v3/aggTrades, limit до 1000.
+// В ответе нет "e", "E" и "s" - их заполняет вызывающий
+func (c *Client) AggTrades(ctx context.Context, symbol string, fromID int64, limit int) ([]models.AggTrade, error) {
+	query := url.Values{
+		"symbol": {strings.ToUpper(symbol)},
+		"fromId": {strconv.FormatInt(fromID, 10)},
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var trades []models.AggTrade
+	if err := c.get(ctx, "/api/v3/aggTrades", query, &trades); err != nil {
+		return nil, fmt.Errorf("agg trades %s from %d: %w", symbol, fromID, err)
+	}
+	return trades, nil
+}
+
+// ExchangeInfo - правила торговли всех символов: GET /api/v3/exchangeInfo
+func (c *Client) ExchangeInfo(ctx context.Context) (models.ExchangeInfo, error) {
+	var info models.ExchangeInfo
+	if err := c.get(ctx, "/api/v3/exchangeInfo", nil, &info); err != nil {
+		return models.ExchangeInfo{}, fmt.Errorf("exchange info: %w", err)
+	}
+	return info, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.doer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		_ = json.Unmarshal(body, apiErr)
+		return apiErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	return nil
+}
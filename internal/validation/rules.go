@@ -0,0 +1,149 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// Имена встроенных правил: ключи Config.Actions, Stats.ByRule и Flags
+const (
+	// RuleBounds - цены больше нуля, объемы не отрицательные
+	RuleBounds = "bounds"
+	// RuleOHLC - Low <= Open, Close <= High у тикеров и kline
+	RuleOHLC = "ohlc"
+	// RuleJump - цена отличается от последней принятой не больше MaxJump
+	RuleJump = "jump"
+	// RuleClockSkew - время события не дальше MaxSkew в будущем
+	RuleClockSkew = "clock_skew"
+)
+
+// jumpScale - знаков после точки в относительном изменении цены
+const jumpScale = 8
+
+// rule - встроенное правило: detail объясняет нарушение, ok = true - нарушения нет
+type rule struct {
+	name  string
+	check func(v *Validator, t *models.UniversalTrade, now time.Time) (detail string, ok bool)
+}
+
+type violation struct {
+	rule   string
+	detail string
+}
+
+var builtinRules = []rule{
+	{name: RuleBounds, check: checkBounds},
+	{name: RuleOHLC, check: checkOHLC},
+	{name: RuleJump, check: (*Validator).checkJump},
+	{name: RuleClockSkew, check: checkClockSkew},
+}
+
+func checkBounds(_ *Validator, t *models.UniversalTrade, _ time.Time) (string, bool) {
+	// У bookTicker и depthUpdate Price не заполняется
+	if t.BidPrice.IsZero() && t.AskPrice.IsZero() && t.Bids == nil && t.Asks == nil && t.Price.Sign() <= 0 {
+		return fmt.Sprintf("price %s is not positive", t.Price), false
+	}
+
+	prices := []struct {
+		name  string
+		value decimal.Decimal
+	}{
+		{"open", t.OpenPrice}, {"high", t.HighPrice}, {"low", t.LowPrice},
+		{"bid", t.BidPrice}, {"ask", t.AskPrice},
+	}
+	for _, p := range prices {
+		if p.value.Sign() < 0 {
+			return fmt.Sprintf("%s price %s is negative", p.name, p.value), false
+		}
+	}
+
+	for _, q := range []decimal.Decimal{t.Quantity, t.Volume, t.QuoteVolume, t.BidQty, t.AskQty} {
+		if q.Sign() < 0 {
+			return fmt.Sprintf("quantity %s is negative", q), false
+		}
+	}
+
+	for _, levels := range [][]models.PriceLevel{t.Bids, t.Asks} {
+		for _, l := range levels {
+			if l.Price.Sign() <= 0 || l.Quantity.Sign() < 0 {
+				return fmt.Sprintf("invalid level %s x %s", l.Price, l.Quantity), false
+			}
+		}
+	}
+	return "", true
+}
+
+func checkOHLC(_ *Validator, t *models.UniversalTrade, _ time.Time) (string, bool) {
+	if t.HighPrice.IsZero() && t.LowPrice.IsZero() {
+		return "", true
+	}
+
+	high, low := t.HighPrice, t.LowPrice
+	switch {
+	case low.GreaterThan(high):
+		return fmt.Sprintf("low %s > high %s", low, high), false
+	case !t.OpenPrice.IsZero() && (t.OpenPrice.LessThan(low) || t.OpenPrice.GreaterThan(high)):
+		return fmt.Sprintf("open %s outside %s..%s", t.OpenPrice, low, high), false
+	case t.Price.LessThan(low) || t.Price.GreaterThan(high):
+		return fmt.Sprintf("close %s outside %s..%s", t.Price, low, high), false
+	}
+	return "", true
+}
+
+// checkJump сравнивает цену с опорной ценой символа. Опорная цена
+// обновляется в remember, чтобы отброшенные события ее не сдвигали
+func (v *Validator) checkJump(t *models.UniversalTrade, _ time.Time) (string, bool) {
+	if t.Price.Sign() <= 0 {
+		return "", true
+	}
+
+	last, ok := v.last[symbolKey{exchange: t.Exchange, symbol: t.Symbol}]
+	if !ok || last.price.IsZero() {
+		return "", true
+	}
+
+	change := t.Price.Sub(last.price).Abs().Div(last.price, jumpScale)
+	if !change.GreaterThan(v.cfg.MaxJump) {
+		last.jumps = 0
+		return "", true
+	}
+
+	// Цена держится на новом уровне - значит, это рынок, а не ошибка
+	last.jumps++
+	if last.jumps >= v.cfg.JumpKeep {
+		last.price = t.Price
+		last.jumps = 0
+		return "", true
+	}
+	return fmt.Sprintf("price %s changed by %s from %s", t.Price, change, last.price), false
+}
+
+// remember запоминает цену принятого события как опорную
+func (v *Validator) remember(t *models.UniversalTrade) {
+	if t.Price.Sign() <= 0 {
+		return
+	}
+
+	key := symbolKey{exchange: t.Exchange, symbol: t.Symbol}
+	last, ok := v.last[key]
+	if !ok {
+		v.last[key] = &lastPrice{price: t.Price}
+		return
+	}
+	if last.jumps == 0 {
+		last.price = t.Price
+	}
+}
+
+func checkClockSkew(v *Validator, t *models.UniversalTrade, now time.Time) (string, bool) {
+	if t.Timestamp.IsZero() {
+		return "", true
+	}
+	if skew := t.Timestamp.Sub(now); skew > v.cfg.MaxSkew {
+		return fmt.Sprintf("timestamp %s is %s ahead", t.Timestamp.Format(time.RFC3339Nano), skew.Round(time.Millisecond)), false
+	}
+	return "", true
+}
@@ -0,0 +1,281 @@
+// Package validation - проверка событий между processor и aggregator:
+// нулевые и отрицательные цены, несогласованные OHLC, скачки цены
+// и время из будущего. Плохое событие отбрасывается, помечается
+// или уходит в карантин (dead-letter очередь)
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+const (
+	defaultMaxJump  = "0.5"
+	defaultMaxSkew  = 5 * time.Second
+	defaultJumpKeep = 3
+)
+
+// Action - что делать с событием, не прошедшим правило
+type Action string
+
+const (
+	// ActionOff - правило выключено
+	ActionOff Action = "off"
+	// ActionFlag - событие идет дальше с именем правила в Flags
+	ActionFlag Action = "flag"
+	// ActionDrop - событие отбрасывается
+	ActionDrop Action = "drop"
+	// ActionQuarantine - событие отбрасывается и сохраняется в dead-letter очередь
+	ActionQuarantine Action = "quarantine"
+)
+
+// severity - из нескольких нарушенных правил побеждает самое строгое действие
+func (a Action) severity() int {
+	switch a {
+	case ActionFlag:
+		return 1
+	case ActionDrop:
+		return 2
+	case ActionQuarantine:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// ParseAction разбирает действие из конфига
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(strings.TrimSpace(s))); a {
+	case ActionOff, ActionFlag, ActionDrop, ActionQuarantine:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown validation action %q", s)
+	}
+}
+
+// DeadLetters принимает события в карантине (deadletter.Queue)
+type DeadLetters interface {
+	Put(l deadletter.Letter)
+}
+
+type Config struct {
+	// Actions - действие по имени правила (RuleBounds, ...). Правила без
+	// действия выключены
+	Actions map[string]Action
+	// MaxJump - допустимое относительное изменение цены к последней
+	// принятой цене символа: 0.5 = 50%
+	MaxJump decimal.Decimal
+	// MaxSkew - насколько время события может опережать наши часы
+	MaxSkew time.Duration
+	// JumpKeep - после стольких скачков подряд новый уровень цены
+	// считается настоящим и становится опорным
+	JumpKeep int
+}
+
+// Stats - счетчики проверки. ByRule - сколько раз нарушено каждое правило
+type Stats struct {
+	ByRule      map[string]int64
+	Passed      int64 // прошли все правила
+	Flagged     int64
+	Dropped     int64
+	Quarantined int64
+}
+
+// Option - дополнительная настройка валидатора
+type Option func(*Validator)
+
+// WithDeadLetter отправляет события в карантине в dead-letter очередь.
+// Без нее карантин работает как drop
+func WithDeadLetter(dl DeadLetters) Option {
+	return func(v *Validator) {
+		v.dead = dl
+	}
+}
+
+type symbolKey struct {
+	exchange string
+	symbol   string
+}
+
+// lastPrice - опорная цена символа для правила скачков
+type lastPrice struct {
+	price decimal.Decimal
+	jumps int // скачков подряд от опорной цены
+}
+
+// Validator проверяет события встроенными правилами и пропускает дальше
+// прошедшие и помеченные
+type Validator struct {
+	cfg   Config
+	rules []rule
+	dead  DeadLetters
+
+	inputChan  <-chan models.UniversalTrade
+	outputChan chan<- models.UniversalTrade
+
+	last map[symbolKey]*lastPrice
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func NewValidator(
+	cfg Config,
+	inChan <-chan models.UniversalTrade,
+	outChan chan<- models.UniversalTrade,
+	opts ...Option,
+) *Validator {
+	if cfg.MaxJump.Sign() <= 0 {
+		cfg.MaxJump = decimal.MustParse(defaultMaxJump)
+	}
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = defaultMaxSkew
+	}
+	if cfg.JumpKeep <= 0 {
+		cfg.JumpKeep = defaultJumpKeep
+	}
+
+	v := &Validator{
+		cfg:        cfg,
+		inputChan:  inChan,
+		outputChan: outChan,
+		last:       make(map[symbolKey]*lastPrice),
+		stats:      Stats{ByRule: make(map[string]int64)},
+	}
+	for _, r := range builtinRules {
+		if action := cfg.Actions[r.name]; action.severity() > 0 {
+			v.rules = append(v.rules, r)
+		}
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+func (v *Validator) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case trade, ok := <-v.inputChan:
+			if !ok {
+				return
+			}
+			if !v.check(&trade) {
+				continue
+			}
+
+			select {
+			case v.outputChan <- trade:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Stats возвращает счетчики проверки
+func (v *Validator) Stats() Stats {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s := v.stats
+	s.ByRule = maps.Clone(v.stats.ByRule)
+	return s
+}
+
+// check прогоняет событие по правилам; false - событие дальше не идет
+func (v *Validator) check(trade *models.UniversalTrade) bool {
+	now := time.Now()
+
+	var (
+		action     Action
+		violations []violation
+	)
+	for _, r := range v.rules {
+		detail, ok := r.check(v, trade, now)
+		if ok {
+			continue
+		}
+		violations = append(violations, violation{rule: r.name, detail: detail})
+		if a := v.cfg.Actions[r.name]; a.severity() > action.severity() {
+			action = a
+		}
+	}
+	// Опорная цена двигается только событиями, которые идут дальше
+	if action.severity() < ActionDrop.severity() {
+		v.remember(trade)
+	}
+
+	v.mu.Lock()
+	for _, vl := range violations {
+		v.stats.ByRule[vl.rule]++
+	}
+	switch action {
+	case ActionFlag:
+		v.stats.Flagged++
+	case ActionDrop:
+		v.stats.Dropped++
+	case ActionQuarantine:
+		v.stats.Quarantined++
+	default:
+		v.stats.Passed++
+	}
+	v.mu.Unlock()
+
+	if len(violations) == 0 {
+		return true
+	}
+
+	slog.Debug("Tick failed validation",
+		"exchange", trade.Exchange,
+		"symbol", trade.Symbol,
+		"event", trade.EventType,
+		"rule", violations[0].rule,
+		"detail", violations[0].detail,
+		"action", action)
+
+	switch action {
+	case ActionFlag:
+		for _, vl := range violations {
+			trade.Flags = append(trade.Flags, vl.rule)
+		}
+		return true
+	case ActionQuarantine:
+		v.quarantine(trade, violations, now)
+	}
+	return false
+}
+
+func (v *Validator) quarantine(trade *models.UniversalTrade, violations []violation, now time.Time) {
+	if v.dead == nil {
+		return
+	}
+
+	details := make([]string, 0, len(violations))
+	for _, vl := range violations {
+		details = append(details, vl.rule+": "+vl.detail)
+	}
+	payload, _ := json.Marshal(trade)
+
+	v.dead.Put(deadletter.Letter{
+		ReceivedAt: now,
+		Exchange:   trade.Exchange,
+		Stage:      deadletter.StageValidate,
+		Reason:     violations[0].rule,
+		Error:      strings.Join(details, "; "),
+		Payload:    string(payload),
+	})
+}
@@ -0,0 +1,271 @@
+package validation
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/deadletter"
+	"github.com/WWoi/web-parcer/internal/lib/decimal"
+	"github.com/WWoi/web-parcer/internal/models"
+)
+
+// fakeDead - dead-letter очередь в памяти
+type fakeDead struct {
+	letters []deadletter.Letter
+}
+
+func (d *fakeDead) Put(l deadletter.Letter) {
+	d.letters = append(d.letters, l)
+}
+
+func dec(s string) decimal.Decimal {
+	return decimal.MustParse(s)
+}
+
+func trade(price string) models.UniversalTrade {
+	return models.UniversalTrade{
+		Exchange:  "binance",
+		Symbol:    "BTCUSDT",
+		EventType: "aggTrade",
+		Timestamp: time.Now(),
+		Price:     dec(price),
+		Quantity:  dec("1"),
+	}
+}
+
+func ticker(open, high, low, close string) models.UniversalTrade {
+	t := trade(close)
+	t.EventType = "24hrMiniTicker"
+	t.Quantity = decimal.Decimal{}
+	t.OpenPrice, t.HighPrice, t.LowPrice = dec(open), dec(high), dec(low)
+	return t
+}
+
+func future(t models.UniversalTrade) models.UniversalTrade {
+	t.Timestamp = time.Now().Add(time.Hour)
+	return t
+}
+
+func TestValidator(t *testing.T) {
+	negativeQty := trade("100")
+	negativeQty.Quantity = dec("-1")
+
+	book := trade("0")
+	book.EventType = "bookTicker"
+	book.BidPrice, book.AskPrice = dec("99"), dec("101")
+
+	// Пустые, но не nil уровни освобождают от проверки цены
+	depth := trade("0")
+	depth.EventType = "depthUpdate"
+	depth.Bids = []models.PriceLevel{}
+	depthNoLevels := depth
+	depthNoLevels.Bids = nil
+
+	badLevel := depth
+	badLevel.Asks = []models.PriceLevel{{Price: dec("0"), Quantity: dec("1")}}
+
+	tests := []struct {
+		name        string
+		actions     map[string]Action
+		events      []models.UniversalTrade
+		passed      []bool     // пошло ли событие дальше
+		flags       [][]string // Flags прошедших событий по порядку
+		stats       Stats
+		quarantined []string // Reason записей в dead letters
+	}{
+		{
+			name:    "bounds flag",
+			actions: map[string]Action{RuleBounds: ActionFlag},
+			events:  []models.UniversalTrade{trade("100"), trade("0")},
+			passed:  []bool{true, true},
+			flags:   [][]string{nil, {RuleBounds}},
+			stats:   Stats{ByRule: map[string]int64{RuleBounds: 1}, Passed: 1, Flagged: 1},
+		},
+		{
+			name:    "bounds drop",
+			actions: map[string]Action{RuleBounds: ActionDrop},
+			events:  []models.UniversalTrade{negativeQty, badLevel},
+			passed:  []bool{false, false},
+			stats:   Stats{ByRule: map[string]int64{RuleBounds: 2}, Dropped: 2},
+		},
+		{
+			name:        "bounds quarantine",
+			actions:     map[string]Action{RuleBounds: ActionQuarantine},
+			events:      []models.UniversalTrade{trade("-1")},
+			passed:      []bool{false},
+			stats:       Stats{ByRule: map[string]int64{RuleBounds: 1}, Quarantined: 1},
+			quarantined: []string{RuleBounds},
+		},
+		{
+			// Цена без bid/ask и уровней обязана быть > 0: освобождает только Bids == nil && Asks == nil
+			name:    "bounds exemptions",
+			actions: map[string]Action{RuleBounds: ActionDrop},
+			events:  []models.UniversalTrade{book, depth, depthNoLevels},
+			passed:  []bool{true, true, false},
+			flags:   [][]string{nil, nil},
+			stats:   Stats{ByRule: map[string]int64{RuleBounds: 1}, Passed: 2, Dropped: 1},
+		},
+		{
+			name:    "ohlc flag",
+			actions: map[string]Action{RuleOHLC: ActionFlag},
+			events: []models.UniversalTrade{
+				ticker("10", "12", "9", "11"),
+				ticker("10", "12", "9", "13"),
+				ticker("8", "12", "9", "11"),
+			},
+			passed: []bool{true, true, true},
+			flags:  [][]string{nil, {RuleOHLC}, {RuleOHLC}},
+			stats:  Stats{ByRule: map[string]int64{RuleOHLC: 2}, Passed: 1, Flagged: 2},
+		},
+		{
+			name:        "ohlc quarantine",
+			actions:     map[string]Action{RuleOHLC: ActionQuarantine},
+			events:      []models.UniversalTrade{ticker("10", "9", "12", "10")},
+			passed:      []bool{false},
+			stats:       Stats{ByRule: map[string]int64{RuleOHLC: 1}, Quarantined: 1},
+			quarantined: []string{RuleOHLC},
+		},
+		{
+			// Отброшенный скачок не сдвигает опорную цену
+			name:    "jump drop",
+			actions: map[string]Action{RuleJump: ActionDrop},
+			events:  []models.UniversalTrade{trade("100"), trade("160"), trade("140")},
+			passed:  []bool{true, false, true},
+			flags:   [][]string{nil, nil},
+			stats:   Stats{ByRule: map[string]int64{RuleJump: 1}, Passed: 2, Dropped: 1},
+		},
+		{
+			// JumpKeep = 2: второй скачок подряд принимается как новый уровень
+			name:    "jump keep",
+			actions: map[string]Action{RuleJump: ActionDrop},
+			events:  []models.UniversalTrade{trade("100"), trade("200"), trade("200"), trade("210")},
+			passed:  []bool{true, false, true, true},
+			flags:   [][]string{nil, nil, nil},
+			stats:   Stats{ByRule: map[string]int64{RuleJump: 1}, Passed: 3, Dropped: 1},
+		},
+		{
+			// Скачки считаются в любую сторону: вверх и сразу вниз - тоже два подряд
+			name:    "jump keep ignores direction",
+			actions: map[string]Action{RuleJump: ActionDrop},
+			events:  []models.UniversalTrade{trade("100"), trade("200"), trade("40"), trade("45")},
+			passed:  []bool{true, false, true, true},
+			flags:   [][]string{nil, nil, nil},
+			stats:   Stats{ByRule: map[string]int64{RuleJump: 1}, Passed: 3, Dropped: 1},
+		},
+		{
+			// Скачок засчитан, хотя событие отбросило более строгое правило
+			name:    "jump counted when dropped by another rule",
+			actions: map[string]Action{RuleJump: ActionFlag, RuleClockSkew: ActionDrop},
+			events:  []models.UniversalTrade{trade("100"), future(trade("200")), trade("200")},
+			passed:  []bool{true, false, true},
+			flags:   [][]string{nil, nil},
+			stats:   Stats{ByRule: map[string]int64{RuleJump: 1, RuleClockSkew: 1}, Passed: 2, Dropped: 1},
+		},
+		{
+			name:        "clock skew quarantine",
+			actions:     map[string]Action{RuleClockSkew: ActionQuarantine},
+			events:      []models.UniversalTrade{trade("100"), future(trade("100"))},
+			passed:      []bool{true, false},
+			flags:       [][]string{nil},
+			stats:       Stats{ByRule: map[string]int64{RuleClockSkew: 1}, Passed: 1, Quarantined: 1},
+			quarantined: []string{RuleClockSkew},
+		},
+		{
+			name:    "clock skew flag",
+			actions: map[string]Action{RuleClockSkew: ActionFlag},
+			events:  []models.UniversalTrade{future(trade("100"))},
+			passed:  []bool{true},
+			flags:   [][]string{{RuleClockSkew}},
+			stats:   Stats{ByRule: map[string]int64{RuleClockSkew: 1}, Flagged: 1},
+		},
+		{
+			// Помечаются все нарушенные правила, действие - самое строгое
+			name:    "several rules",
+			actions: map[string]Action{RuleBounds: ActionFlag, RuleOHLC: ActionFlag, RuleClockSkew: ActionOff},
+			events:  []models.UniversalTrade{future(ticker("-1", "12", "9", "11"))},
+			passed:  []bool{true},
+			flags:   [][]string{{RuleBounds, RuleOHLC}},
+			stats:   Stats{ByRule: map[string]int64{RuleBounds: 1, RuleOHLC: 1}, Flagged: 1},
+		},
+		{
+			name:        "strictest action wins",
+			actions:     map[string]Action{RuleBounds: ActionFlag, RuleOHLC: ActionQuarantine},
+			events:      []models.UniversalTrade{ticker("-1", "12", "9", "13")},
+			passed:      []bool{false},
+			stats:       Stats{ByRule: map[string]int64{RuleBounds: 1, RuleOHLC: 1}, Quarantined: 1},
+			quarantined: []string{RuleBounds},
+		},
+		{
+			name:    "off",
+			actions: map[string]Action{RuleBounds: ActionOff},
+			events:  []models.UniversalTrade{trade("0")},
+			passed:  []bool{true},
+			flags:   [][]string{nil},
+			stats:   Stats{ByRule: map[string]int64{}, Passed: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dead := &fakeDead{}
+			v := NewValidator(Config{Actions: tt.actions, JumpKeep: 2}, nil, nil, WithDeadLetter(dead))
+
+			var flags [][]string
+			for i, event := range tt.events {
+				if got := v.check(&event); got != tt.passed[i] {
+					t.Errorf("event %d passed = %v, want %v", i, got, tt.passed[i])
+				} else if got {
+					flags = append(flags, event.Flags)
+				}
+			}
+			if !slices.EqualFunc(flags, tt.flags, slices.Equal) {
+				t.Errorf("flags = %v, want %v", flags, tt.flags)
+			}
+
+			s := v.Stats()
+			if !maps.Equal(s.ByRule, tt.stats.ByRule) {
+				t.Errorf("ByRule = %v, want %v", s.ByRule, tt.stats.ByRule)
+			}
+			if s.Passed != tt.stats.Passed || s.Flagged != tt.stats.Flagged ||
+				s.Dropped != tt.stats.Dropped || s.Quarantined != tt.stats.Quarantined {
+				t.Errorf("stats = %+v, want %+v", s, tt.stats)
+			}
+
+			var reasons []string
+			for _, l := range dead.letters {
+				if l.Stage != deadletter.StageValidate || l.Exchange != "binance" || l.Payload == "" {
+					t.Errorf("letter = %+v, want stage validate with payload", l)
+				}
+				reasons = append(reasons, l.Reason)
+			}
+			if !slices.Equal(reasons, tt.quarantined) {
+				t.Errorf("quarantined = %v, want %v", reasons, tt.quarantined)
+			}
+		})
+	}
+}
+
+// Без dead-letter очереди карантин работает как drop
+func TestQuarantineWithoutDeadLetters(t *testing.T) {
+	v := NewValidator(Config{Actions: map[string]Action{RuleBounds: ActionQuarantine}}, nil, nil)
+	event := trade("0")
+	if v.check(&event) {
+		t.Error("quarantined event passed")
+	}
+	if s := v.Stats(); s.Quarantined != 1 {
+		t.Errorf("Quarantined = %d, want 1", s.Quarantined)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for in, want := range map[string]Action{"off": ActionOff, " Flag ": ActionFlag, "DROP": ActionDrop, "quarantine": ActionQuarantine} {
+		if got, err := ParseAction(in); err != nil || got != want {
+			t.Errorf("ParseAction(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseAction("ignore"); err == nil {
+		t.Error(`ParseAction("ignore") succeeded`)
+	}
+}
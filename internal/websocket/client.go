@@ -3,23 +3,27 @@ package websocket
 import (
 	"context"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/WWoi/web-parcer/internal/recorder"
 	"github.com/gorilla/websocket"
 )
 
-const (
-	AggTradeURL = "wss://stream.binance.com:9443/stream?streams=btcusdt@aggTrade/ethusdt@aggTrade/bnbusdt@aggTrade"
+// CombinedStreamURL - combined endpoint без стримов, подписки отправляются через SUBSCRIBE
+const CombinedStreamURL = BaseURL + "/stream"
 
-	// All - все монеты, Several - определенные
-	// @3000 -> присылает окно каждые 3 секунды (хотя по факту куда реже)
-	MiniTickerAllURL     = "wss://stream.binance.com:9443/ws/!miniTicker@arr@3000ms"
-	MiniTickerSeveralURL = "wss://stream.binance.com:9443/stream?streams=btcusdt@miniTicker/ethusdt@miniTicker/bnbusdt@miniTicker"
-)
+// writeTimeout - дедлайн на отправку запроса в сокет
+const writeTimeout = 5 * time.Second
 
 const (
-	AggTrade   = "aggTrade"
-	MiniTicker = "24hrMiniTicker"
+	AggTrade    = "aggTrade"
+	Trade       = "trade"
+	MiniTicker  = "24hrMiniTicker"
+	Kline       = "kline"
+	BookTicker  = "bookTicker"
+	DepthUpdate = "depthUpdate"
 )
 
 type WSclient struct {
@@ -27,14 +31,106 @@ type WSclient struct {
 	conn           *websocket.Conn
 	outputChan     chan<- []byte
 	reconnectDelay time.Duration
+
+	// writeMu защищает conn на запись: gorilla допускает только одного писателя
+	writeMu sync.Mutex
+	subs    *SubscriptionManager
+
+	// протокол подписок и heartbeat биржи
+	protocol  Protocol
+	heartbeat Heartbeat
+
+	// плановая замена соединения до принудительного разрыва Binance
+	rotateAfter     time.Duration
+	rotationOverlap time.Duration
+	dedup           *deduplicator
+
+	// watchdog: пинги, мертвый сокет, замолчавшие стримы
+	watchdog  WatchdogConfig
+	rawStream string // имя стрима для raw-подключения (/ws/<stream>)
+	reasons   reasonCounters
+
+	// запись сырых фреймов
+	recorder FrameRecorder
+	shardID  uint16
+	connSeq  atomic.Uint32
+
+	// статистика для мониторинга
+	connected   atomic.Bool
+	messages    atomic.Int64
+	reconnects  atomic.Int64
+	lastMessage atomic.Int64 // unix nano
+}
+
+// ClientStats - состояние клиента для мониторинга
+type ClientStats struct {
+	Connected   bool
+	Messages    int64
+	Reconnects  int64
+	LastMessage time.Time
+	Reasons     map[ReconnectReason]int64
+}
+
+// Option - дополнительная настройка клиента
+type Option func(*WSclient)
+
+// FrameRecorder получает каждый прочитанный фрейм (см. recorder.Recorder)
+type FrameRecorder interface {
+	Record(f recorder.Frame)
+}
+
+// WithRecorder включает запись всех фреймов соединения
+func WithRecorder(rec FrameRecorder) Option {
+	return func(c *WSclient) {
+		c.recorder = rec
+	}
+}
+
+// WithShardID помечает фреймы клиента номером шарда
+func WithShardID(id uint16) Option {
+	return func(c *WSclient) {
+		c.shardID = id
+	}
+}
+
+func New(url string, output chan<- []byte, reconnectDelay time.Duration, opts ...Option) *WSclient {
+	c := &WSclient{
+		url:             url,
+		outputChan:      output,
+		reconnectDelay:  reconnectDelay,
+		rotateAfter:     defaultRotateAfter,
+		rotationOverlap: defaultRotationOverlap,
+		dedup:           newDeduplicator(),
+		watchdog:        defaultWatchdogConfig(),
+		rawStream:       rawStreamName(url),
+		protocol:        BinanceProtocol{},
+	}
+	c.subs = newSubscriptionManager(c)
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Subscriptions возвращает менеджер подписок клиента
+func (c *WSclient) Subscriptions() *SubscriptionManager {
+	return c.subs
 }
 
-func New(url string, output chan<- []byte, reconnectDelay time.Duration) *WSclient {
-	return &WSclient{
-		url:            url,
-		outputChan:     output,
-		reconnectDelay: reconnectDelay,
+// Stats возвращает текущее состояние соединения
+func (c *WSclient) Stats() ClientStats {
+	stats := ClientStats{
+		Connected:  c.connected.Load(),
+		Messages:   c.messages.Load(),
+		Reconnects: c.reconnects.Load(),
+		Reasons:    c.reasons.snapshot(),
 	}
+	if last := c.lastMessage.Load(); last > 0 {
+		stats.LastMessage = time.Unix(0, last)
+	}
+	return stats
 }
 
 // принимаем context
@@ -45,13 +141,11 @@ func (c *WSclient) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			if c.conn != nil {
-				c.conn.Close()
-			}
+			c.closeConn()
 			slog.Info("WebSocket client stopped")
 			return
 		default:
-			err := c.connect()
+			conn, err := c.dial()
 			if err != nil {
 				slog.Error(
 					"❌ Connection failed",
@@ -80,8 +174,18 @@ func (c *WSclient) Start(ctx context.Context) {
 			currentDelay = 1 * time.Second
 			slog.Info("✅ WebSocket connected successfully")
 
-			go c.setupPingPong()
-			c.readMessage(ctx)
+			c.setConn(conn)
+			c.connected.Store(true)
+			go c.subs.resubscribe(ctx)
+			reason := c.serve(ctx, conn)
+			c.connected.Store(false)
+			c.subs.cancelPending()
+
+			if ctx.Err() != nil {
+				continue
+			}
+			c.countReconnect(reason)
+			slog.Warn("⚠️ WebSocket disconnected", "reason", reason)
 
 			// Соединение разорвано, ждем перед переподключением
 
@@ -94,50 +198,180 @@ func (c *WSclient) Start(ctx context.Context) {
 	}
 }
 
-func (c *WSclient) connect() error {
+// serve читает соединение и по таймеру заменяет его новым (см. rotate).
+// Возвращается с причиной, когда текущее соединение разорвано.
+func (c *WSclient) serve(ctx context.Context, conn *websocket.Conn) ReconnectReason {
+	sess := c.startSession(ctx, conn)
+	next := c.rotateAfter
+
+	for {
+		rotateTimer := time.NewTimer(next)
+
+		select {
+		case <-ctx.Done():
+			rotateTimer.Stop()
+			c.closeConn()
+			<-sess.done
+			return sess.reason
+
+		case <-sess.done:
+			rotateTimer.Stop()
+			return sess.reason
+
+		case <-rotateTimer.C:
+			newSess, err := c.rotate(ctx, sess)
+			if err != nil {
+				// Старое соединение живо - пробуем еще раз чуть позже
+				slog.Error("❌ Connection rotation failed", "error", err, "retry_in", rotationRetry)
+				next = rotationRetry
+				continue
+			}
+			sess = newSess
+			next = c.rotateAfter
+		}
+	}
+}
+
+func (c *WSclient) dial() (*websocket.Conn, error) {
 	conn, _, err := websocket.DefaultDialer.Dial(c.url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return conn, nil
+}
 
+// setConn делает соединение текущим: в него уходят запросы подписки
+func (c *WSclient) setConn(conn *websocket.Conn) {
+	c.writeMu.Lock()
 	c.conn = conn
-	return nil
+	c.writeMu.Unlock()
 }
 
-func (c *WSclient) readMessage(ctx context.Context) {
-	defer func() {
-		if c.conn != nil {
-			c.conn.Close()
-		}
+func (c *WSclient) closeConn() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// releaseConn закрывает соединение и забывает его, если оно все еще текущее
+func (c *WSclient) releaseConn(conn *websocket.Conn) {
+	conn.Close()
+
+	c.writeMu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.writeMu.Unlock()
+}
+
+// writeMessage отправляет запрос в текущее соединение
+func (c *WSclient) writeMessage(frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// writeTo отправляет сообщение в конкретное соединение (heartbeat сессии)
+func (c *WSclient) writeTo(conn *websocket.Conn, frame []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// startSession запускает чтение соединения и watchdog для него
+func (c *WSclient) startSession(ctx context.Context, conn *websocket.Conn) *session {
+	sess := newSession(conn, c.connSeq.Add(1))
+	c.setupPingPong(sess)
+
+	go func() {
+		defer close(sess.done)
+		sess.reason = c.readMessage(ctx, sess)
 	}()
+	go c.watch(sess)
+
+	return sess
+}
+
+// readMessage читает соединение до ошибки и возвращает причину разрыва.
+// Отмена контекста и принудительный разрыв - через закрытие соединения.
+func (c *WSclient) readMessage(ctx context.Context, sess *session) ReconnectReason {
+	defer c.releaseConn(sess.conn)
 
 	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("Stopping message reader")
-			return
-		default:
-			// Устанавливаем таймаут для чтения, чтобы можно было проверить контекст
-			c.conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		// Дедлайн продлевается на каждом фрейме и pong: если нет ни того,
+		// ни другого - сокет мертв
+		sess.conn.SetReadDeadline(time.Now().Add(c.watchdog.DeadAfter))
 
-			_, msg, err := c.conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(
-					err,
-					websocket.CloseGoingAway,
-					websocket.CloseAbnormalClosure,
-				) {
-					slog.Error("❌ Read message error", slog.String("error", err.Error()))
-				}
-				return
+		_, msg, err := sess.conn.ReadMessage()
+		if err != nil {
+			if forced := sess.forcedReason(); forced != "" {
+				return forced
 			}
-
-			// Отправляем сообщение в канал
-			select {
-			case c.outputChan <- msg:
-			case <-ctx.Done():
-				return
+			if ctx.Err() != nil {
+				slog.Info("Stopping message reader")
+				return ReasonShutdown
+			}
+			if websocket.IsUnexpectedCloseError(
+				err,
+				websocket.CloseGoingAway,
+				websocket.CloseAbnormalClosure,
+			) {
+				slog.Error("❌ Read message error", slog.String("error", err.Error()))
 			}
+			return classifyReadError(err)
+		}
+
+		now := time.Now()
+		c.messages.Add(1)
+		c.lastMessage.Store(now.UnixNano())
+
+		// Ответы на SUBSCRIBE/UNSUBSCRIBE и служебные сообщения не пускаем дальше
+		if c.subs.handleResponse(msg) {
+			c.record(sess, now, msg, 0)
+			continue
+		}
+
+		sess.touch(streamOf(msg, c.rawStream), now)
+
+		// Во время ротации одно и то же событие приходит по двум соединениям
+		if c.dedup.duplicate(msg) {
+			c.record(sess, now, msg, 0)
+			continue
+		}
+
+		c.record(sess, now, msg, recorder.FlagForwarded)
+
+		// Отправляем сообщение в канал
+		select {
+		case c.outputChan <- msg:
+		case <-ctx.Done():
+			return ReasonShutdown
 		}
 	}
 }
+
+func (c *WSclient) record(sess *session, received time.Time, msg []byte, flags uint8) {
+	if c.recorder == nil {
+		return
+	}
+
+	c.recorder.Record(recorder.Frame{
+		Received: received,
+		ShardID:  c.shardID,
+		ConnID:   sess.id,
+		Flags:    flags,
+		Data:     msg,
+	})
+}
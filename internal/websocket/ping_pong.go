@@ -1,17 +1,23 @@
 package websocket
 
 import (
-	"time"
 	"log/slog"
+	"time"
+
 	"github.com/gorilla/websocket"
 )
 
-func (c *WSclient) setupPingPong() {
-	c.conn.SetPingHandler(func(appData string) error {
+func (c *WSclient) setupPingPong(sess *session) {
+	conn := sess.conn
+
+	conn.SetPingHandler(func(appData string) error {
 		slog.Info("Ping from Binance, answer pong")
 
+		// Любой фрейм от биржи - признак живого сокета
+		conn.SetReadDeadline(time.Now().Add(c.watchdog.DeadAfter))
+
 		// Отправляем pong обратно
-		err := c.conn.WriteControl(
+		err := conn.WriteControl(
 			websocket.PongMessage,         // Тип: PONG
 			[]byte(appData),               // Тот же payload
 			time.Now().Add(1*time.Second), // Deadline
@@ -19,4 +25,10 @@ func (c *WSclient) setupPingPong() {
 
 		return err
 	})
+
+	// Ответ на наш ping
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(c.watchdog.DeadAfter))
+		return nil
+	})
 }
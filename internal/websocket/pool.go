@@ -0,0 +1,413 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultStreamsPerShard - сколько стримов держим на одном соединении по умолчанию.
+// Это заметно меньше лимита Binance: одно соединение с сотнями aggTrade уже
+// упирается в чтение
+const defaultStreamsPerShard = 200
+
+type PoolConfig struct {
+	URL                string   // combined endpoint, по умолчанию CombinedStreamURL
+	Protocol           Protocol // протокол подписок, по умолчанию BinanceProtocol
+	Shards             int      // минимальное количество соединений
+	MaxStreamsPerShard int      // не больше MaxStreamsPerConnection
+	ReconnectDelay     time.Duration
+	ClientOptions      []Option // применяются к каждому шарду
+}
+
+// Pool раскладывает набор стримов по нескольким WSclient.
+// Все шарды пишут в один выходной канал, который читает processor.
+// Стрим принадлежит шарду только после подтверждения подписки; запросы
+// к бирже идут без mu, чтобы Health и Start не ждали подтверждений
+type Pool struct {
+	cfg    PoolConfig
+	output chan<- []byte
+
+	ops sync.Mutex // Add и Remove по одному: планы раскладки не пересекаются
+
+	mu     sync.Mutex
+	ctx    context.Context // nil до Start
+	shards []*shard
+	owner  map[string]*shard // стрим -> шард
+	nextID int
+}
+
+type shard struct {
+	id      int
+	client  *WSclient
+	streams map[string]struct{}
+	cancel  context.CancelFunc
+}
+
+// ShardHealth - состояние одного шарда
+type ShardHealth struct {
+	ID          int
+	Streams     int
+	Connected   bool
+	Messages    int64
+	Reconnects  int64
+	LastMessage time.Time
+	Reasons     map[ReconnectReason]int64
+}
+
+func NewPool(cfg PoolConfig, output chan<- []byte) *Pool {
+	if cfg.URL == "" {
+		cfg.URL = CombinedStreamURL
+	}
+	if cfg.Protocol == nil {
+		cfg.Protocol = BinanceProtocol{}
+	}
+	if cfg.Shards <= 0 {
+		cfg.Shards = 1
+	}
+	if cfg.MaxStreamsPerShard <= 0 || cfg.MaxStreamsPerShard > MaxStreamsPerConnection {
+		cfg.MaxStreamsPerShard = defaultStreamsPerShard
+	}
+
+	p := &Pool{
+		cfg:    cfg,
+		output: output,
+		owner:  make(map[string]*shard),
+	}
+	for range cfg.Shards {
+		p.addShard()
+	}
+
+	return p
+}
+
+// Start запускает все шарды и блокируется до отмены контекста
+func (p *Pool) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.ctx = ctx
+	for _, sh := range p.shards {
+		p.startShard(sh)
+	}
+	p.mu.Unlock()
+
+	slog.Info("🧩 WebSocket pool started", "shards", p.cfg.Shards)
+
+	<-ctx.Done()
+}
+
+// Add раскладывает новые стримы по наименее загруженным шардам,
+// при нехватке места открывает новые соединения. Если шард не подписался,
+// его стримы не считаются добавленными; остальные шарды подписываются
+func (p *Pool) Add(ctx context.Context, streams ...string) error {
+	for _, name := range streams {
+		if err := p.cfg.Protocol.ValidateStream(name); err != nil {
+			return err
+		}
+	}
+
+	p.ops.Lock()
+	defer p.ops.Unlock()
+
+	p.mu.Lock()
+	batches := make(map[*shard][]string)
+	planned := make(map[*shard]int)
+	seen := make(map[string]struct{}, len(streams))
+	for _, name := range streams {
+		if _, ok := p.owner[name]; ok {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		sh := p.leastLoaded(planned)
+		if sh == nil || len(sh.streams)+planned[sh] >= p.cfg.MaxStreamsPerShard {
+			sh = p.addShard()
+		}
+
+		planned[sh]++
+		batches[sh] = append(batches[sh], name)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for sh, names := range batches {
+		subs := sh.client.Subscriptions()
+		if err := subs.Subscribe(ctx, names...); err != nil {
+			// Без подтверждения стримы не должны переподписываться после переподключения
+			subs.Unsubscribe(ctx, names...)
+			errs = append(errs, fmt.Errorf("shard %d: %w", sh.id, err))
+			continue
+		}
+
+		p.mu.Lock()
+		for _, name := range names {
+			sh.streams[name] = struct{}{}
+			p.owner[name] = sh
+		}
+		p.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Remove отписывается от стримов и выравнивает нагрузку между шардами.
+// Ошибка одного шарда не мешает остальным; владелец стрима меняется так же,
+// как активный набор шарда: стрим, который шард уже не переподпишет, пулу не принадлежит
+func (p *Pool) Remove(ctx context.Context, streams ...string) error {
+	p.ops.Lock()
+	defer p.ops.Unlock()
+
+	p.mu.Lock()
+	batches := make(map[*shard][]string)
+	for _, name := range streams {
+		if sh, ok := p.owner[name]; ok && !slices.Contains(batches[sh], name) {
+			batches[sh] = append(batches[sh], name)
+		}
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for sh, names := range batches {
+		subs := sh.client.Subscriptions()
+		if err := subs.Unsubscribe(ctx, names...); err != nil {
+			errs = append(errs, fmt.Errorf("shard %d: %w", sh.id, err))
+		}
+
+		p.mu.Lock()
+		for _, name := range names {
+			if !subs.IsActive(name) {
+				delete(sh.streams, name)
+				delete(p.owner, name)
+			}
+		}
+		p.mu.Unlock()
+	}
+
+	return errors.Join(append(errs, p.rebalance(ctx))...)
+}
+
+// Health возвращает состояние всех шардов
+func (p *Pool) Health() []ShardHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]ShardHealth, 0, len(p.shards))
+	for _, sh := range p.shards {
+		stats := sh.client.Stats()
+		health = append(health, ShardHealth{
+			ID:          sh.id,
+			Streams:     len(sh.streams),
+			Connected:   stats.Connected,
+			Messages:    stats.Messages,
+			Reconnects:  stats.Reconnects,
+			LastMessage: stats.LastMessage,
+			Reasons:     stats.Reasons,
+		})
+	}
+	return health
+}
+
+// movePlan - стримы, которые переезжают с одного шарда на другой одним запросом
+type movePlan struct {
+	from, to *shard
+	names    []string
+}
+
+// movePlans собирает переносы по парам шардов
+type movePlans struct {
+	byPair map[[2]*shard]*movePlan
+	list   []*movePlan
+}
+
+func (mp *movePlans) add(from, to *shard, name string) {
+	key := [2]*shard{from, to}
+	plan, ok := mp.byPair[key]
+	if !ok {
+		if mp.byPair == nil {
+			mp.byPair = make(map[[2]*shard]*movePlan)
+		}
+		plan = &movePlan{from: from, to: to}
+		mp.byPair[key] = plan
+		mp.list = append(mp.list, plan)
+	}
+	plan.names = append(plan.names, name)
+}
+
+// rebalance закрывает лишние шарды и переносит стримы с перегруженных
+// на недогруженные. Сначала подписываемся на новом шарде, потом
+// отписываемся на старом: лучше короткий дубль, чем дыра в данных.
+// Переносы между парой шардов идут одним запросом (частями по лимиту
+// протокола, с паузой между запросами), а не по запросу на стрим.
+// Вызывается под ops; mu берется только на планирование и перенос владельца
+func (p *Pool) rebalance(ctx context.Context) error {
+	// Лишние - самые пустые шарды: их стримы переезжают на остальные
+	p.mu.Lock()
+	needed := max(p.cfg.Shards, (len(p.owner)+p.cfg.MaxStreamsPerShard-1)/p.cfg.MaxStreamsPerShard)
+	var victims []*shard
+	if len(p.shards) > needed {
+		p.sortShards()
+		victims = slices.Clone(p.shards[needed:])
+		p.shards = p.shards[:needed]
+	}
+	plans := p.planDrain(victims)
+	p.mu.Unlock()
+
+	if err := p.applyMoves(ctx, plans); err != nil {
+		// Шарды с оставшимися стримами продолжают работать
+		p.mu.Lock()
+		p.shards = append(p.shards, victims...)
+		p.mu.Unlock()
+		return err
+	}
+	for _, victim := range victims {
+		p.stopShard(victim)
+	}
+
+	// Выравниваем: разница между шардами не больше одного стрима
+	p.mu.Lock()
+	plans = p.planBalance()
+	p.mu.Unlock()
+
+	return p.applyMoves(ctx, plans)
+}
+
+// planDrain раскладывает стримы victims по оставшимся шардам; под mu
+func (p *Pool) planDrain(victims []*shard) []*movePlan {
+	var plans movePlans
+	planned := make(map[*shard]int)
+	for _, victim := range victims {
+		for _, name := range slices.Sorted(maps.Keys(victim.streams)) {
+			to := p.leastLoaded(planned)
+			planned[to]++
+			plans.add(victim, to, name)
+		}
+	}
+	return plans.list
+}
+
+// planBalance - переносы, после которых разница между шардами не больше
+// одного стрима; под mu
+func (p *Pool) planBalance() []*movePlan {
+	load := make(map[*shard]int, len(p.shards))
+	left := make(map[*shard][]string, len(p.shards))
+	for _, sh := range p.shards {
+		load[sh] = len(sh.streams)
+		left[sh] = slices.Sorted(maps.Keys(sh.streams))
+	}
+
+	var plans movePlans
+	for {
+		from, to := p.shards[0], p.shards[0]
+		for _, sh := range p.shards {
+			if load[sh] > load[from] {
+				from = sh
+			}
+			if load[sh] < load[to] {
+				to = sh
+			}
+		}
+		if load[from]-load[to] <= 1 {
+			return plans.list
+		}
+
+		names := left[from]
+		left[from] = names[:len(names)-1]
+		load[from]--
+		load[to]++
+		plans.add(from, to, names[len(names)-1])
+	}
+}
+
+// applyMoves выполняет переносы по очереди, до первой ошибки
+func (p *Pool) applyMoves(ctx context.Context, plans []*movePlan) error {
+	for _, mp := range plans {
+		if err := p.move(ctx, mp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortShards - от самого загруженного к самому пустому; под mu
+func (p *Pool) sortShards() {
+	sort.Slice(p.shards, func(i, j int) bool {
+		return len(p.shards[i].streams) > len(p.shards[j].streams)
+	})
+}
+
+// move переносит стримы: владелец меняется после подписки на новом шарде.
+// Без подтверждения стримы остаются на старом шарде
+func (p *Pool) move(ctx context.Context, mp *movePlan) error {
+	to := mp.to.client.Subscriptions()
+	if err := to.Subscribe(ctx, mp.names...); err != nil {
+		to.Unsubscribe(ctx, mp.names...)
+		return fmt.Errorf("shard %d: %w", mp.to.id, err)
+	}
+
+	p.mu.Lock()
+	for _, name := range mp.names {
+		mp.to.streams[name] = struct{}{}
+		p.owner[name] = mp.to
+		delete(mp.from.streams, name)
+	}
+	p.mu.Unlock()
+
+	if err := mp.from.client.Subscriptions().Unsubscribe(ctx, mp.names...); err != nil {
+		return fmt.Errorf("shard %d: %w", mp.from.id, err)
+	}
+	return nil
+}
+
+// leastLoaded - шард с наименьшим числом стримов, считая planned; под mu
+func (p *Pool) leastLoaded(planned map[*shard]int) *shard {
+	var best *shard
+	for _, sh := range p.shards {
+		if best == nil || len(sh.streams)+planned[sh] < len(best.streams)+planned[best] {
+			best = sh
+		}
+	}
+	return best
+}
+
+func (p *Pool) addShard() *shard {
+	opts := append(slices.Clone(p.cfg.ClientOptions),
+		WithProtocol(p.cfg.Protocol),
+		WithShardID(uint16(p.nextID)),
+	)
+
+	sh := &shard{
+		id:      p.nextID,
+		client:  New(p.cfg.URL, p.output, p.cfg.ReconnectDelay, opts...),
+		streams: make(map[string]struct{}),
+	}
+	p.nextID++
+	p.shards = append(p.shards, sh)
+
+	if p.ctx != nil {
+		p.startShard(sh)
+	}
+	return sh
+}
+
+func (p *Pool) startShard(sh *shard) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	sh.cancel = cancel
+	go sh.client.Start(ctx)
+
+	slog.Info("🧩 Shard started", "shard", sh.id, "streams", len(sh.streams))
+}
+
+func (p *Pool) stopShard(sh *shard) {
+	if sh.cancel != nil {
+		sh.cancel()
+	}
+	slog.Info("🧩 Shard stopped", "shard", sh.id)
+}
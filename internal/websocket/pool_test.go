@@ -0,0 +1,222 @@
+package websocket_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/mockexchange"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+func startPool(t *testing.T, cfg websocket.PoolConfig, mock mockexchange.Config) (*websocket.Pool, *mockexchange.Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	mock.Scripted = true
+	srv := mockexchange.New(mock)
+	url, err := srv.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.URL = url + "/stream"
+	cfg.ReconnectDelay = 10 * time.Millisecond
+	pool := websocket.NewPool(cfg, make(chan []byte, 100))
+	go pool.Start(ctx)
+
+	// Подписки без соединения откладываются до подключения: ждем соединений
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.Connections() < cfg.Shards {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d, want %d", srv.Connections(), cfg.Shards)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return pool, srv
+}
+
+func streams(symbols ...string) []string {
+	names := make([]string, 0, len(symbols))
+	for _, s := range symbols {
+		names = append(names, s+"@aggTrade")
+	}
+	return names
+}
+
+func poolStreams(pool *websocket.Pool) (total, shards int) {
+	for _, h := range pool.Health() {
+		total += h.Streams
+		shards++
+	}
+	return total, shards
+}
+
+// Пока шард ждет подтверждения подписки, пул отвечает, а стримы еще не его
+func TestPoolAddOutsideLock(t *testing.T) {
+	pool, srv := startPool(t, websocket.PoolConfig{Shards: 1}, mockexchange.Config{})
+	srv.SetDelay(300 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Add(context.Background(), streams("btcusdt", "ethusdt")...)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	if total, _ := poolStreams(pool); total != 0 {
+		t.Errorf("streams before ack = %d, want 0", total)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Health waited %s for subscribe ack", d)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := poolStreams(pool); total != 2 {
+		t.Errorf("streams after ack = %d, want 2", total)
+	}
+}
+
+// Неподтвержденная подписка не занимает стримы: повторный Add подписывается
+func TestPoolAddFailedIsNotOwned(t *testing.T) {
+	pool, srv := startPool(t, websocket.PoolConfig{Shards: 1}, mockexchange.Config{})
+	srv.SetDelay(500 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pool.Add(ctx, streams("btcusdt")...); err == nil {
+		t.Fatal("Add without ack succeeded")
+	}
+	if total, _ := poolStreams(pool); total != 0 {
+		t.Fatalf("streams after failed Add = %d, want 0", total)
+	}
+
+	srv.SetDelay(0)
+	if err := pool.Add(context.Background(), streams("btcusdt")...); err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := poolStreams(pool); total != 1 {
+		t.Errorf("streams = %d, want 1", total)
+	}
+}
+
+func TestPoolShardsAndRebalance(t *testing.T) {
+	pool, _ := startPool(t, websocket.PoolConfig{Shards: 1, MaxStreamsPerShard: 2}, mockexchange.Config{})
+
+	var symbols []string
+	for i := range 5 {
+		symbols = append(symbols, fmt.Sprintf("sym%dusdt", i))
+	}
+	// Повтор в одном вызове подписывается один раз
+	if err := pool.Add(context.Background(), streams(append(symbols, symbols[0])...)...); err != nil {
+		t.Fatal(err)
+	}
+	if total, shards := poolStreams(pool); total != 5 || shards != 3 {
+		t.Fatalf("streams = %d on %d shards, want 5 on 3", total, shards)
+	}
+
+	if err := pool.Remove(context.Background(), streams(symbols[:4]...)...); err != nil {
+		t.Fatal(err)
+	}
+	if total, shards := poolStreams(pool); total != 1 || shards != 1 {
+		t.Errorf("streams = %d on %d shards, want 1 on 1", total, shards)
+	}
+}
+
+// Отказ одного шарда не мешает отписке на остальных; стримы, которые шард
+// уже не переподпишет, пулу больше не принадлежат
+func TestPoolRemoveContinuesAfterShardError(t *testing.T) {
+	pool, srv := startPool(t, websocket.PoolConfig{Shards: 2, MaxStreamsPerShard: 2}, mockexchange.Config{})
+
+	names := streams("btcusdt", "ethusdt", "bnbusdt", "solusdt")
+	if err := pool.Add(context.Background(), names...); err != nil {
+		t.Fatal(err)
+	}
+	srv.Reject("UNSUBSCRIBE", names[0])
+
+	if err := pool.Remove(context.Background(), names...); err == nil {
+		t.Fatal("Remove with a rejected UNSUBSCRIBE succeeded")
+	}
+	// Отказ отклоняет весь запрос шарда: у биржи остаются два его стрима
+	var left int
+	for _, name := range names {
+		if srv.Subscribers(name) > 0 {
+			left++
+		}
+	}
+	if left != 2 || srv.Subscribers(names[0]) != 1 {
+		t.Errorf("streams still subscribed = %d, want the 2 of the failed shard", left)
+	}
+	if total, _ := poolStreams(pool); total != 0 {
+		t.Errorf("pool streams = %d, want 0: the shard dropped them from its active set", total)
+	}
+}
+
+// Сотни переносов при слиянии шардов идут несколькими запросами и не
+// превышают лимит сообщений: иначе биржа рвет соединение
+func TestPoolRebalanceBatchesMoves(t *testing.T) {
+	pool, srv := startPool(t,
+		websocket.PoolConfig{Shards: 1, MaxStreamsPerShard: 200},
+		mockexchange.Config{RequestLimit: 5})
+
+	var symbols []string
+	for i := range 600 {
+		symbols = append(symbols, fmt.Sprintf("sym%dusdt", i))
+	}
+	if err := pool.Add(context.Background(), streams(symbols...)...); err != nil {
+		t.Fatal(err)
+	}
+	if _, shards := poolStreams(pool); shards != 3 {
+		t.Fatalf("shards = %d, want 3", shards)
+	}
+
+	// Новые шарды подписываются и при подключении, уже после Add: ждем,
+	// пока запросы не затихнут дольше паузы между ними
+	before := srv.Requests()
+	for {
+		time.Sleep(400 * time.Millisecond)
+		if n := srv.Requests(); n != before {
+			before = n
+			continue
+		}
+		break
+	}
+	// Остается по 50 стримов на каждом шарде - все переезжают на один
+	var remove []string
+	for i, s := range symbols {
+		if i%4 != 0 {
+			remove = append(remove, s)
+		}
+	}
+	if err := pool.Remove(context.Background(), streams(remove...)...); err != nil {
+		t.Fatal(err)
+	}
+
+	total, shards := poolStreams(pool)
+	if total != 150 || shards != 1 {
+		t.Fatalf("streams = %d on %d shards, want 150 on 1", total, shards)
+	}
+	// 3 отписки + на каждый слитый шард подписка и отписка
+	if n := srv.Requests() - before; n > 7 {
+		t.Errorf("requests = %d, want at most 7", n)
+	}
+	for _, h := range pool.Health() {
+		if h.Reconnects != 0 {
+			t.Errorf("shard %d reconnected %d times, reasons %v", h.ID, h.Reconnects, h.Reasons)
+		}
+	}
+	// Оставшийся стрим подписан ровно на одном соединении, удаленный - ни на одном
+	for i, s := range streams(symbols[:8]...) {
+		want := 0
+		if i%4 == 0 {
+			want = 1
+		}
+		if got := srv.Subscribers(s); got != want {
+			t.Errorf("%s subscribers = %d, want %d", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Method - запрос управления подписками
+type Method string
+
+const (
+	MethodSubscribe   Method = "SUBSCRIBE"
+	MethodUnsubscribe Method = "UNSUBSCRIBE"
+	MethodList        Method = "LIST_SUBSCRIPTIONS"
+)
+
+// ErrUnsupported - протокол биржи не поддерживает такой запрос
+var ErrUnsupported = errors.New("not supported by exchange protocol")
+
+// Protocol описывает, как с биржей договариваться о подписках:
+// формат запросов, распознавание ответов и служебных сообщений.
+// По умолчанию клиент говорит на протоколе Binance (BinanceProtocol)
+type Protocol interface {
+	// EncodeRequest собирает фреймы запроса. Некоторые биржи принимают
+	// один канал на запрос - тогда фреймов несколько
+	EncodeRequest(method Method, id int64, streams []string) ([][]byte, error)
+	// DecodeResponse распознает ответ на запрос или служебное сообщение
+	// (pong, подтверждение без id). ok=false - это данные
+	DecodeResponse(msg []byte) (resp Response, ok bool)
+	// AcksByID - биржа отвечает на каждый запрос с тем же id.
+	// Если нет, запрос считается выполненным после отправки
+	AcksByID() bool
+	// MaxStreamsPerRequest - сколько стримов помещается в один запрос
+	MaxStreamsPerRequest() int
+	// ValidateStream проверяет имя стрима до отправки запроса
+	ValidateStream(name string) error
+}
+
+// Response - ответ биржи на запрос. HasID=false - служебное сообщение,
+// которое не относится ни к одному запросу
+type Response struct {
+	ID     int64
+	HasID  bool
+	Result json.RawMessage
+	Err    error
+}
+
+// Heartbeat - как поддерживать соединение живым.
+// Payload=nil - обычный WebSocket ping, иначе текстовое сообщение
+// прикладного уровня (OKX "ping", Bybit {"op":"ping"})
+type Heartbeat struct {
+	Interval time.Duration
+	Payload  []byte
+}
+
+// WithProtocol задает протокол подписок биржи
+func WithProtocol(p Protocol) Option {
+	return func(c *WSclient) {
+		if p != nil {
+			c.protocol = p
+		}
+	}
+}
+
+// WithHeartbeat задает правила heartbeat биржи.
+// Interval заменяет PingInterval из WatchdogConfig
+func WithHeartbeat(h Heartbeat) Option {
+	return func(c *WSclient) {
+		c.heartbeat = h
+	}
+}
+
+// ResponseError - ошибка, которую биржа вернула на запрос
+type ResponseError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("exchange error %d: %s", e.Code, e.Msg)
+}
+
+// BinanceProtocol - JSON-RPC Binance на /ws и /stream
+type BinanceProtocol struct{}
+
+type binanceRequest struct {
+	Method Method   `json:"method"`
+	Params []string `json:"params,omitempty"`
+	ID     int64    `json:"id"`
+}
+
+type binanceResponse struct {
+	ID     *int64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *ResponseError  `json:"error"`
+}
+
+func (BinanceProtocol) EncodeRequest(method Method, id int64, streams []string) ([][]byte, error) {
+	frame, err := json.Marshal(binanceRequest{Method: method, Params: streams, ID: id})
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{frame}, nil
+}
+
+func (BinanceProtocol) DecodeResponse(msg []byte) (Response, bool) {
+	if !isBinanceResponse(msg) {
+		return Response{}, false
+	}
+
+	var resp binanceResponse
+	if err := json.Unmarshal(msg, &resp); err != nil || resp.ID == nil {
+		return Response{}, false
+	}
+
+	r := Response{ID: *resp.ID, HasID: true, Result: resp.Result}
+	if resp.Error != nil {
+		r.Err = resp.Error
+	}
+	return r, true
+}
+
+func (BinanceProtocol) AcksByID() bool {
+	return true
+}
+
+func (BinanceProtocol) MaxStreamsPerRequest() int {
+	return maxParamsPerRequest
+}
+
+func (BinanceProtocol) ValidateStream(name string) error {
+	_, err := ParseStream(name)
+	return err
+}
+
+// isBinanceResponse - дешевая проверка без полного парсинга:
+// ответы на запросы это объект с полем "id" и без "stream"/"e"
+func isBinanceResponse(msg []byte) bool {
+	if len(msg) == 0 || msg[0] != '{' {
+		return false
+	}
+	return bytes.Contains(msg, []byte(`"id"`)) &&
+		!bytes.HasPrefix(msg, []byte(`{"stream"`)) &&
+		!bytes.Contains(msg, []byte(`"e":`))
+}
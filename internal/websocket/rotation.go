@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Binance разрывает соединение через 24 часа - меняем его заранее
+	defaultRotateAfter = 23*time.Hour + 30*time.Minute
+	// Сколько оба соединения работают параллельно
+	defaultRotationOverlap = 10 * time.Second
+	// После закрытия старого соединения дедупликация держится еще немного:
+	// его последние сообщения могут быть еще в пути
+	dedupGrace = 5 * time.Second
+	// Пауза перед повторной попыткой, если новое соединение не открылось
+	rotationRetry = time.Minute
+)
+
+// WithRotation задает, через сколько заменять соединение и сколько
+// держать оба соединения открытыми
+func WithRotation(after, overlap time.Duration) Option {
+	return func(c *WSclient) {
+		if after > 0 {
+			c.rotateAfter = after
+		}
+		if overlap > 0 {
+			c.rotationOverlap = overlap
+		}
+	}
+}
+
+// rotate открывает новое соединение, переносит на него подписки и
+// некоторое время читает оба, отбрасывая дубли. Затем старое закрывается.
+func (c *WSclient) rotate(ctx context.Context, old *session) (*session, error) {
+	slog.Info("🔄 Rotating WebSocket connection", "overlap", c.rotationOverlap)
+
+	// Включаем заранее: то, что старое соединение отдаст во время dial,
+	// тоже должно запомниться, иначе новое соединение его продублирует
+	c.dedup.enable(c.rotationOverlap + dedupGrace + writeTimeout)
+
+	newConn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := c.startSession(ctx, newConn)
+
+	// Запросы подписки теперь уходят в новое соединение
+	c.setConn(newConn)
+	c.subs.resubscribe(ctx)
+
+	select {
+	case <-time.After(c.rotationOverlap):
+	case <-ctx.Done():
+	}
+
+	old.force(ReasonRotation)
+	<-old.done
+	c.countReconnect(ReasonRotation)
+
+	slog.Info("✅ WebSocket connection rotated")
+	return sess, nil
+}
+
+// deduplicator отбрасывает повторные события, пока включен
+type deduplicator struct {
+	mu    sync.Mutex
+	until time.Time
+	seen  map[string]struct{}
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{}
+}
+
+func (d *deduplicator) enable(period time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.until = time.Now().Add(period)
+	if d.seen == nil {
+		d.seen = make(map[string]struct{})
+	}
+}
+
+// duplicate возвращает true, если такое событие уже проходило
+func (d *deduplicator) duplicate(msg []byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		return false
+	}
+	if time.Now().After(d.until) {
+		d.seen = nil
+		return false
+	}
+
+	key := dedupKey(msg)
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	d.seen[key] = struct{}{}
+	return false
+}
+
+type dedupEnvelope struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// dedupEvent - поля, по которым событие однозначно определяется.
+// Типы не фиксируем: в разных событиях одна и та же буква значит разное
+// (например, "a" - ID агрегированной сделки или цена ask).
+// TradeTime и FirstUpdate нужны только для того, чтобы "T" и "U" не попали
+// в "t" и "u": encoding/json сопоставляет ключи без учета регистра
+type dedupEvent struct {
+	EventType   string          `json:"e"`
+	EventTime   int64           `json:"E"`
+	Symbol      string          `json:"s"`
+	AggID       json.RawMessage `json:"a"`
+	TradeID     json.RawMessage `json:"t"`
+	TradeTime   json.RawMessage `json:"T"`
+	UpdateID    json.RawMessage `json:"u"`
+	FirstUpdate json.RawMessage `json:"U"`
+}
+
+// dedupKey строит ключ события: ID сделки/обновления, если он есть,
+// иначе время события. Для массивов и непонятных сообщений - хэш содержимого.
+func dedupKey(msg []byte) string {
+	data := msg
+	stream := ""
+
+	if bytes.HasPrefix(msg, []byte(`{"stream"`)) {
+		var env dedupEnvelope
+		if err := json.Unmarshal(msg, &env); err == nil {
+			data, stream = env.Data, env.Stream
+		}
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		var ev dedupEvent
+		if err := json.Unmarshal(data, &ev); err == nil {
+			key := stream + "|" + ev.EventType + "|" + ev.Symbol + "|"
+			switch {
+			case ev.EventType == AggTrade && len(ev.AggID) > 0:
+				return key + "a" + string(ev.AggID)
+			case len(ev.TradeID) > 0 && ev.TradeID[0] != '"':
+				return key + "t" + string(ev.TradeID)
+			case len(ev.UpdateID) > 0:
+				return key + "u" + string(ev.UpdateID)
+			case ev.EventTime > 0:
+				return key + "E" + strconv.FormatInt(ev.EventTime, 10)
+			}
+		}
+	}
+
+	h := fnv.New64a()
+	h.Write(msg)
+	return "#" + strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,80 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/mockexchange"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+// startClient поднимает mockexchange и клиента на path ("/stream", "/ws/<stream>")
+func startClient(t *testing.T, mock mockexchange.Config, path string, opts ...websocket.Option) (*websocket.WSclient, *mockexchange.Server, chan []byte) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	srv := mockexchange.New(mock)
+	url, err := srv.Listen(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan []byte, 10000)
+	client := websocket.New(url+path, out, 10*time.Millisecond, opts...)
+	go client.Start(ctx)
+	return client, srv, out
+}
+
+// waitReason ждет, пока клиент разорвет соединение с причиной reason n раз
+func waitReason(t *testing.T, client *websocket.WSclient, reason websocket.ReconnectReason, n int64, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for client.Stats().Reasons[reason] < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("reasons = %v, want %d x %s", client.Stats().Reasons, n, reason)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Пока оба соединения открыты, сделки приходят по обоим: после ротаций
+// каждая сделка должна выйти ровно один раз и без пропусков
+func TestRotationNoDuplicatesNoGaps(t *testing.T) {
+	client, _, out := startClient(t,
+		mockexchange.Config{TickInterval: 10 * time.Millisecond, Delay: time.Millisecond},
+		"/stream",
+		websocket.WithRotation(300*time.Millisecond, 150*time.Millisecond))
+
+	if err := client.Subscriptions().Subscribe(context.Background(), streams("btcusdt", "ethusdt")...); err != nil {
+		t.Fatal(err)
+	}
+	waitReason(t, client, websocket.ReasonRotation, 3, 5*time.Second)
+
+	last := make(map[string]int64)
+	for len(out) > 0 {
+		var env struct {
+			Data struct {
+				Symbol string `json:"s"`
+				AggID  int64  `json:"a"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(<-out, &env); err != nil {
+			t.Fatal(err)
+		}
+
+		symbol, id := env.Data.Symbol, env.Data.AggID
+		if prev, ok := last[symbol]; ok && id != prev+1 {
+			t.Fatalf("%s: aggregate ID %d after %d, want %d", symbol, id, prev, prev+1)
+		}
+		last[symbol] = id
+	}
+	if len(last) != 2 {
+		t.Errorf("trades for %v, want btcusdt and ethusdt", last)
+	}
+	if r := client.Stats().Reasons; r[websocket.ReasonRotation] != client.Stats().Reconnects {
+		t.Errorf("reasons = %v, want only rotations", r)
+	}
+}
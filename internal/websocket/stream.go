@@ -0,0 +1,254 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	BaseURL = "wss://stream.binance.com:9443"
+
+	// MaxStreamsPerConnection - лимит Binance на количество стримов в одном соединении
+	MaxStreamsPerConnection = 1024
+)
+
+// StreamKind - тип стрима Binance (часть имени после "@")
+type StreamKind string
+
+const (
+	KindAggTrade   StreamKind = "aggTrade"
+	KindTrade      StreamKind = "trade"
+	KindMiniTicker StreamKind = "miniTicker"
+	KindBookTicker StreamKind = "bookTicker"
+	KindDepth      StreamKind = "depth"
+	KindDepth100ms StreamKind = "depth@100ms"
+
+	// KindAllMiniTickers - стрим по всему рынку, символ не указывается.
+	// Частота обновлений задается суффиксом: !miniTicker@arr@3000ms
+	KindAllMiniTickers StreamKind = "!miniTicker@arr"
+
+	klinePrefix = "kline_"
+)
+
+var (
+	ErrInvalidSymbol   = errors.New("invalid symbol")
+	ErrInvalidStream   = errors.New("invalid stream kind")
+	ErrTooManyStreams  = fmt.Errorf("more than %d streams per connection", MaxStreamsPerConnection)
+	ErrNoStreams       = errors.New("no streams specified")
+	ErrMixedMarketWide = errors.New("market-wide stream cannot be combined with other streams")
+)
+
+var symbolRe = regexp.MustCompile(`^[a-z0-9]{2,20}$`)
+
+// updateSpeedRe - суффикс частоты обновлений стрима по всему рынку
+var updateSpeedRe = regexp.MustCompile(`^@[1-9][0-9]*ms$`)
+
+// klineIntervals - интервалы, которые поддерживает Binance для kline_<interval>
+var klineIntervals = map[string]struct{}{
+	"1s": {}, "1m": {}, "3m": {}, "5m": {}, "15m": {}, "30m": {},
+	"1h": {}, "2h": {}, "4h": {}, "6h": {}, "8h": {}, "12h": {},
+	"1d": {}, "3d": {}, "1w": {}, "1M": {},
+}
+
+var simpleKinds = map[StreamKind]struct{}{
+	KindAggTrade:   {},
+	KindTrade:      {},
+	KindMiniTicker: {},
+	KindBookTicker: {},
+	KindDepth:      {},
+	KindDepth100ms: {},
+}
+
+var marketWideKinds = map[StreamKind]struct{}{
+	KindAllMiniTickers: {},
+}
+
+// KindKline возвращает тип стрима свечей для интервала, например kline_1m
+func KindKline(interval string) StreamKind {
+	return StreamKind(klinePrefix + interval)
+}
+
+// Base - тип без суффикса частоты обновлений: !miniTicker@arr@3000ms -> !miniTicker@arr
+func (k StreamKind) Base() StreamKind {
+	for base := range marketWideKinds {
+		if speed, ok := strings.CutPrefix(string(k), string(base)); ok && updateSpeedRe.MatchString(speed) {
+			return base
+		}
+	}
+	return k
+}
+
+// IsMarketWide - стрим по всему рынку (без символа)
+func (k StreamKind) IsMarketWide() bool {
+	_, ok := marketWideKinds[k.Base()]
+	return ok
+}
+
+func (k StreamKind) Validate() error {
+	if _, ok := simpleKinds[k]; ok {
+		return nil
+	}
+	if k.IsMarketWide() {
+		return nil
+	}
+	if interval, ok := strings.CutPrefix(string(k), klinePrefix); ok {
+		if _, ok := klineIntervals[interval]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidStream, k)
+}
+
+// Stream - описание одного стрима: символ + тип
+type Stream struct {
+	Symbol string
+	Kind   StreamKind
+}
+
+// NewStream создает описание стрима, символ приводится к нижнему регистру
+func NewStream(symbol string, kind StreamKind) Stream {
+	return Stream{
+		Symbol: strings.ToLower(symbol),
+		Kind:   kind,
+	}
+}
+
+// Name возвращает имя стрима в формате Binance: btcusdt@aggTrade
+func (s Stream) Name() string {
+	if s.Kind.IsMarketWide() {
+		return string(s.Kind)
+	}
+	return strings.ToLower(s.Symbol) + "@" + string(s.Kind)
+}
+
+func (s Stream) String() string {
+	return s.Name()
+}
+
+func (s Stream) Validate() error {
+	if err := s.Kind.Validate(); err != nil {
+		return err
+	}
+
+	if s.Kind.IsMarketWide() {
+		if s.Symbol != "" {
+			return fmt.Errorf("%w: market-wide stream %q takes no symbol", ErrInvalidSymbol, s.Kind)
+		}
+		return nil
+	}
+
+	if !symbolRe.MatchString(strings.ToLower(s.Symbol)) {
+		return fmt.Errorf("%w: %q", ErrInvalidSymbol, s.Symbol)
+	}
+	return nil
+}
+
+// ParseStream разбирает имя стрима вида btcusdt@aggTrade, !miniTicker@arr
+// или !miniTicker@arr@3000ms
+func ParseStream(name string) (Stream, error) {
+	var s Stream
+
+	if kind := StreamKind(name); kind.IsMarketWide() {
+		s = Stream{Kind: kind}
+	} else {
+		symbol, kind, found := strings.Cut(name, "@")
+		if !found {
+			return Stream{}, fmt.Errorf("%w: %q", ErrInvalidStream, name)
+		}
+		s = Stream{Symbol: symbol, Kind: StreamKind(kind)}
+	}
+
+	if err := s.Validate(); err != nil {
+		return Stream{}, err
+	}
+	return s, nil
+}
+
+// ParseStreams разбирает список имен стримов (например, из конфига)
+func ParseStreams(names []string) ([]Stream, error) {
+	streams := make([]Stream, 0, len(names))
+	for _, name := range names {
+		s, err := ParseStream(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
+
+// RawURL - адрес raw-стрима (/ws/<stream>), сообщения приходят без обертки
+func RawURL(s Stream) (string, error) {
+	return rawURL(BaseURL, s)
+}
+
+// CombinedURL - адрес combined-стрима (/stream?streams=a/b/c),
+// каждое сообщение приходит в обертке {"stream": ..., "data": ...}
+func CombinedURL(streams ...Stream) (string, error) {
+	return combinedURL(BaseURL, streams)
+}
+
+// URL выбирает формат подключения под то, что умеет разбирать processor:
+// единственный стрим по всему рынку - raw (приходит массив),
+// все остальное - combined
+func URL(streams []Stream) (string, error) {
+	return BuildURL(BaseURL, streams)
+}
+
+// BuildURL - то же, что URL, но для другого адреса биржи
+// (например, локального mockexchange)
+func BuildURL(base string, streams []Stream) (string, error) {
+	if len(streams) == 1 && streams[0].Kind.IsMarketWide() {
+		return rawURL(base, streams[0])
+	}
+
+	for _, s := range streams {
+		if s.Kind.IsMarketWide() {
+			return "", fmt.Errorf("%w: %s", ErrMixedMarketWide, s.Name())
+		}
+	}
+	return combinedURL(base, streams)
+}
+
+func rawURL(base string, s Stream) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	return base + "/ws/" + s.Name(), nil
+}
+
+func combinedURL(base string, streams []Stream) (string, error) {
+	names, err := streamNames(streams)
+	if err != nil {
+		return "", err
+	}
+	return base + "/stream?streams=" + strings.Join(names, "/"), nil
+}
+
+// streamNames валидирует стримы, убирает дубликаты и проверяет лимит Binance
+func streamNames(streams []Stream) ([]string, error) {
+	if len(streams) == 0 {
+		return nil, ErrNoStreams
+	}
+
+	seen := make(map[string]struct{}, len(streams))
+	names := make([]string, 0, len(streams))
+	for _, s := range streams {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		name := s.Name()
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	if len(names) > MaxStreamsPerConnection {
+		return nil, ErrTooManyStreams
+	}
+	return names, nil
+}
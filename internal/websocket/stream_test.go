@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseStreamMarketWide(t *testing.T) {
+	for _, name := range []string{"!miniTicker@arr", "!miniTicker@arr@1000ms", "!miniTicker@arr@3000ms"} {
+		st, err := ParseStream(name)
+		if err != nil {
+			t.Errorf("ParseStream(%q) error = %v", name, err)
+			continue
+		}
+		if st.Symbol != "" || !st.Kind.IsMarketWide() || st.Kind.Base() != KindAllMiniTickers || st.Name() != name {
+			t.Errorf("ParseStream(%q) = %+v, want market-wide %s", name, st, KindAllMiniTickers)
+		}
+		if url, err := BuildURL("ws://localhost", []Stream{st}); err != nil || url != "ws://localhost/ws/"+name {
+			t.Errorf("BuildURL(%q) = %q, %v, want raw URL", name, url, err)
+		}
+	}
+
+	for _, name := range []string{"!miniTicker@arr@", "!miniTicker@arr@0ms", "!miniTicker@arr@3000", "!miniTicker@arr@fastms", "!miniTicker@arr@3000ms@1000ms"} {
+		if _, err := ParseStream(name); !errors.Is(err, ErrInvalidStream) {
+			t.Errorf("ParseStream(%q) error = %v, want ErrInvalidStream", name, err)
+		}
+	}
+}
+
+// Ожидание тишины для !miniTicker@arr действует на обе формы имени
+func TestStaleStreamMarketWideSpeed(t *testing.T) {
+	for _, name := range []string{"!miniTicker@arr", "!miniTicker@arr@3000ms"} {
+		c := New("ws://localhost/ws/"+name, nil, time.Second)
+		sess := newSession(nil, 1)
+
+		now := time.Now()
+		if stream, _ := c.staleStream(sess, now); stream != "" {
+			t.Errorf("%s: stale right away", name)
+		}
+		sess.touch(name, now)
+		if stream, _ := c.staleStream(sess, now.Add(20*time.Second)); stream != "" {
+			t.Errorf("%s: stale after 20s", name)
+		}
+		if stream, silence := c.staleStream(sess, now.Add(31*time.Second)); stream != name || silence != 31*time.Second {
+			t.Errorf("%s: staleStream after 31s = %q, %s, want the stream silent for 31s", name, stream, silence)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ackTimeout - сколько ждем ответа биржи на запрос
+	ackTimeout = 10 * time.Second
+	// maxParamsPerRequest - ограничение на количество стримов в одном SUBSCRIBE Binance,
+	// чтобы не упереться в размер фрейма при переподписке
+	maxParamsPerRequest = 200
+	// requestInterval - пауза между запросами одного соединения: Binance
+	// принимает не больше 5 сообщений в секунду
+	requestInterval = 250 * time.Millisecond
+)
+
+// ErrNotConnected возвращается, когда запрос нельзя отправить: соединения нет
+var ErrNotConnected = errors.New("websocket is not connected")
+
+// SubscriptionManager хранит активный набор стримов WSclient,
+// отправляет SUBSCRIBE/UNSUBSCRIBE/LIST_SUBSCRIPTIONS и ждет подтверждений по id.
+// Формат запросов и ответов задает Protocol клиента.
+// После каждого переподключения набор применяется заново.
+type SubscriptionManager struct {
+	client *WSclient
+
+	mu      sync.Mutex
+	active  map[string]struct{}
+	pending map[int64]chan Response
+
+	nextID atomic.Int64
+
+	throttleMu  sync.Mutex
+	nextRequest time.Time // раньше этого запросы не отправляются
+}
+
+func newSubscriptionManager(client *WSclient) *SubscriptionManager {
+	return &SubscriptionManager{
+		client:  client,
+		active:  make(map[string]struct{}),
+		pending: make(map[int64]chan Response),
+	}
+}
+
+// Subscribe добавляет стримы в активный набор и подписывается на них.
+// Если соединения сейчас нет, стримы будут применены при подключении.
+func (m *SubscriptionManager) Subscribe(ctx context.Context, streams ...string) error {
+	if len(streams) == 0 {
+		return nil
+	}
+
+	for _, name := range streams {
+		if err := m.client.protocol.ValidateStream(name); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	added := 0
+	for _, s := range streams {
+		if _, ok := m.active[s]; !ok {
+			added++
+		}
+	}
+	if len(m.active)+added > MaxStreamsPerConnection {
+		m.mu.Unlock()
+		return ErrTooManyStreams
+	}
+	for _, s := range streams {
+		m.active[s] = struct{}{}
+	}
+	m.mu.Unlock()
+
+	err := m.callChunked(ctx, MethodSubscribe, streams)
+	if errors.Is(err, ErrNotConnected) {
+		return nil
+	}
+
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		// Биржа отказала - такие стримы не должны переподписываться
+		m.mu.Lock()
+		for _, s := range streams {
+			delete(m.active, s)
+		}
+		m.mu.Unlock()
+	}
+
+	return err
+}
+
+// Unsubscribe убирает стримы из активного набора и отписывается от них
+func (m *SubscriptionManager) Unsubscribe(ctx context.Context, streams ...string) error {
+	if len(streams) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	for _, s := range streams {
+		delete(m.active, s)
+	}
+	m.mu.Unlock()
+
+	err := m.callChunked(ctx, MethodUnsubscribe, streams)
+	if errors.Is(err, ErrNotConnected) {
+		return nil
+	}
+	return err
+}
+
+// List запрашивает у биржи список подписок текущего соединения
+func (m *SubscriptionManager) List(ctx context.Context) ([]string, error) {
+	result, err := m.call(ctx, MethodList, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []string
+	if err := json.Unmarshal(result, &streams); err != nil {
+		return nil, fmt.Errorf("could not parse subscriptions list: %w", err)
+	}
+	return streams, nil
+}
+
+// Active возвращает активный набор стримов (отсортированный)
+func (m *SubscriptionManager) Active() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	streams := make([]string, 0, len(m.active))
+	for s := range m.active {
+		streams = append(streams, s)
+	}
+	sort.Strings(streams)
+	return streams
+}
+
+// IsActive - стрим в активном наборе: будет применен после переподключения
+func (m *SubscriptionManager) IsActive(stream string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.active[stream]
+	return ok
+}
+
+// resubscribe применяет активный набор к новому соединению
+func (m *SubscriptionManager) resubscribe(ctx context.Context) {
+	streams := m.Active()
+	if len(streams) == 0 {
+		return
+	}
+
+	if err := m.callChunked(ctx, MethodSubscribe, streams); err != nil {
+		slog.Error("❌ Resubscribe failed", "error", err, "streams", len(streams))
+		return
+	}
+
+	slog.Info("🔁 Subscriptions restored", "streams", len(streams))
+}
+
+// callChunked отправляет запрос частями, сколько протокол допускает в одном запросе
+func (m *SubscriptionManager) callChunked(ctx context.Context, method Method, streams []string) error {
+	chunk := max(m.client.protocol.MaxStreamsPerRequest(), 1)
+	for start := 0; start < len(streams); start += chunk {
+		end := min(start+chunk, len(streams))
+		if _, err := m.call(ctx, method, streams[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SubscriptionManager) call(
+	ctx context.Context,
+	method Method,
+	params []string,
+) (json.RawMessage, error) {
+	id := m.nextID.Add(1)
+	frames, err := m.client.protocol.EncodeRequest(method, id, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	if !m.client.protocol.AcksByID() {
+		// Подтверждений по id нет - достаточно отправить
+		for _, frame := range frames {
+			if err := m.client.writeMessage(frame); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	ch := make(chan Response, 1)
+
+	m.mu.Lock()
+	m.pending[id] = ch
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, id)
+		m.mu.Unlock()
+	}()
+
+	for _, frame := range frames {
+		if err := m.client.writeMessage(frame); err != nil {
+			return nil, err
+		}
+	}
+
+	timer := time.NewTimer(ackTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, ErrNotConnected
+		}
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
+		return resp.Result, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%s request %d: ack timeout", method, id)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// throttle выдерживает requestInterval между запросами соединения, из каких
+// бы вызовов они ни шли: Subscribe, Unsubscribe, переподписка и перенос
+// стримов пулом делят один лимит
+func (m *SubscriptionManager) throttle(ctx context.Context) error {
+	m.throttleMu.Lock()
+	now := time.Now()
+	at := m.nextRequest
+	if at.Before(now) {
+		at = now
+	}
+	m.nextRequest = at.Add(requestInterval)
+	m.throttleMu.Unlock()
+
+	if !at.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleResponse проверяет, является ли сообщение ответом на наш запрос
+// или служебным сообщением биржи. Такие сообщения не уходят в выходной канал клиента.
+func (m *SubscriptionManager) handleResponse(msg []byte) bool {
+	resp, ok := m.client.protocol.DecodeResponse(msg)
+	if !ok {
+		return false
+	}
+	if !resp.HasID {
+		return true
+	}
+
+	m.mu.Lock()
+	ch, ok := m.pending[resp.ID]
+	if ok {
+		delete(m.pending, resp.ID)
+	}
+	m.mu.Unlock()
+
+	if ok {
+		ch <- resp
+	} else {
+		// OKX подтверждает каждый стрим запроса отдельным сообщением с тем же id
+		slog.Debug("Response for unknown request", "id", resp.ID)
+	}
+	return true
+}
+
+// cancelPending будит всех, кто ждет ответа: соединение разорвано
+func (m *SubscriptionManager) cancelPending() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, ch := range m.pending {
+		close(ch)
+		delete(m.pending, id)
+	}
+}
@@ -0,0 +1,283 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReconnectReason - почему соединение было разорвано
+type ReconnectReason string
+
+const (
+	ReasonReadError   ReconnectReason = "read_error"   // ошибка чтения
+	ReasonServerClose ReconnectReason = "server_close" // биржа закрыла соединение
+	ReasonDeadSocket  ReconnectReason = "dead_socket"  // нет ни данных, ни pong
+	ReasonStreamStale ReconnectReason = "stream_stale" // сокет жив, но стрим замолчал
+	ReasonRotation    ReconnectReason = "rotation"     // плановая замена соединения
+	ReasonShutdown    ReconnectReason = "shutdown"     // остановка клиента
+)
+
+// WatchdogConfig - ожидания от соединения.
+// StreamSilence задает, сколько стрим данного типа может молчать:
+// для !miniTicker@arr тишина означает проблему, для aggTrade редкой
+// монеты - просто спокойный рынок, поэтому по умолчанию он не проверяется
+type WatchdogConfig struct {
+	PingInterval  time.Duration // как часто отправлять ping со своей стороны
+	DeadAfter     time.Duration // без единого фрейма и pong сокет считается мертвым
+	CheckInterval time.Duration // как часто проверять стримы
+	StreamSilence map[StreamKind]time.Duration
+}
+
+func defaultWatchdogConfig() WatchdogConfig {
+	return WatchdogConfig{
+		PingInterval:  15 * time.Second,
+		DeadAfter:     45 * time.Second,
+		CheckInterval: 5 * time.Second,
+		StreamSilence: map[StreamKind]time.Duration{
+			KindAllMiniTickers: 30 * time.Second,
+		},
+	}
+}
+
+// WithWatchdog переопределяет настройки watchdog, нулевые поля остаются по умолчанию
+func WithWatchdog(cfg WatchdogConfig) Option {
+	return func(c *WSclient) {
+		if cfg.PingInterval > 0 {
+			c.watchdog.PingInterval = cfg.PingInterval
+		}
+		if cfg.DeadAfter > 0 {
+			c.watchdog.DeadAfter = cfg.DeadAfter
+		}
+		if cfg.CheckInterval > 0 {
+			c.watchdog.CheckInterval = cfg.CheckInterval
+		}
+		if cfg.StreamSilence != nil {
+			c.watchdog.StreamSilence = cfg.StreamSilence
+		}
+	}
+}
+
+// ReconnectReasons возвращает счетчики разрывов по причинам
+func (c *WSclient) ReconnectReasons() map[ReconnectReason]int64 {
+	return c.reasons.snapshot()
+}
+
+func (c *WSclient) countReconnect(reason ReconnectReason) {
+	c.reconnects.Add(1)
+	c.reasons.inc(reason)
+}
+
+type reasonCounters struct {
+	mu     sync.Mutex
+	counts map[ReconnectReason]int64
+}
+
+func (r *reasonCounters) inc(reason ReconnectReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.counts == nil {
+		r.counts = make(map[ReconnectReason]int64)
+	}
+	r.counts[reason]++
+}
+
+func (r *reasonCounters) snapshot() map[ReconnectReason]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[ReconnectReason]int64, len(r.counts))
+	for reason, n := range r.counts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// session - одно физическое соединение и то, что watchdog про него знает
+type session struct {
+	id     uint32
+	conn   *websocket.Conn
+	done   chan struct{}
+	reason ReconnectReason // заполняется до закрытия done
+
+	mu        sync.Mutex
+	lastSeen  map[string]time.Time // стрим -> последнее сообщение
+	firstSeen map[string]time.Time // стрим -> когда watchdog впервые его проверил
+	forced    ReconnectReason
+}
+
+func newSession(conn *websocket.Conn, id uint32) *session {
+	return &session{
+		id:        id,
+		conn:      conn,
+		done:      make(chan struct{}),
+		lastSeen:  make(map[string]time.Time),
+		firstSeen: make(map[string]time.Time),
+	}
+}
+
+func (s *session) touch(stream string, now time.Time) {
+	if stream == "" {
+		return
+	}
+
+	s.mu.Lock()
+	s.lastSeen[stream] = now
+	s.mu.Unlock()
+}
+
+// silentFor - сколько стрим молчит. Стрим, подписанный посреди сессии,
+// отсчитывается с момента, когда watchdog его впервые увидел
+func (s *session) silentFor(stream string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.lastSeen[stream]; ok {
+		return now.Sub(last)
+	}
+
+	first, ok := s.firstSeen[stream]
+	if !ok {
+		first = now
+		s.firstSeen[stream] = first
+	}
+	return now.Sub(first)
+}
+
+// force разрывает соединение с указанной причиной
+func (s *session) force(reason ReconnectReason) {
+	s.mu.Lock()
+	if s.forced == "" {
+		s.forced = reason
+	}
+	s.mu.Unlock()
+
+	s.conn.Close()
+}
+
+func (s *session) forcedReason() ReconnectReason {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forced
+}
+
+// watch отправляет ping и следит, чтобы ожидаемые стримы не молчали
+func (c *WSclient) watch(sess *session) {
+	interval := c.watchdog.PingInterval
+	if c.heartbeat.Interval > 0 {
+		interval = c.heartbeat.Interval
+	}
+
+	ping := time.NewTicker(interval)
+	defer ping.Stop()
+	check := time.NewTicker(c.watchdog.CheckInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-sess.done:
+			return
+
+		case <-ping.C:
+			// Ответ (или его отсутствие) увидит читатель через дедлайн
+			var err error
+			if c.heartbeat.Payload != nil {
+				err = c.writeTo(sess.conn, c.heartbeat.Payload)
+			} else {
+				err = sess.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+			}
+			if err != nil {
+				slog.Debug("Could not send ping", "error", err)
+			}
+
+		case now := <-check.C:
+			if stream, silence := c.staleStream(sess, now); stream != "" {
+				slog.Warn("⚠️ Stream stopped delivering data, reconnecting",
+					"stream", stream,
+					"silence", silence.Round(time.Second))
+				sess.force(ReasonStreamStale)
+				return
+			}
+		}
+	}
+}
+
+// staleStream ищет стрим, который молчит дольше, чем для него допустимо
+func (c *WSclient) staleStream(sess *session, now time.Time) (string, time.Duration) {
+	streams := c.subs.Active()
+	if c.rawStream != "" {
+		streams = append(streams, c.rawStream)
+	}
+
+	for _, name := range streams {
+		st, err := ParseStream(name)
+		if err != nil {
+			continue
+		}
+
+		// Ожидание для !miniTicker@arr действует и на !miniTicker@arr@3000ms
+		limit, ok := c.watchdog.StreamSilence[st.Kind]
+		if !ok {
+			limit, ok = c.watchdog.StreamSilence[st.Kind.Base()]
+		}
+		if !ok || limit <= 0 {
+			continue
+		}
+
+		if silence := sess.silentFor(name, now); silence > limit {
+			return name, silence
+		}
+	}
+	return "", 0
+}
+
+// classifyReadError превращает ошибку чтения в причину разрыва
+func classifyReadError(err error) ReconnectReason {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return ReasonServerClose
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonDeadSocket
+	}
+	return ReasonReadError
+}
+
+// streamOf достает имя стрима из combined-сообщения без парсинга JSON.
+// Для raw-подключения стрим один и известен заранее
+func streamOf(msg []byte, raw string) string {
+	rest, ok := bytes.CutPrefix(msg, []byte(`{"stream":"`))
+	if !ok {
+		return raw
+	}
+
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return raw
+	}
+	return string(rest[:end])
+}
+
+// rawStreamName - имя стрима из адреса вида wss://host/ws/btcusdt@aggTrade
+func rawStreamName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	name, ok := strings.CutPrefix(u.Path, "/ws/")
+	if !ok {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,75 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WWoi/web-parcer/internal/mockexchange"
+	"github.com/WWoi/web-parcer/internal/websocket"
+)
+
+func testWatchdog() websocket.Option {
+	return websocket.WithWatchdog(websocket.WatchdogConfig{
+		CheckInterval: 20 * time.Millisecond,
+		StreamSilence: map[websocket.StreamKind]time.Duration{
+			websocket.KindAllMiniTickers: 200 * time.Millisecond,
+		},
+	})
+}
+
+// Сокет жив, но !miniTicker@arr замолчал: клиент переподключается
+func TestWatchdogSilentStream(t *testing.T) {
+	const stream = "!miniTicker@arr@1000ms"
+	client, srv, out := startClient(t, mockexchange.Config{Scripted: true}, "/ws/"+stream, testWatchdog())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.Connections() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not connect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := srv.Broadcast(stream, []any{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("first tickers were not delivered")
+	}
+
+	waitReason(t, client, websocket.ReasonStreamStale, 1, 2*time.Second)
+	if r := client.Stats().Reasons; len(r) != 1 {
+		t.Errorf("reasons = %v, want only %s", r, websocket.ReasonStreamStale)
+	}
+}
+
+// Фреймы идут, но реже, чем стрим может молчать: это тоже тишина
+func TestWatchdogSlowDelivery(t *testing.T) {
+	client, srv, out := startClient(t,
+		mockexchange.Config{TickInterval: 20 * time.Millisecond},
+		"/ws/"+string(websocket.KindAllMiniTickers), testWatchdog())
+
+	select {
+	case <-out:
+	case <-time.After(2 * time.Second):
+		t.Fatal("tickers were not delivered")
+	}
+	if r := client.Stats().Reasons; len(r) != 0 {
+		t.Fatalf("reasons before slowdown = %v, want none", r)
+	}
+
+	srv.SetDelay(500 * time.Millisecond)
+	waitReason(t, client, websocket.ReasonStreamStale, 1, 2*time.Second)
+}
+
+// aggTrade редкой монеты может молчать сколько угодно: без ожидания в
+// StreamSilence тишина не повод переподключаться
+func TestWatchdogIgnoresUnexpectedSilence(t *testing.T) {
+	client, _, _ := startClient(t, mockexchange.Config{Scripted: true}, "/ws/btcusdt@aggTrade", testWatchdog())
+
+	time.Sleep(500 * time.Millisecond)
+	if s := client.Stats(); !s.Connected || s.Reconnects != 0 {
+		t.Errorf("stats = %+v, want connected without reconnects", s)
+	}
+}